@@ -0,0 +1,91 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// BackendType is where Terraform runs are executed
+// +kubebuilder:validation:Enum=TerraformCloud;Local
+type BackendType string
+
+const (
+	// TerraformCloudBackend executes runs in a Terraform Cloud workspace
+	TerraformCloudBackend BackendType = "TerraformCloud"
+
+	// LocalBackend executes runs with the terraform binary in Kubernetes Jobs, storing state
+	// in a Secret using the Terraform kubernetes backend
+	LocalBackend BackendType = "Local"
+)
+
+// DefaultLocalBackendImage is the image the Jobs of the local backend run by default
+const DefaultLocalBackendImage = "hashicorp/terraform:1.3.7"
+
+// Backend selects where Terraform runs are executed
+type Backend struct {
+	// Type is TerraformCloud or Local. Defaults to TerraformCloud.
+	// +kubebuilder:default=TerraformCloud
+	// +optional
+	Type BackendType `json:"type,omitempty"`
+
+	// Local configures the Jobs that execute runs when type is Local
+	// +optional
+	Local *LocalBackendSpec `json:"local,omitempty"`
+}
+
+// LocalBackendSpec configures the Jobs that run Terraform. State is stored in the Secret
+// tfstate-default-<workspace> in the namespace of the resource, so the service account of
+// the Jobs must be allowed to manage Secrets and Leases in that namespace.
+type LocalBackendSpec struct {
+	// Image is the image with the terraform binary to run. Defaults to hashicorp/terraform:1.3.7.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// ServiceAccountName is the service account the Jobs run as. It is required, as the default
+	// service account cannot manage the Secrets and Leases of the kubernetes state backend; see
+	// config/samples/local_backend_rbac.yaml for a Role granting them.
+	ServiceAccountName string `json:"serviceAccountName"`
+
+	// VariablesSecretRef refers to a Secret in the namespace of the resource whose keys are the names of
+	// Terraform variables and whose values are their values, taking the place of workspace variables
+	// +optional
+	VariablesSecretRef *corev1.LocalObjectReference `json:"variablesSecretRef,omitempty"`
+
+	// Env is the environment of the terraform process, e.g. provider credentials
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Resources are the compute resources of the terraform container
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// GetBackend returns where the Terraform runs of the control plane are executed
+func (c *TFCManagedControlPlane) GetBackend() Backend {
+	return c.Spec.Backend
+}
+
+// GetBackend returns where the Terraform runs of the machine pool are executed
+func (m *TFCManagedMachinePool) GetBackend() Backend {
+	return m.Spec.Backend
+}
+
+// IsLocal returns true if runs are executed by the local backend
+func (b Backend) IsLocal() bool {
+	return b.Type == LocalBackend
+}
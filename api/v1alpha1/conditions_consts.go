@@ -0,0 +1,74 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+const (
+	// WorkloadClusterReadyCondition reports whether the API server of the workload
+	// cluster provisioned by Terraform is reachable, ready and running the desired version.
+	WorkloadClusterReadyCondition clusterv1beta1.ConditionType = "WorkloadClusterReady"
+
+	// WaitingForTerraformRunReason is used while the Terraform run provisioning the cluster has not been applied.
+	WaitingForTerraformRunReason = "WaitingForTerraformRun"
+
+	// APIServerUnreachableReason is used when the API server cannot be reached using the generated kubeconfig.
+	APIServerUnreachableReason = "APIServerUnreachable"
+
+	// APIServerNotReadyReason is used when the API server reports that it is not ready.
+	APIServerNotReadyReason = "APIServerNotReady"
+
+	// VersionMismatchReason is used when the API server reports a different version than the one requested.
+	VersionMismatchReason = "VersionMismatch"
+
+	// NodesReadyCondition reports whether the instances of a machine pool have joined the
+	// workload cluster as Ready Nodes.
+	NodesReadyCondition clusterv1beta1.ConditionType = "NodesReady"
+
+	// WorkloadClusterUnreachableReason is used when the workload cluster cannot be reached using its kubeconfig Secret.
+	WorkloadClusterUnreachableReason = "WorkloadClusterUnreachable"
+
+	// WaitingForNodesReason is used while fewer Nodes than expected are Ready.
+	WaitingForNodesReason = "WaitingForNodes"
+
+	// VersionUpgradeCondition reports the progress of a Kubernetes version upgrade of the control plane.
+	VersionUpgradeCondition clusterv1beta1.ConditionType = "VersionUpgrade"
+
+	// UnsupportedVersionSkewReason is used when the requested version is a downgrade or skips a minor version.
+	UnsupportedVersionSkewReason = "UnsupportedVersionSkew"
+
+	// WaitingForUpgradePlanReason is used while the speculative plan for an upgrade is running.
+	WaitingForUpgradePlanReason = "WaitingForUpgradePlan"
+
+	// UpgradePlanFailedReason is used when the speculative plan for an upgrade did not finish successfully.
+	UpgradePlanFailedReason = "UpgradePlanFailed"
+
+	// UpgradePlanReplacesResourcesReason is used when the speculative plan for an upgrade would destroy or replace resources.
+	UpgradePlanReplacesResourcesReason = "UpgradePlanReplacesResources"
+
+	// ConfigurationSyncedCondition reports whether the configuration version being run was produced from the current spec.
+	ConfigurationSyncedCondition clusterv1beta1.ConditionType = "ConfigurationSynced"
+
+	// RolledBackReason is used while the rollback annotation pins a previous configuration version.
+	RolledBackReason = "RolledBack"
+
+	// RollbackTargetNotFoundReason is used when the rollback annotation refers to a configuration version that is not in the history.
+	RollbackTargetNotFoundReason = "RollbackTargetNotFound"
+
+	// InvalidAutoscalerAnnotationReason is used when a cluster-autoscaler size annotation of the MachinePool is not a non-negative integer.
+	InvalidAutoscalerAnnotationReason = "InvalidAutoscalerAnnotation"
+)
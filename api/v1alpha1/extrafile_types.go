@@ -0,0 +1,52 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ExtraFile is a file uploaded alongside the Terraform configuration, such as provider
+// configuration, a dependency lock file or *.auto.tfvars. Exactly one of content,
+// configMapKeyRef or secretKeyRef must be set.
+type ExtraFile struct {
+	// Name is the name of the file in the configuration
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_.-]+$`
+	Name string `json:"name"`
+
+	// Content is the content of the file
+	// +optional
+	Content string `json:"content,omitempty"`
+
+	// ConfigMapKeyRef selects a key of a ConfigMap in the namespace of the resource holding the content of the file
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+
+	// SecretKeyRef selects a key of a Secret in the namespace of the resource holding the content of the file
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// GetExtraFiles returns the files uploaded alongside the configuration
+func (c *TFCManagedControlPlane) GetExtraFiles() []ExtraFile {
+	return c.Spec.ExtraFiles
+}
+
+// GetExtraFiles returns the files uploaded alongside the configuration
+func (m *TFCManagedMachinePool) GetExtraFiles() []ExtraFile {
+	return m.Spec.ExtraFiles
+}
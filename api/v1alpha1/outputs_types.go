@@ -0,0 +1,142 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// Well-known fields that module outputs can be mapped to
+const (
+	// OutputFieldControlPlaneEndpointHost sets spec.controlPlaneEndpoint.host of a TFCManagedControlPlane
+	OutputFieldControlPlaneEndpointHost = "controlPlaneEndpoint.host"
+
+	// OutputFieldControlPlaneEndpointPort sets spec.controlPlaneEndpoint.port of a TFCManagedControlPlane
+	OutputFieldControlPlaneEndpointPort = "controlPlaneEndpoint.port"
+
+	// OutputFieldKubeconfig is the kubeconfig written to the Cluster's kubeconfig Secret
+	OutputFieldKubeconfig = "kubeconfig"
+
+	// OutputFieldClusterCACertificate is the PEM or base64 encoded CA certificate of the API server,
+	// used to generate the kubeconfig and published in the Cluster's CA Secret
+	OutputFieldClusterCACertificate = "clusterCACertificate"
+
+	// OutputFieldToken is the bearer token used to generate the kubeconfig
+	OutputFieldToken = "token"
+
+	// OutputFieldTokenExpiry is the RFC 3339 time at which the token expires
+	OutputFieldTokenExpiry = "tokenExpiry"
+
+	// OutputFieldProviderIDList sets spec.providerIDList of a TFCManagedMachinePool
+	OutputFieldProviderIDList = "providerIDList"
+
+	// OutputFieldReplicas sets status.replicas of a TFCManagedMachinePool
+	OutputFieldReplicas = "replicas"
+
+	// OutputFieldInstances lists the instances of a TFCManagedMachinePool used to create TFCManagedMachinePoolMachines
+	OutputFieldInstances = "instances"
+)
+
+// OutputType is the expected type of a Terraform output value
+// +kubebuilder:validation:Enum=string;number;bool;list;object
+type OutputType string
+
+const (
+	OutputTypeString OutputType = "string"
+	OutputTypeNumber OutputType = "number"
+	OutputTypeBool   OutputType = "bool"
+	OutputTypeList   OutputType = "list"
+	OutputTypeObject OutputType = "object"
+)
+
+// OutputMapping maps an output of the Terraform module to a destination. Exactly one of
+// field, secretKey, configMapKey and clusterAnnotation must be set.
+type OutputMapping struct {
+	// Name is the name of the module output
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z_][a-zA-Z0-9_-]*$`
+	Name string `json:"name"`
+
+	// Type is the expected type of the output value. Outputs of any other type are reported as an error.
+	// +optional
+	Type OutputType `json:"type,omitempty"`
+
+	// Sensitive marks the output as sensitive in the generated configuration
+	// +optional
+	Sensitive bool `json:"sensitive,omitempty"`
+
+	// Field is the well-known field populated with the output value
+	// +kubebuilder:validation:Enum=controlPlaneEndpoint.host;controlPlaneEndpoint.port;kubeconfig;clusterCACertificate;token;tokenExpiry;providerIDList;replicas;instances
+	// +optional
+	Field string `json:"field,omitempty"`
+
+	// SecretKey is the key the value is written to in the `<name>-outputs` Secret
+	// +optional
+	SecretKey string `json:"secretKey,omitempty"`
+
+	// ConfigMapKey is the key the value is written to in the `<name>-outputs` ConfigMap
+	// +optional
+	ConfigMapKey string `json:"configMapKey,omitempty"`
+
+	// ClusterAnnotation is the annotation the value is written to on the owner Cluster
+	// +optional
+	ClusterAnnotation string `json:"clusterAnnotation,omitempty"`
+}
+
+// withDefaultOutputs returns the mappings followed by the default mapping of each
+// well-known field that is not already mapped
+func withDefaultOutputs(mappings []OutputMapping, defaults []OutputMapping) []OutputMapping {
+	mapped := map[string]bool{}
+	for _, m := range mappings {
+		if m.Field != "" {
+			mapped[m.Field] = true
+		}
+	}
+	outputs := append([]OutputMapping{}, mappings...)
+	for _, d := range defaults {
+		if !mapped[d.Field] {
+			outputs = append(outputs, d)
+		}
+	}
+	return outputs
+}
+
+// GetOutputs returns the output mappings of the control plane, including the default
+// mappings of the endpoint outputs and of either the kubeconfig output or, when the
+// kubeconfig is generated, the CA certificate and token outputs
+func (s *TFCManagedControlPlaneSpec) GetOutputs() []OutputMapping {
+	defaults := []OutputMapping{
+		{Name: "control_plane_endpoint_host", Field: OutputFieldControlPlaneEndpointHost},
+		{Name: "control_plane_endpoint_port", Field: OutputFieldControlPlaneEndpointPort},
+	}
+	if s.Kubeconfig.Generate {
+		defaults = append(defaults,
+			OutputMapping{Name: "cluster_ca_certificate", Field: OutputFieldClusterCACertificate},
+			OutputMapping{Name: "token", Field: OutputFieldToken, Sensitive: true},
+		)
+	} else {
+		defaults = append(defaults, OutputMapping{Name: "kubeconfig", Field: OutputFieldKubeconfig, Sensitive: true})
+	}
+	return withDefaultOutputs(s.Outputs, defaults)
+}
+
+// GetOutputs returns the output mappings of the machine pool, including the default
+// mappings of the provider ID list and instances outputs
+func (s *TFCManagedMachinePoolSpec) GetOutputs() []OutputMapping {
+	defaults := []OutputMapping{
+		{Name: "provider_id_list", Field: OutputFieldProviderIDList},
+	}
+	if s.MachinePoolMachines {
+		defaults = append(defaults, OutputMapping{Name: "instances", Field: OutputFieldInstances})
+	}
+	return withDefaultOutputs(s.Outputs, defaults)
+}
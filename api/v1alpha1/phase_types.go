@@ -0,0 +1,91 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Phase is the step a TFCManagedControlPlane or TFCManagedMachinePool has reached in being reconciled
+// +kubebuilder:validation:Enum=Pending;Uploading;Planning;AwaitingApproval;Applying;Provisioned;Deleting;Failed
+type Phase string
+
+const (
+	// PhasePending is the phase of a resource that has not been reconciled yet
+	PhasePending Phase = "Pending"
+
+	// PhaseUploading is the phase while the configuration is uploaded and processed
+	PhaseUploading Phase = "Uploading"
+
+	// PhasePlanning is the phase while a speculative plan is reviewed before a version upgrade
+	PhasePlanning Phase = "Planning"
+
+	// PhaseAwaitingApproval is the phase while the run waits to be confirmed in Terraform Cloud
+	PhaseAwaitingApproval Phase = "AwaitingApproval"
+
+	// PhaseApplying is the phase while a run is queued, planning or applying
+	PhaseApplying Phase = "Applying"
+
+	// PhaseProvisioned is the phase once the run has finished and its outputs are reconciled
+	PhaseProvisioned Phase = "Provisioned"
+
+	// PhaseDeleting is the phase once the resource is deleted and its resources are destroyed
+	PhaseDeleting Phase = "Deleting"
+
+	// PhaseFailed is the phase after the resource could not be reconciled, until its spec
+	// or configuration changes
+	PhaseFailed Phase = "Failed"
+)
+
+// PhaseTransition records when a phase was entered
+type PhaseTransition struct {
+	Phase Phase `json:"phase"`
+
+	// LastTransitionTime is when the phase was entered
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+}
+
+// PhaseStatus reports the phase of a resource
+type PhaseStatus struct {
+	// Phase is the step the resource has reached in being reconciled
+	// +optional
+	Phase Phase `json:"phase,omitempty"`
+
+	// PhaseTransitions lists the most recently entered phases, oldest first
+	// +optional
+	PhaseTransitions []PhaseTransition `json:"phaseTransitions,omitempty"`
+}
+
+// GetPhaseStatus returns the phase of the control plane
+func (c *TFCManagedControlPlane) GetPhaseStatus() *PhaseStatus {
+	return &c.Status.PhaseStatus
+}
+
+// GetPhaseStatus returns the phase of the machine pool
+func (m *TFCManagedMachinePool) GetPhaseStatus() *PhaseStatus {
+	return &m.Status.PhaseStatus
+}
+
+// GetTerraformStatus returns the status of the Terraform runs of the control plane
+func (c *TFCManagedControlPlane) GetTerraformStatus() *TerraformStatus {
+	return &c.Status.Terraform
+}
+
+// GetTerraformStatus returns the status of the Terraform runs of the machine pool
+func (m *TFCManagedMachinePool) GetTerraformStatus() *TerraformStatus {
+	return &m.Status.Terraform
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// TemplateReference refers to a ConfigMap holding the Terraform configuration to upload instead
+// of the generated module call. Keys ending in .tmpl are rendered as Go templates and written
+// without the suffix; other keys are uploaded as they are.
+type TemplateReference struct {
+	// Name is the name of the ConfigMap in the namespace of the resource
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// GetTemplateRef returns the reference to the configuration templates, if any
+func (c *TFCManagedControlPlane) GetTemplateRef() *TemplateReference {
+	return c.Spec.TemplateRef
+}
+
+// GetTemplateRef returns the reference to the configuration templates, if any
+func (m *TFCManagedMachinePool) GetTemplateRef() *TemplateReference {
+	return m.Spec.TemplateRef
+}
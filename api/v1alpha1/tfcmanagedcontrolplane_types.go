@@ -17,6 +17,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
@@ -36,6 +38,7 @@ type TerraformModule struct {
 // Variable is a Terraform Variable
 type Variable struct {
 	// Name is the name of the variable
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z_][a-zA-Z0-9_-]*$`
 	Name string `json:"name"`
 
 	// TODO: sensitive
@@ -50,30 +53,121 @@ type Token struct {
 
 // TFCManagedControlPlaneSpec defines the desired state of TFCManagedControlPlane
 type TFCManagedControlPlaneSpec struct {
-	// Organization is the name of the Terraform Cloud organization to use
-	Organization string `json:"organization"`
+	// Organization is the name of the Terraform Cloud organization to use.
+	// It is required unless the local backend is used.
+	// +optional
+	Organization string `json:"organization,omitempty"`
 
-	// Workspace is the name of the Terraform Cloud Workspace to execute the terraform run in
+	// Workspace is the name of the Terraform Cloud Workspace to execute the terraform run in.
+	// With the local backend, it names the Secret state is stored in.
 	// TODO: change this to a struct that supports ID or name
 	Workspace string `json:"workspace"`
 
 	// Token is the API token for accessing Terraform Cloud
-	Token Token `json:"token"`
+	// +optional
+	Token Token `json:"token,omitempty"`
+
+	// Backend selects where Terraform runs are executed. Defaults to Terraform Cloud.
+	// +optional
+	Backend Backend `json:"backend,omitempty"`
 
-	// Module is the Terraform module to use for provisioning the Kubernetes Cluster
-	Module TerraformModule `json:"module"`
+	// Module is the Terraform module to use for provisioning the Kubernetes Cluster.
+	// It is required unless templateRef is set.
+	// +optional
+	Module TerraformModule `json:"module,omitempty"`
 
 	// Version is the Kubernetes cluster version to provision
 	Version string `json:"version"`
 
-	// AutoApply configures if plans should be applied straight away or manually approved in the Terraform Cloud UI
+	// AutoApply configures if plans should be applied straight away or manually approved in the Terraform Cloud UI.
+	// Runs of the local backend, and destroy runs queued when the resource is deleted, are always applied.
 	AutoApply bool `json:"autoApply"`
 
 	// Variables is the list of variables to supply to the Terraform module which creates the Kubernetes Cluster
 	Variables []Variable `json:"variables"`
 
+	// TemplateRef refers to a ConfigMap of configuration templates that is rendered and uploaded
+	// instead of the generated call to the module
+	// +optional
+	TemplateRef *TemplateReference `json:"templateRef,omitempty"`
+
+	// ExtraFiles are uploaded alongside the generated or rendered configuration
+	// +optional
+	ExtraFiles []ExtraFile `json:"extraFiles,omitempty"`
+
+	// RevisionHistoryLimit is the number of uploaded configuration revisions kept in ConfigMaps
+	// for auditing. Defaults to 10.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// Outputs maps outputs of the Terraform module to fields, Secrets, ConfigMaps or Cluster
+	// annotations. Well-known fields that are not mapped are read from the outputs named
+	// control_plane_endpoint_host, control_plane_endpoint_port and kubeconfig.
+	// +optional
+	Outputs []OutputMapping `json:"outputs,omitempty"`
+
 	// ControlPlaneEndpoint is the endpoint for the control plane
 	ControlPlaneEndpoint clusterv1beta1.APIEndpoint `json:"controlPlaneEndpoint,omitempty"`
+
+	// Kubeconfig configures how the kubeconfig of the workload cluster is obtained
+	// +optional
+	Kubeconfig KubeconfigSpec `json:"kubeconfig,omitempty"`
+
+	// ReadinessCheck configures how the workload cluster API server is probed after Terraform has applied
+	// +optional
+	ReadinessCheck ReadinessCheck `json:"readinessCheck,omitempty"`
+
+	// ClusterAnnotations are the keys of the owner Cluster's annotations passed to the module in the
+	// cluster_annotations input. Other annotations, and those written from the control plane's
+	// outputs, are not passed.
+	// +optional
+	ClusterAnnotations []string `json:"clusterAnnotations,omitempty"`
+}
+
+// KubeconfigSpec configures how the kubeconfig of the workload cluster is obtained
+type KubeconfigSpec struct {
+	// Generate assembles the kubeconfig from the control plane endpoint and the outputs mapped to the
+	// clusterCACertificate and token fields, instead of reading it from a kubeconfig output
+	// +optional
+	Generate bool `json:"generate,omitempty"`
+
+	// TokenTTL is how long a generated token is valid for after the run that produced it has applied.
+	// It is ignored when an output is mapped to the tokenExpiry field. Tokens are not refreshed if neither is set.
+	// +optional
+	TokenTTL *metav1.Duration `json:"tokenTTL,omitempty"`
+
+	// RefreshBefore is how long before the token expires a refresh-only run is triggered to renew it. Defaults to 10m.
+	// It must be shorter than tokenTTL.
+	// +optional
+	RefreshBefore *metav1.Duration `json:"refreshBefore,omitempty"`
+}
+
+// DefaultTokenRefreshBefore is how long before a generated token expires it is refreshed by default
+const DefaultTokenRefreshBefore = 10 * time.Minute
+
+// GetRefreshBefore returns how long before the token expires it is refreshed
+func (s *KubeconfigSpec) GetRefreshBefore() time.Duration {
+	if s.RefreshBefore != nil {
+		return s.RefreshBefore.Duration
+	}
+	return DefaultTokenRefreshBefore
+}
+
+// ReadinessCheck configures probing of the workload cluster API server
+type ReadinessCheck struct {
+	// Disabled skips probing the API server and marks the control plane ready as soon as Terraform has applied
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	// RequestTimeout is the timeout for each request made to the API server. Defaults to 10s.
+	// +optional
+	RequestTimeout *metav1.Duration `json:"requestTimeout,omitempty"`
+
+	// Timeout is how long to keep probing after Terraform has applied before the
+	// failure is reported as an error. Defaults to 10m.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
 }
 
 // TFCManagedControlPlaneStatus defines the observed state of TFCManagedControlPlane
@@ -82,6 +176,20 @@ type TFCManagedControlPlaneStatus struct {
 	Ready       bool            `json:"ready"`
 	Initialized bool            `json:"initialized"`
 	Terraform   TerraformStatus `json:"terraform,omitempty"`
+
+	// TokenExpiresAt is when the token in the generated kubeconfig expires
+	// +optional
+	TokenExpiresAt *metav1.Time `json:"tokenExpiresAt,omitempty"`
+
+	// Version is the Kubernetes version reported by the workload cluster API server
+	// +optional
+	Version *string `json:"version,omitempty"`
+
+	PhaseStatus `json:",inline"`
+
+	// Conditions defines current service state of the TFCManagedControlPlane
+	// +optional
+	Conditions clusterv1beta1.Conditions `json:"conditions,omitempty"`
 }
 
 // TerraformStatus defines status information about the terraform workspace
@@ -93,16 +201,93 @@ type TerraformStatus struct {
 	RunFinishedAt          metav1.Time `json:"runFinishedAt,omitempty"`
 	ConfigurationVersionID string      `json:"configurationVersionID,omitempty"`
 	ConfigurationHash      string      `json:"configurationHash,omitempty"`
+
+	// ConfigurationHashes are the hashes of the inputs ConfigurationHash was computed from
+	// +optional
+	ConfigurationHashes ConfigurationHashes `json:"configurationHashes,omitempty"`
+
+	// ConfigurationRevision is the revision of the configuration stored for ConfigurationVersionID
+	// +optional
+	ConfigurationRevision int64 `json:"configurationRevision,omitempty"`
+
+	// ConfigurationHistory lists the most recently uploaded configuration versions, oldest first,
+	// which the rollback annotation can refer to
+	// +optional
+	ConfigurationHistory []ConfigurationHistoryEntry `json:"configurationHistory,omitempty"`
+
+	// StateVersionID is the ID of the state version produced by the run that outputs are read from
+	// +optional
+	StateVersionID string `json:"stateVersionID,omitempty"`
+
+	// ClusterAnnotations are the annotations of the owner Cluster written from outputs. Those
+	// that are no longer mapped are removed from the Cluster.
+	// +optional
+	ClusterAnnotations []string `json:"clusterAnnotations,omitempty"`
+
+	// PlanRunID is the ID of the speculative plan run used to review a version upgrade
+	// +optional
+	PlanRunID string `json:"planRunID,omitempty"`
+
+	// Workspace is the Terraform Cloud workspace WorkspaceID was looked up for, as organization/name
+	// +optional
+	Workspace string `json:"workspace,omitempty"`
+
+	// WorkspaceID is the ID of the Terraform Cloud workspace, cached so that it is not looked up
+	// by name on every reconcile
+	// +optional
+	WorkspaceID string `json:"workspaceID,omitempty"`
+}
+
+// RollbackAnnotation pins the configuration version, given as the revision or the ID of an entry of
+// status.terraform.configurationHistory, that runs use instead of the configuration produced from the spec
+const RollbackAnnotation = "infrastructure.cluster.x-k8s.io/rollback-to"
+
+// ConfigurationHistoryEntry records an uploaded configuration version
+type ConfigurationHistoryEntry struct {
+	// Revision is the revision of the configuration stored in a ConfigMap, if any
+	// +optional
+	Revision int64 `json:"revision,omitempty"`
+
+	// ConfigurationVersionID is the ID of the configuration version
+	ConfigurationVersionID string `json:"configurationVersionID"`
+
+	// ConfigurationHash is the hash of the configuration
+	ConfigurationHash string `json:"configurationHash"`
+
+	// ConfigurationHashes are the hashes of the inputs of the configuration
+	// +optional
+	ConfigurationHashes ConfigurationHashes `json:"configurationHashes,omitempty"`
+
+	// UploadedAt is when the configuration version was uploaded
+	UploadedAt metav1.Time `json:"uploadedAt"`
+}
+
+// ConfigurationHashes are the SHA-256 hashes of the inputs of a configuration version, so that
+// the input that caused a new configuration version to be uploaded can be identified
+type ConfigurationHashes struct {
+	// Configuration is the hash of the generated or rendered configuration files
+	// +optional
+	Configuration string `json:"configuration,omitempty"`
+
+	// ExtraFiles is the hash of the extra files
+	// +optional
+	ExtraFiles string `json:"extraFiles,omitempty"`
+
+	// Variables is the hash of the variables of the workspace and the variable sets applied to it
+	// +optional
+	Variables string `json:"variables,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.spec.version`
+//+kubebuilder:printcolumn:name="Current Version",type=string,JSONPath=`.status.version`
 //+kubebuilder:printcolumn:name="Organization",type=string,JSONPath=`.spec.workspace`
 //+kubebuilder:printcolumn:name="Workspace",type=string,JSONPath=`.spec.organization`
 //+kubebuilder:printcolumn:name="Module",type=string,JSONPath=`.spec.module.source`
 //+kubebuilder:printcolumn:name="Module Version",type=string,JSONPath=`.spec.module.version`
 //+kubebuilder:printcolumn:name="Run Status",type=string,JSONPath=`.status.terraform.runStatus`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
 
 // TFCManagedControlPlane is the Schema for the tfcmanagedcontrolplanes API
 type TFCManagedControlPlane struct {
@@ -113,6 +298,16 @@ type TFCManagedControlPlane struct {
 	Status TFCManagedControlPlaneStatus `json:"status,omitempty"`
 }
 
+// GetConditions returns the conditions of the TFCManagedControlPlane
+func (c *TFCManagedControlPlane) GetConditions() clusterv1beta1.Conditions {
+	return c.Status.Conditions
+}
+
+// SetConditions sets the conditions of the TFCManagedControlPlane
+func (c *TFCManagedControlPlane) SetConditions(conditions clusterv1beta1.Conditions) {
+	c.Status.Conditions = conditions
+}
+
 //+kubebuilder:object:root=true
 
 // TFCManagedControlPlaneList contains a list of TFCManagedControlPlane
@@ -18,6 +18,8 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -25,42 +27,158 @@ import (
 
 // TFCManagedMachinePoolSpec defines the desired state of TFCManagedMachinePool
 type TFCManagedMachinePoolSpec struct {
-	// Organization is the name of the Terraform Cloud organization to use
-	Organization string `json:"organization"`
+	// Organization is the name of the Terraform Cloud organization to use.
+	// It is required unless the local backend is used.
+	// +optional
+	Organization string `json:"organization,omitempty"`
 
-	// Workspace is the name of the Terraform Cloud Workspace to execute the terraform run in
+	// Workspace is the name of the Terraform Cloud Workspace to execute the terraform run in.
+	// With the local backend, it names the Secret state is stored in.
 	// TODO: change this to a struct that supports ID or name
 	Workspace string `json:"workspace"`
 
 	// Token is the API token for accessing Terraform Cloud
-	Token Token `json:"token"`
+	// +optional
+	Token Token `json:"token,omitempty"`
 
-	// Module is the Terraform module to use for provisioning the Kubernetes Cluster
-	Module TerraformModule `json:"module"`
+	// Backend selects where Terraform runs are executed. Defaults to Terraform Cloud.
+	// +optional
+	Backend Backend `json:"backend,omitempty"`
 
-	// AutoApply configures if plans should be applied straight away or manually approved in the Terraform Cloud UI
+	// Module is the Terraform module to use for provisioning the Kubernetes Cluster.
+	// It is required unless templateRef is set.
+	// +optional
+	Module TerraformModule `json:"module,omitempty"`
+
+	// AutoApply configures if plans should be applied straight away or manually approved in the Terraform Cloud UI.
+	// Runs of the local backend, and destroy runs queued when the resource is deleted, are always applied.
 	AutoApply bool `json:"autoApply"`
 
 	// Variables is the list of variables to supply to the Terraform module which creates the Kubernetes Cluster
 	Variables []Variable `json:"variables"`
 
+	// TemplateRef refers to a ConfigMap of configuration templates that is rendered and uploaded
+	// instead of the generated call to the module
+	// +optional
+	TemplateRef *TemplateReference `json:"templateRef,omitempty"`
+
+	// ExtraFiles are uploaded alongside the generated or rendered configuration
+	// +optional
+	ExtraFiles []ExtraFile `json:"extraFiles,omitempty"`
+
+	// RevisionHistoryLimit is the number of uploaded configuration revisions kept in ConfigMaps
+	// for auditing. Defaults to 10.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// Outputs maps outputs of the Terraform module to fields, Secrets, ConfigMaps or Cluster
+	// annotations. Well-known fields that are not mapped are read from the outputs named
+	// provider_id_list (and instances when machinePoolMachines is set).
+	// +optional
+	Outputs []OutputMapping `json:"outputs,omitempty"`
+
 	// ProviderIDList is a list of cloud provider IDs identifying the instances.
 	ProviderIDList []string `json:"providerIDList,omitempty"`
+
+	// Replicas is the desired number of instances, exposed through the scale subresource.
+	// It mirrors the replicas of the owning MachinePool, and a scale of the
+	// TFCManagedMachinePool is written through to the MachinePool.
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// ManagedAutoscaling declares that the Terraform module sizes the pool itself using
+	// the cloud provider's native autoscaler. When set, the replica count of the owning
+	// MachinePool is not passed to the module and changing it does not trigger a new run.
+	// +optional
+	ManagedAutoscaling bool `json:"managedAutoscaling,omitempty"`
+
+	// MachinePoolMachines enables the creation of a TFCManagedMachinePoolMachine for each
+	// instance reported in the module's `instances` output. Cluster API v1.2 does not create
+	// Machines for them, so they are only used to inspect instances and to replace or remove
+	// them individually.
+	// +optional
+	MachinePoolMachines bool `json:"machinePoolMachines,omitempty"`
 }
 
 // TFCManagedMachinePoolStatus defines the observed state of TFCManagedMachinePool
 type TFCManagedMachinePoolStatus struct {
-	Ready     bool            `json:"ready,omitempty"`
+	Ready bool `json:"ready,omitempty"`
+
+	// Replicas is the most recently observed number of replicas provisioned by Terraform.
+	// It is always serialized, because the MachinePool controller keeps its previous count
+	// when the field is missing, so a pool scaled to zero would never report it.
+	// +optional
+	Replicas int32 `json:"replicas"`
+
+	// ReadyReplicas is the number of instances that have joined the workload cluster as Ready Nodes
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas"`
+
+	// UnreadyReplicas is the number of instances that have not yet joined the workload
+	// cluster or whose Node is not Ready
+	// +optional
+	UnreadyReplicas int32 `json:"unreadyReplicas"`
+
+	// Selector is the label selector, in string form, of the TFCManagedMachinePoolMachines
+	// of the pool. It is exposed through the scale subresource.
+	// +optional
+	Selector string `json:"selector,omitempty"`
+
+	// SyncedReplicas is the value of spec.replicas last synced with the owning MachinePool.
+	// It tells a scale of the TFCManagedMachinePool apart from a scale of the MachinePool.
+	// +optional
+	SyncedReplicas *int32 `json:"syncedReplicas,omitempty"`
+
+	// FailureReason will be set in the event that there is a terminal problem
+	// reconciling the MachinePool and will contain a succinct value suitable
+	// for machine interpretation.
+	// +optional
+	FailureReason *capierrors.MachineStatusError `json:"failureReason,omitempty"`
+
+	// FailureMessage will be set in the event that there is a terminal problem
+	// reconciling the MachinePool and will contain a more verbose string suitable
+	// for logging and human consumption.
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+
+	// InfrastructureMachineKind is the kind of the infrastructure resources created
+	// for each instance in the pool. It is not read by Cluster API v1.2, which has no
+	// MachinePool Machines.
+	// +optional
+	InfrastructureMachineKind string `json:"infrastructureMachineKind,omitempty"`
+
+	// DeletedMachines are the names of the deleted TFCManagedMachinePoolMachines whose
+	// instances are replaced or removed by the current run. They are released once the
+	// run has been applied.
+	// +optional
+	DeletedMachines []string `json:"deletedMachines,omitempty"`
+
+	// Version is the Kubernetes version passed to the Terraform module. It follows the
+	// version of the control plane once its upgrade has completed.
+	// +optional
+	Version string `json:"version,omitempty"`
+
 	Terraform TerraformStatus `json:"terraform,omitempty"`
+
+	PhaseStatus `json:",inline"`
+
+	// Conditions defines current service state of the TFCManagedMachinePool
+	// +optional
+	Conditions clusterv1beta1.Conditions `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.selector
 //+kubebuilder:printcolumn:name="Organization",type=string,JSONPath=`.spec.workspace`
 //+kubebuilder:printcolumn:name="Workspace",type=string,JSONPath=`.spec.organization`
 //+kubebuilder:printcolumn:name="Module",type=string,JSONPath=`.spec.module.source`
 //+kubebuilder:printcolumn:name="Module Version",type=string,JSONPath=`.spec.module.version`
+//+kubebuilder:printcolumn:name="Replicas",type=integer,JSONPath=`.status.replicas`
+//+kubebuilder:printcolumn:name="Ready Replicas",type=integer,JSONPath=`.status.readyReplicas`
 //+kubebuilder:printcolumn:name="Run Status",type=string,JSONPath=`.status.terraform.runStatus`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
 
 // TFCManagedMachinePool is the Schema for the tfcmanagedmachinepools API
 type TFCManagedMachinePool struct {
@@ -71,6 +189,16 @@ type TFCManagedMachinePool struct {
 	Status TFCManagedMachinePoolStatus `json:"status,omitempty"`
 }
 
+// GetConditions returns the conditions of the TFCManagedMachinePool
+func (m *TFCManagedMachinePool) GetConditions() clusterv1beta1.Conditions {
+	return m.Status.Conditions
+}
+
+// SetConditions sets the conditions of the TFCManagedMachinePool
+func (m *TFCManagedMachinePool) SetConditions(conditions clusterv1beta1.Conditions) {
+	m.Status.Conditions = conditions
+}
+
 //+kubebuilder:object:root=true
 
 // TFCManagedMachinePoolList contains a list of TFCManagedMachinePool
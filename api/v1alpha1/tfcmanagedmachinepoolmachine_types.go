@@ -0,0 +1,83 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+
+// TFCManagedMachinePoolMachineSpec defines the desired state of TFCManagedMachinePoolMachine
+type TFCManagedMachinePoolMachineSpec struct {
+	// InstanceID is the identifier of the instance reported by the Terraform module
+	InstanceID string `json:"instanceID"`
+
+	// ProviderID is the cloud provider ID identifying the instance
+	// +optional
+	ProviderID string `json:"providerID,omitempty"`
+}
+
+// TFCManagedMachinePoolMachineStatus defines the observed state of TFCManagedMachinePoolMachine
+type TFCManagedMachinePoolMachineStatus struct {
+	// Ready is true when the instance is reported by the latest applied Terraform run
+	// +optional
+	Ready bool `json:"ready"`
+
+	// Zone is the availability zone the instance is running in
+	// +optional
+	Zone string `json:"zone,omitempty"`
+
+	// Addresses are the addresses assigned to the instance
+	// +optional
+	Addresses clusterv1beta1.MachineAddresses `json:"addresses,omitempty"`
+
+	// ResourceAddress is the Terraform resource address of the instance. When set, deleting
+	// this object triggers a run that replaces the instance.
+	// +optional
+	ResourceAddress string `json:"resourceAddress,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Instance",type=string,JSONPath=`.spec.instanceID`
+//+kubebuilder:printcolumn:name="Provider ID",type=string,JSONPath=`.spec.providerID`
+//+kubebuilder:printcolumn:name="Zone",type=string,JSONPath=`.status.zone`
+//+kubebuilder:printcolumn:name="Ready",type=boolean,JSONPath=`.status.ready`
+
+// TFCManagedMachinePoolMachine is the Schema for the tfcmanagedmachinepoolmachines API
+type TFCManagedMachinePoolMachine struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TFCManagedMachinePoolMachineSpec   `json:"spec,omitempty"`
+	Status TFCManagedMachinePoolMachineStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// TFCManagedMachinePoolMachineList contains a list of TFCManagedMachinePoolMachine
+type TFCManagedMachinePoolMachineList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TFCManagedMachinePoolMachine `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TFCManagedMachinePoolMachine{}, &TFCManagedMachinePoolMachineList{})
+}
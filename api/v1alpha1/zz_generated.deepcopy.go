@@ -23,9 +23,220 @@ package v1alpha1
 
 import (
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/errors"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Backend) DeepCopyInto(out *Backend) {
+	*out = *in
+	if in.Local != nil {
+		in, out := &in.Local, &out.Local
+		*out = new(LocalBackendSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Backend.
+func (in *Backend) DeepCopy() *Backend {
+	if in == nil {
+		return nil
+	}
+	out := new(Backend)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigurationHashes) DeepCopyInto(out *ConfigurationHashes) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigurationHashes.
+func (in *ConfigurationHashes) DeepCopy() *ConfigurationHashes {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigurationHashes)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigurationHistoryEntry) DeepCopyInto(out *ConfigurationHistoryEntry) {
+	*out = *in
+	out.ConfigurationHashes = in.ConfigurationHashes
+	in.UploadedAt.DeepCopyInto(&out.UploadedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigurationHistoryEntry.
+func (in *ConfigurationHistoryEntry) DeepCopy() *ConfigurationHistoryEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigurationHistoryEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExtraFile) DeepCopyInto(out *ExtraFile) {
+	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(v1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExtraFile.
+func (in *ExtraFile) DeepCopy() *ExtraFile {
+	if in == nil {
+		return nil
+	}
+	out := new(ExtraFile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeconfigSpec) DeepCopyInto(out *KubeconfigSpec) {
+	*out = *in
+	if in.TokenTTL != nil {
+		in, out := &in.TokenTTL, &out.TokenTTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.RefreshBefore != nil {
+		in, out := &in.RefreshBefore, &out.RefreshBefore
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeconfigSpec.
+func (in *KubeconfigSpec) DeepCopy() *KubeconfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeconfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalBackendSpec) DeepCopyInto(out *LocalBackendSpec) {
+	*out = *in
+	if in.VariablesSecretRef != nil {
+		in, out := &in.VariablesSecretRef, &out.VariablesSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]v1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalBackendSpec.
+func (in *LocalBackendSpec) DeepCopy() *LocalBackendSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LocalBackendSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutputMapping) DeepCopyInto(out *OutputMapping) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutputMapping.
+func (in *OutputMapping) DeepCopy() *OutputMapping {
+	if in == nil {
+		return nil
+	}
+	out := new(OutputMapping)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PhaseStatus) DeepCopyInto(out *PhaseStatus) {
+	*out = *in
+	if in.PhaseTransitions != nil {
+		in, out := &in.PhaseTransitions, &out.PhaseTransitions
+		*out = make([]PhaseTransition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhaseStatus.
+func (in *PhaseStatus) DeepCopy() *PhaseStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PhaseStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PhaseTransition) DeepCopyInto(out *PhaseTransition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhaseTransition.
+func (in *PhaseTransition) DeepCopy() *PhaseTransition {
+	if in == nil {
+		return nil
+	}
+	out := new(PhaseTransition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReadinessCheck) DeepCopyInto(out *ReadinessCheck) {
+	*out = *in
+	if in.RequestTimeout != nil {
+		in, out := &in.RequestTimeout, &out.RequestTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReadinessCheck.
+func (in *ReadinessCheck) DeepCopy() *ReadinessCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(ReadinessCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TFCManagedControlPlane) DeepCopyInto(out *TFCManagedControlPlane) {
 	*out = *in
@@ -89,13 +300,43 @@ func (in *TFCManagedControlPlaneList) DeepCopyObject() runtime.Object {
 func (in *TFCManagedControlPlaneSpec) DeepCopyInto(out *TFCManagedControlPlaneSpec) {
 	*out = *in
 	in.Token.DeepCopyInto(&out.Token)
+	in.Backend.DeepCopyInto(&out.Backend)
 	out.Module = in.Module
 	if in.Variables != nil {
 		in, out := &in.Variables, &out.Variables
 		*out = make([]Variable, len(*in))
 		copy(*out, *in)
 	}
+	if in.TemplateRef != nil {
+		in, out := &in.TemplateRef, &out.TemplateRef
+		*out = new(TemplateReference)
+		**out = **in
+	}
+	if in.ExtraFiles != nil {
+		in, out := &in.ExtraFiles, &out.ExtraFiles
+		*out = make([]ExtraFile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Outputs != nil {
+		in, out := &in.Outputs, &out.Outputs
+		*out = make([]OutputMapping, len(*in))
+		copy(*out, *in)
+	}
 	out.ControlPlaneEndpoint = in.ControlPlaneEndpoint
+	in.Kubeconfig.DeepCopyInto(&out.Kubeconfig)
+	in.ReadinessCheck.DeepCopyInto(&out.ReadinessCheck)
+	if in.ClusterAnnotations != nil {
+		in, out := &in.ClusterAnnotations, &out.ClusterAnnotations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TFCManagedControlPlaneSpec.
@@ -112,6 +353,23 @@ func (in *TFCManagedControlPlaneSpec) DeepCopy() *TFCManagedControlPlaneSpec {
 func (in *TFCManagedControlPlaneStatus) DeepCopyInto(out *TFCManagedControlPlaneStatus) {
 	*out = *in
 	in.Terraform.DeepCopyInto(&out.Terraform)
+	if in.TokenExpiresAt != nil {
+		in, out := &in.TokenExpiresAt, &out.TokenExpiresAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Version != nil {
+		in, out := &in.Version, &out.Version
+		*out = new(string)
+		**out = **in
+	}
+	in.PhaseStatus.DeepCopyInto(&out.PhaseStatus)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(v1beta1.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TFCManagedControlPlaneStatus.
@@ -183,21 +441,143 @@ func (in *TFCManagedMachinePoolList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TFCManagedMachinePoolMachine) DeepCopyInto(out *TFCManagedMachinePoolMachine) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TFCManagedMachinePoolMachine.
+func (in *TFCManagedMachinePoolMachine) DeepCopy() *TFCManagedMachinePoolMachine {
+	if in == nil {
+		return nil
+	}
+	out := new(TFCManagedMachinePoolMachine)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TFCManagedMachinePoolMachine) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TFCManagedMachinePoolMachineList) DeepCopyInto(out *TFCManagedMachinePoolMachineList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]TFCManagedMachinePoolMachine, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TFCManagedMachinePoolMachineList.
+func (in *TFCManagedMachinePoolMachineList) DeepCopy() *TFCManagedMachinePoolMachineList {
+	if in == nil {
+		return nil
+	}
+	out := new(TFCManagedMachinePoolMachineList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TFCManagedMachinePoolMachineList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TFCManagedMachinePoolMachineSpec) DeepCopyInto(out *TFCManagedMachinePoolMachineSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TFCManagedMachinePoolMachineSpec.
+func (in *TFCManagedMachinePoolMachineSpec) DeepCopy() *TFCManagedMachinePoolMachineSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TFCManagedMachinePoolMachineSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TFCManagedMachinePoolMachineStatus) DeepCopyInto(out *TFCManagedMachinePoolMachineStatus) {
+	*out = *in
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make(v1beta1.MachineAddresses, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TFCManagedMachinePoolMachineStatus.
+func (in *TFCManagedMachinePoolMachineStatus) DeepCopy() *TFCManagedMachinePoolMachineStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TFCManagedMachinePoolMachineStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TFCManagedMachinePoolSpec) DeepCopyInto(out *TFCManagedMachinePoolSpec) {
 	*out = *in
 	in.Token.DeepCopyInto(&out.Token)
+	in.Backend.DeepCopyInto(&out.Backend)
 	out.Module = in.Module
 	if in.Variables != nil {
 		in, out := &in.Variables, &out.Variables
 		*out = make([]Variable, len(*in))
 		copy(*out, *in)
 	}
+	if in.TemplateRef != nil {
+		in, out := &in.TemplateRef, &out.TemplateRef
+		*out = new(TemplateReference)
+		**out = **in
+	}
+	if in.ExtraFiles != nil {
+		in, out := &in.ExtraFiles, &out.ExtraFiles
+		*out = make([]ExtraFile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Outputs != nil {
+		in, out := &in.Outputs, &out.Outputs
+		*out = make([]OutputMapping, len(*in))
+		copy(*out, *in)
+	}
 	if in.ProviderIDList != nil {
 		in, out := &in.ProviderIDList, &out.ProviderIDList
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TFCManagedMachinePoolSpec.
@@ -213,7 +593,35 @@ func (in *TFCManagedMachinePoolSpec) DeepCopy() *TFCManagedMachinePoolSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TFCManagedMachinePoolStatus) DeepCopyInto(out *TFCManagedMachinePoolStatus) {
 	*out = *in
+	if in.SyncedReplicas != nil {
+		in, out := &in.SyncedReplicas, &out.SyncedReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailureReason != nil {
+		in, out := &in.FailureReason, &out.FailureReason
+		*out = new(errors.MachineStatusError)
+		**out = **in
+	}
+	if in.FailureMessage != nil {
+		in, out := &in.FailureMessage, &out.FailureMessage
+		*out = new(string)
+		**out = **in
+	}
+	if in.DeletedMachines != nil {
+		in, out := &in.DeletedMachines, &out.DeletedMachines
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	in.Terraform.DeepCopyInto(&out.Terraform)
+	in.PhaseStatus.DeepCopyInto(&out.PhaseStatus)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(v1beta1.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TFCManagedMachinePoolStatus.
@@ -226,6 +634,21 @@ func (in *TFCManagedMachinePoolStatus) DeepCopy() *TFCManagedMachinePoolStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateReference) DeepCopyInto(out *TemplateReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateReference.
+func (in *TemplateReference) DeepCopy() *TemplateReference {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TerraformModule) DeepCopyInto(out *TerraformModule) {
 	*out = *in
@@ -246,6 +669,19 @@ func (in *TerraformStatus) DeepCopyInto(out *TerraformStatus) {
 	*out = *in
 	in.RunStartedAt.DeepCopyInto(&out.RunStartedAt)
 	in.RunFinishedAt.DeepCopyInto(&out.RunFinishedAt)
+	out.ConfigurationHashes = in.ConfigurationHashes
+	if in.ConfigurationHistory != nil {
+		in, out := &in.ConfigurationHistory, &out.ConfigurationHistory
+		*out = make([]ConfigurationHistoryEntry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ClusterAnnotations != nil {
+		in, out := &in.ClusterAnnotations, &out.ClusterAnnotations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TerraformStatus.
@@ -0,0 +1,109 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Package backend executes the Terraform runs of TFCManagedControlPlanes and
+// TFCManagedMachinePools, either in Terraform Cloud or with a local terraform binary.
+package backend
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/terraform"
+)
+
+// RunStatus is the status of a run. The values are those used by Terraform Cloud, which
+// are reported in status.terraform.runStatus.
+type RunStatus string
+
+const (
+	RunPending            RunStatus = "pending"
+	RunPlanning           RunStatus = "planning"
+	RunApplying           RunStatus = "applying"
+	RunPlannedAndFinished RunStatus = "planned_and_finished"
+	RunApplied            RunStatus = "applied"
+	RunErrored            RunStatus = "errored"
+	RunCanceled           RunStatus = "canceled"
+	RunDiscarded          RunStatus = "discarded"
+)
+
+// Run is a Terraform run
+type Run struct {
+	ID     string
+	Status RunStatus
+
+	// HasChanges is false if the run is known to have applied without changing any resources
+	HasChanges bool
+
+	// PlanID is the ID of the plan of the run, if the backend has one
+	PlanID string
+
+	// AwaitingApproval is true while the run has planned and waits to be confirmed before it applies
+	AwaitingApproval bool
+}
+
+// RunOptions configures a run that applies or destroys a configuration version
+type RunOptions struct {
+	// Message describes why the run was queued
+	Message string
+
+	// AutoApply applies the run once it has planned. Otherwise the run waits to be confirmed,
+	// which the local backend does not support.
+	AutoApply bool
+
+	// RefreshOnly only refreshes the state
+	RefreshOnly bool
+
+	// ReplaceAddrs are the addresses of resources to replace
+	ReplaceAddrs []string
+
+	// Destroy destroys the resources at TargetAddrs instead of applying the configuration
+	Destroy bool
+
+	// TargetAddrs restricts the run to the resources at these addresses
+	TargetAddrs []string
+}
+
+// Backend executes the Terraform runs of a single resource
+type Backend interface {
+	// Variables returns the variables runs are executed with, so that they can be hashed
+	// together with the configuration
+	Variables(ctx context.Context) ([]terraform.WorkspaceVariable, error)
+
+	// Upload uploads the configuration files and returns the ID of the new configuration version
+	Upload(ctx context.Context, files map[string][]byte) (string, error)
+
+	// ConfigurationVersionReady returns true once the configuration version can be run
+	ConfigurationVersionReady(ctx context.Context, configurationVersionID string) (bool, error)
+
+	// Apply queues a run that plans and applies the configuration version
+	Apply(ctx context.Context, configurationVersionID string, options RunOptions) (*Run, error)
+
+	// Plan queues a speculative plan of the configuration version
+	Plan(ctx context.Context, configurationVersionID string, message string) (*Run, error)
+
+	// Destroy queues a run that destroys every resource. It returns nil if there is nothing
+	// that could have been applied: no configuration version was uploaded or, in Terraform
+	// Cloud, the workspace has no state.
+	// Only the message and AutoApply options are used.
+	Destroy(ctx context.Context, configurationVersionID string, options RunOptions) (*Run, error)
+
+	// ReadRun returns the current state of a run
+	ReadRun(ctx context.Context, runID string) (*Run, error)
+
+	// PlanJSON returns the JSON plan of a finished speculative plan
+	PlanJSON(ctx context.Context, run *Run) ([]byte, error)
+
+	// Outputs returns the output values of the state produced by the run, keyed by output name,
+	// along with the ID of the state version. If stateVersionID is set that state version is read
+	// instead of looking it up again.
+	Outputs(ctx context.Context, run *Run, stateVersionID string) (string, map[string]any, error)
+}
+
+// errStateVersionNotReady is returned while the state version produced by a run is not yet available
+var errStateVersionNotReady = errors.New("state version is not ready")
+
+// IsStateVersionNotReady returns true if err means the state version should be read again later
+func IsStateVersionNotReady(err error) bool {
+	return errors.Is(err, errStateVersionNotReady)
+}
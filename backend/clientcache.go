@@ -0,0 +1,267 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	tfc "github.com/hashicorp/go-tfe"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// DefaultRateLimit is the number of requests per second sent to each organization, below
+	// the limit of 30 per second Terraform Cloud enforces for each token
+	DefaultRateLimit = 20
+
+	// DefaultRateLimitBurst is the number of requests that can be sent at once to each organization
+	DefaultRateLimitBurst = 30
+
+	// clientIdleTimeout is how long a client that is not used is kept
+	clientIdleTimeout = time.Hour
+)
+
+// TFCClientFactory creates a Terraform Cloud client, e.g. tfc.NewClient
+type TFCClientFactory func(config *tfc.Config) (*tfc.Client, error)
+
+// clientKey identifies a cached client
+type clientKey struct {
+	address      string
+	organization string
+	tokenHash    string
+}
+
+// clientSource is the Secret a client's token is read from, for an organization
+type clientSource struct {
+	secret       types.NamespacedName
+	organization string
+}
+
+// ClientCache reuses Terraform Cloud clients across reconciles, since creating a client sends
+// a request to the API. Clients are keyed by the address, organization and a hash of the token,
+// and the cached client is dropped once the Secret it was created from holds another token or
+// address, or once it has not been used for an hour. Requests to an organization share a rate limiter, and are held back for as long as
+// a rate-limited response asks with its Retry-After header. The variables of workspaces read
+// with the clients are cached for DefaultVariablesTTL.
+type ClientCache struct {
+	newClient TFCClientFactory
+	limit     rate.Limit
+	burst     int
+	variables *VariableCache
+	now       func() time.Time
+
+	mu       sync.Mutex
+	clients  map[clientKey]*tfc.Client
+	lastUsed map[clientKey]time.Time
+	sources  map[clientSource]clientKey
+	limiters map[clientKey]*rateLimiter
+}
+
+// NewClientCache returns a cache creating clients with newClient, sending at most
+// DefaultRateLimit requests per second to each organization
+func NewClientCache(newClient TFCClientFactory) *ClientCache {
+	return &ClientCache{
+		newClient: newClient,
+		limit:     DefaultRateLimit,
+		burst:     DefaultRateLimitBurst,
+		variables: NewVariableCache(DefaultVariablesTTL),
+		now:       time.Now,
+		clients:   map[clientKey]*tfc.Client{},
+		lastUsed:  map[clientKey]time.Time{},
+		sources:   map[clientSource]clientKey{},
+		limiters:  map[clientKey]*rateLimiter{},
+	}
+}
+
+// Client returns the client for the organization authenticated with the token read from
+// the Secret. An empty address is the address of Terraform Cloud.
+func (c *ClientCache) Client(secret types.NamespacedName, address, organization, token string) (*tfc.Client, error) {
+	if address == "" {
+		address = tfc.DefaultAddress
+	}
+	hash := sha256.Sum256([]byte(token))
+	key := clientKey{address: address, organization: organization, tokenHash: hex.EncodeToString(hash[:])}
+	source := clientSource{secret: secret, organization: organization}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.evictIdle(now)
+
+	// the Secret changed, drop the client created from its previous content
+	if previous, ok := c.sources[source]; ok && previous != key {
+		delete(c.sources, source)
+		if !c.used(previous) {
+			delete(c.clients, previous)
+			delete(c.lastUsed, previous)
+		}
+	}
+
+	if client, ok := c.clients[key]; ok {
+		c.sources[source] = key
+		c.lastUsed[key] = now
+		return client, nil
+	}
+
+	client, err := c.newClient(&tfc.Config{
+		Address: address,
+		Token:   token,
+		HTTPClient: &http.Client{
+			Transport: &rateLimitedTransport{
+				base:    cleanhttp.DefaultPooledTransport(),
+				limiter: c.limiter(address, organization),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.clients[key] = client
+	c.lastUsed[key] = now
+	c.sources[source] = key
+	return client, nil
+}
+
+// evictIdle drops the clients that have not been used for clientIdleTimeout, the Secrets
+// referring to them and the rate limiters of organizations left without a client. The lock
+// must be held.
+func (c *ClientCache) evictIdle(now time.Time) {
+	for key, lastUsed := range c.lastUsed {
+		if now.Sub(lastUsed) < clientIdleTimeout {
+			continue
+		}
+		delete(c.clients, key)
+		delete(c.lastUsed, key)
+		for source, k := range c.sources {
+			if k == key {
+				delete(c.sources, source)
+			}
+		}
+	}
+	for limiterKey := range c.limiters {
+		used := false
+		for key := range c.clients {
+			if key.address == limiterKey.address && key.organization == limiterKey.organization {
+				used = true
+				break
+			}
+		}
+		if !used {
+			delete(c.limiters, limiterKey)
+		}
+	}
+}
+
+// Variables returns the cache of the variables of workspaces
+func (c *ClientCache) Variables() *VariableCache {
+	return c.variables
+}
+
+// used returns true if a Secret refers to the client. The lock must be held.
+func (c *ClientCache) used(key clientKey) bool {
+	for _, k := range c.sources {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// limiter returns the rate limiter shared by the clients of the organization. The lock must be held.
+func (c *ClientCache) limiter(address, organization string) *rateLimiter {
+	key := clientKey{address: address, organization: organization}
+	if l, ok := c.limiters[key]; ok {
+		return l
+	}
+	l := &rateLimiter{limiter: rate.NewLimiter(c.limit, c.burst)}
+	c.limiters[key] = l
+	return l
+}
+
+// rateLimiter limits the rate of requests, and holds them back after a rate-limited response
+type rateLimiter struct {
+	limiter *rate.Limiter
+
+	mu           sync.Mutex
+	blockedUntil time.Time
+}
+
+// wait blocks until a request can be sent
+func (l *rateLimiter) wait(req *http.Request) error {
+	l.mu.Lock()
+	blockedUntil := l.blockedUntil
+	l.mu.Unlock()
+
+	ctx := req.Context()
+	if d := time.Until(blockedUntil); d > 0 {
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return l.limiter.Wait(ctx)
+}
+
+// block holds back requests until the time
+func (l *rateLimiter) block(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// rateLimitedTransport sends requests once the rate limiter allows it. go-tfe retries
+// rate-limited requests, which are then held back as long as the response asked.
+type rateLimitedTransport struct {
+	base    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.wait(req); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		now := time.Now()
+		if d, ok := retryAfter(resp.Header.Get("Retry-After"), now); ok {
+			t.limiter.block(now.Add(d))
+		}
+	}
+	return resp, nil
+}
+
+// retryAfter parses a Retry-After header, given either in seconds or as an HTTP date
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
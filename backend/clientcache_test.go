@@ -0,0 +1,165 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package backend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tfc "github.com/hashicorp/go-tfe"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestClientCache(t *testing.T) {
+	configs := []*tfc.Config{}
+	cache := NewClientCache(func(config *tfc.Config) (*tfc.Client, error) {
+		configs = append(configs, config)
+		return &tfc.Client{}, nil
+	})
+	secret := types.NamespacedName{Namespace: "default", Name: "terraform-cloud-token"}
+	other := types.NamespacedName{Namespace: "other", Name: "terraform-cloud-token"}
+
+	client, err := cache.Client(secret, "", "example-org", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configs[0].Address != tfc.DefaultAddress || configs[0].Token != "token" {
+		t.Errorf("unexpected configuration: %+v", configs[0])
+	}
+	if again, _ := cache.Client(secret, "", "example-org", "token"); again != client {
+		t.Error("expected the client to be reused")
+	}
+	if shared, _ := cache.Client(other, "", "example-org", "token"); shared != client {
+		t.Error("expected the client to be shared by Secrets holding the same token")
+	}
+	if len(configs) != 1 {
+		t.Errorf("expected a single client to be created, got %d", len(configs))
+	}
+
+	// another organization has its own rate limiter
+	if _, err := cache.Client(secret, "", "other-org", "token"); err != nil {
+		t.Fatal(err)
+	}
+	if configs[1].HTTPClient.Transport.(*rateLimitedTransport).limiter == configs[0].HTTPClient.Transport.(*rateLimitedTransport).limiter {
+		t.Error("expected organizations not to share a rate limiter")
+	}
+
+	// a changed token replaces the client, which is dropped once no Secret holds its token
+	rotated, err := cache.Client(secret, "", "example-org", "rotated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated == client {
+		t.Error("expected a new client for the rotated token")
+	}
+	if configs[2].HTTPClient.Transport.(*rateLimitedTransport).limiter != configs[0].HTTPClient.Transport.(*rateLimitedTransport).limiter {
+		t.Error("expected clients of an organization to share a rate limiter")
+	}
+	if len(cache.clients) != 3 {
+		t.Errorf("expected the client to be kept while another Secret holds its token, got %d clients", len(cache.clients))
+	}
+	if _, err := cache.Client(other, "", "example-org", "rotated"); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.clients) != 2 {
+		t.Errorf("expected the client of the previous token to be dropped, got %d clients", len(cache.clients))
+	}
+}
+
+func TestClientCacheEvictsIdleClients(t *testing.T) {
+	created := 0
+	cache := NewClientCache(func(config *tfc.Config) (*tfc.Client, error) {
+		created++
+		return &tfc.Client{}, nil
+	})
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	secret := types.NamespacedName{Namespace: "default", Name: "terraform-cloud-token"}
+	other := types.NamespacedName{Namespace: "other", Name: "terraform-cloud-token"}
+
+	if _, err := cache.Client(secret, "", "example-org", "token"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Client(other, "", "other-org", "other-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the client of the first Secret keeps being used, the other one is not
+	now = now.Add(clientIdleTimeout / 2)
+	if _, err := cache.Client(secret, "", "example-org", "token"); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(clientIdleTimeout / 2)
+	if _, err := cache.Client(secret, "", "example-org", "token"); err != nil {
+		t.Fatal(err)
+	}
+	if created != 2 || len(cache.clients) != 1 || len(cache.sources) != 1 || len(cache.limiters) != 1 {
+		t.Errorf("expected only the idle client to be evicted, got %d clients, %d sources and %d rate limiters",
+			len(cache.clients), len(cache.sources), len(cache.limiters))
+	}
+
+	// an evicted client is created again when it is needed
+	if _, err := cache.Client(other, "", "other-org", "other-token"); err != nil {
+		t.Fatal(err)
+	}
+	if created != 3 {
+		t.Errorf("expected the evicted client to be created again, got %d clients created", created)
+	}
+}
+
+func TestRateLimitedTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	cache := NewClientCache(nil)
+	transport := &rateLimitedTransport{base: http.DefaultTransport, limiter: cache.limiter(server.URL, "example-org")}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected the rate-limited response to be returned, got %d", resp.StatusCode)
+	}
+	if d := time.Until(transport.limiter.blockedUntil); d < 59*time.Second || d > 60*time.Second {
+		t.Errorf("expected requests to be held back for 60s, got %s", d)
+	}
+
+	// requests of the organization wait until the rate limit is lifted
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if _, err := transport.RoundTrip(req); err != context.DeadlineExceeded {
+		t.Errorf("expected the request to be held back, got %v", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{value: "", ok: false},
+		{value: "30", want: 30 * time.Second, ok: true},
+		{value: "-1", ok: false},
+		{value: "Mon, 02 Jan 2023 15:04:15 GMT", want: 10 * time.Second, ok: true},
+		{value: "Mon, 02 Jan 2023 15:04:00 GMT", want: 0, ok: true},
+		{value: "soon", ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %s, %t, expected %s, %t", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,515 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package backend
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/terraform"
+)
+
+const (
+	// ConfigurationOwnerLabel holds the UID of the resource a configuration Secret of the local backend belongs to
+	ConfigurationOwnerLabel = "infrastructure.cluster.x-k8s.io/local-configuration-owner"
+
+	// RunOwnerLabel holds the UID of the resource a Job of the local backend runs Terraform for
+	RunOwnerLabel = "infrastructure.cluster.x-k8s.io/local-run-owner"
+
+	// RunOperationLabel is apply, plan or destroy
+	RunOperationLabel = "infrastructure.cluster.x-k8s.io/local-run-operation"
+
+	// BackendOverrideFileName is the file configuring the kubernetes backend that is added to the configuration
+	BackendOverrideFileName = "capi_backend_override.tf"
+
+	// stateSecretKey is the key of the state Secret the kubernetes backend stores gzipped state in
+	stateSecretKey = "tfstate"
+
+	// planJSONMarker is printed by plan Jobs before the JSON plan
+	planJSONMarker = "--- terraform show -json ---"
+
+	// maxConfigurationSize bounds the size of a configuration Secret, below the limit on the size of objects
+	maxConfigurationSize = 900 * 1024
+
+	// keptConfigurationVersions is the number of configuration Secrets kept, matching the configuration history
+	keptConfigurationVersions = 10
+
+	// keptRuns is the number of finished Jobs kept
+	keptRuns = 5
+
+	// destroyJobTTL is how long a destroy Job is kept after it finished, as no resource is left to clean it up
+	destroyJobTTL = 24 * 60 * 60
+
+	configurationVolume = "configuration"
+	configurationPath   = "/configuration"
+	workspaceVolume     = "workspace"
+	workspacePath       = "/workspace"
+)
+
+const (
+	operationApply   = "apply"
+	operationPlan    = "plan"
+	operationDestroy = "destroy"
+)
+
+// prepareScript copies the configuration from the read-only Secret volume, skipping the
+// entries Kubernetes adds to it, and initializes the working directory
+const prepareScript = `for f in ` + configurationPath + `/* ` + configurationPath + `/.[!.]*; do if [ -f "$f" ]; then cp "$f" ` + workspacePath + `/; fi; done && ` +
+	`terraform init -input=false -no-color && `
+
+var scripts = map[string]string{
+	operationApply:   prepareScript + `terraform apply -auto-approve -input=false -no-color "$@"`,
+	operationPlan:    prepareScript + `terraform plan -input=false -no-color -out=tfplan && echo "` + planJSONMarker + `" && terraform show -json tfplan`,
+	operationDestroy: prepareScript + `terraform destroy -auto-approve -input=false -no-color`,
+}
+
+// Local executes runs with the terraform binary in Kubernetes Jobs. Configuration versions are
+// Secrets holding the configuration files, and state is stored in a Secret by the Terraform
+// kubernetes backend, which is configured by a file added to every configuration.
+type Local struct {
+	client    client.Client
+	pods      corev1client.PodsGetter
+	scheme    *runtime.Scheme
+	owner     client.Object
+	spec      infrastructurev1alpha1.LocalBackendSpec
+	workspace string
+}
+
+// NewLocal returns a backend running Terraform for the owner in Jobs in its namespace, storing
+// state in the Secret named after the workspace
+func NewLocal(c client.Client, pods corev1client.PodsGetter, scheme *runtime.Scheme, owner client.Object, spec *infrastructurev1alpha1.LocalBackendSpec, workspace string) *Local {
+	l := &Local{
+		client:    c,
+		pods:      pods,
+		scheme:    scheme,
+		owner:     owner,
+		workspace: workspace,
+	}
+	if spec != nil {
+		l.spec = *spec
+	}
+	if l.spec.Image == "" {
+		l.spec.Image = infrastructurev1alpha1.DefaultLocalBackendImage
+	}
+	return l
+}
+
+// StateSecretName returns the name of the Secret the kubernetes backend stores the state of the workspace in
+func StateSecretName(workspace string) string {
+	return "tfstate-default-" + workspace
+}
+
+// namePrefix returns a prefix for generated names that leaves room for the suffix and
+// the random characters added to it within the limit on label values
+func namePrefix(owner client.Object, suffix string) string {
+	name := owner.GetName()
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	return fmt.Sprintf("%s-%s-", name, suffix)
+}
+
+// Variables returns the values of the variables Secret
+func (b *Local) Variables(ctx context.Context) ([]terraform.WorkspaceVariable, error) {
+	variables := []terraform.WorkspaceVariable{}
+	if b.spec.VariablesSecretRef == nil {
+		return variables, nil
+	}
+	var secret corev1.Secret
+	key := client.ObjectKey{Namespace: b.owner.GetNamespace(), Name: b.spec.VariablesSecretRef.Name}
+	if err := b.client.Get(ctx, key, &secret); err != nil {
+		return nil, fmt.Errorf("could not read variables Secret: %w", err)
+	}
+	for k, v := range secret.Data {
+		variables = append(variables, terraform.WorkspaceVariable{
+			Source:    "secret/" + secret.Name,
+			ID:        k,
+			Key:       k,
+			Category:  "terraform",
+			Value:     string(v),
+			Sensitive: true,
+		})
+	}
+	return variables, nil
+}
+
+// backendConfiguration returns the configuration of the kubernetes backend
+func (b *Local) backendConfiguration() []byte {
+	f := hclwrite.NewEmptyFile()
+	tf := f.Body().AppendNewBlock("terraform", nil)
+	be := tf.Body().AppendNewBlock("backend", []string{"kubernetes"})
+	be.Body().SetAttributeValue("secret_suffix", cty.StringVal(b.workspace))
+	be.Body().SetAttributeValue("namespace", cty.StringVal(b.owner.GetNamespace()))
+	be.Body().SetAttributeValue("in_cluster_config", cty.True)
+	return f.Bytes()
+}
+
+// Upload stores the files in a new Secret owned by the resource, whose name is the ID of the
+// configuration version, and prunes the oldest ones
+func (b *Local) Upload(ctx context.Context, files map[string][]byte) (string, error) {
+	if _, ok := files[BackendOverrideFileName]; ok {
+		return "", fmt.Errorf("%s is reserved for the configuration of the kubernetes backend", BackendOverrideFileName)
+	}
+	data := map[string][]byte{BackendOverrideFileName: b.backendConfiguration()}
+	size := 0
+	for name, content := range files {
+		data[name] = content
+		size += len(name) + len(content)
+	}
+	if size > maxConfigurationSize {
+		return "", fmt.Errorf("configuration is %d bytes, larger than the %d bytes a Secret can hold", size, maxConfigurationSize)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: namePrefix(b.owner, "tfconfig"),
+			Namespace:    b.owner.GetNamespace(),
+			Labels:       map[string]string{ConfigurationOwnerLabel: string(b.owner.GetUID())},
+		},
+		Data: data,
+	}
+	if err := controllerutil.SetControllerReference(b.owner, secret, b.scheme); err != nil {
+		return "", err
+	}
+	if err := b.client.Create(ctx, secret); err != nil {
+		return "", fmt.Errorf("could not create configuration Secret: %w", err)
+	}
+
+	if err := b.pruneConfigurationVersions(ctx); err != nil {
+		log.FromContext(ctx).Error(err, "Error pruning configuration Secrets")
+	}
+	return secret.Name, nil
+}
+
+// pruneConfigurationVersions deletes all but the newest configuration Secrets
+func (b *Local) pruneConfigurationVersions(ctx context.Context) error {
+	var secrets corev1.SecretList
+	if err := b.client.List(ctx, &secrets, client.InNamespace(b.owner.GetNamespace()),
+		client.MatchingLabels{ConfigurationOwnerLabel: string(b.owner.GetUID())}); err != nil {
+		return err
+	}
+	items := secrets.Items
+	sort.Slice(items, func(i, j int) bool {
+		return items[j].CreationTimestamp.Before(&items[i].CreationTimestamp)
+	})
+	for i := keptConfigurationVersions; i < len(items); i++ {
+		if err := b.client.Delete(ctx, &items[i]); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfigurationVersionReady returns true if the configuration Secret exists
+func (b *Local) ConfigurationVersionReady(ctx context.Context, configurationVersionID string) (bool, error) {
+	var secret corev1.Secret
+	key := client.ObjectKey{Namespace: b.owner.GetNamespace(), Name: configurationVersionID}
+	if err := b.client.Get(ctx, key, &secret); err != nil {
+		return false, fmt.Errorf("could not read configuration Secret: %w", err)
+	}
+	return true, nil
+}
+
+// job returns a Job running the operation on the configuration Secret
+func (b *Local) job(operation, configurationSecret string, args []string) *batchv1.Job {
+	labels := map[string]string{
+		RunOwnerLabel:     string(b.owner.GetUID()),
+		RunOperationLabel: operation,
+	}
+	env := append([]corev1.EnvVar{
+		{Name: "TF_IN_AUTOMATION", Value: "1"},
+		{Name: "TF_INPUT", Value: "0"},
+	}, b.spec.Env...)
+	var envFrom []corev1.EnvFromSource
+	if b.spec.VariablesSecretRef != nil {
+		envFrom = append(envFrom, corev1.EnvFromSource{
+			Prefix:    "TF_VAR_",
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: *b.spec.VariablesSecretRef},
+		})
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: namePrefix(b.owner, operation),
+			Namespace:    b.owner.GetNamespace(),
+			Labels:       labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: pointer.Int32(0),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: b.spec.ServiceAccountName,
+					Containers: []corev1.Container{{
+						Name:       "terraform",
+						Image:      b.spec.Image,
+						Command:    []string{"/bin/sh", "-c", scripts[operation], "terraform"},
+						Args:       args,
+						WorkingDir: workspacePath,
+						Env:        env,
+						EnvFrom:    envFrom,
+						Resources:  b.spec.Resources,
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: configurationVolume, MountPath: configurationPath, ReadOnly: true},
+							{Name: workspaceVolume, MountPath: workspacePath},
+						},
+					}},
+					Volumes: []corev1.Volume{
+						{Name: configurationVolume, VolumeSource: corev1.VolumeSource{
+							Secret: &corev1.SecretVolumeSource{SecretName: configurationSecret},
+						}},
+						{Name: workspaceVolume, VolumeSource: corev1.VolumeSource{
+							EmptyDir: &corev1.EmptyDirVolumeSource{},
+						}},
+					},
+				},
+			},
+		},
+	}
+}
+
+// createJob creates a Job owned by the resource and prunes the oldest finished ones
+func (b *Local) createJob(ctx context.Context, job *batchv1.Job) (*Run, error) {
+	if err := controllerutil.SetControllerReference(b.owner, job, b.scheme); err != nil {
+		return nil, err
+	}
+	if err := b.client.Create(ctx, job); err != nil {
+		return nil, fmt.Errorf("could not create Job: %w", err)
+	}
+	if err := b.pruneJobs(ctx); err != nil {
+		log.FromContext(ctx).Error(err, "Error pruning Jobs")
+	}
+	return runFromJob(job), nil
+}
+
+// pruneJobs deletes all but the newest finished Jobs
+func (b *Local) pruneJobs(ctx context.Context) error {
+	var jobs batchv1.JobList
+	if err := b.client.List(ctx, &jobs, client.InNamespace(b.owner.GetNamespace()),
+		client.MatchingLabels{RunOwnerLabel: string(b.owner.GetUID())}); err != nil {
+		return err
+	}
+	items := jobs.Items
+	sort.Slice(items, func(i, j int) bool {
+		return items[j].CreationTimestamp.Before(&items[i].CreationTimestamp)
+	})
+	for i := keptRuns; i < len(items); i++ {
+		if !jobFinished(&items[i]) {
+			continue
+		}
+		if err := b.client.Delete(ctx, &items[i], client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply creates a Job that applies the configuration version. Runs are always auto-applied.
+func (b *Local) Apply(ctx context.Context, configurationVersionID string, options RunOptions) (*Run, error) {
+	args := []string{}
+	if options.RefreshOnly {
+		args = append(args, "-refresh-only")
+	}
+	for _, addr := range options.ReplaceAddrs {
+		args = append(args, "-replace="+addr)
+	}
+	if options.Destroy {
+		args = append(args, "-destroy")
+	}
+	for _, addr := range options.TargetAddrs {
+		args = append(args, "-target="+addr)
+	}
+	return b.createJob(ctx, b.job(operationApply, configurationVersionID, args))
+}
+
+// Plan creates a Job that plans the configuration version and prints the JSON plan
+func (b *Local) Plan(ctx context.Context, configurationVersionID string, message string) (*Run, error) {
+	return b.createJob(ctx, b.job(operationPlan, configurationVersionID, nil))
+}
+
+// Destroy creates a Job that destroys the resources in the state. As the resource is about to be
+// deleted, the Job is not owned by it and runs on a copy of the configuration owned by the Job.
+func (b *Local) Destroy(ctx context.Context, configurationVersionID string, options RunOptions) (*Run, error) {
+	if configurationVersionID == "" {
+		return nil, nil
+	}
+	var configuration corev1.Secret
+	key := client.ObjectKey{Namespace: b.owner.GetNamespace(), Name: configurationVersionID}
+	if err := b.client.Get(ctx, key, &configuration); err != nil {
+		return nil, fmt.Errorf("could not read configuration Secret: %w", err)
+	}
+
+	name := namePrefix(b.owner, operationDestroy) + utilrand.String(5)
+	job := b.job(operationDestroy, name, nil)
+	job.GenerateName = ""
+	job.Name = name
+	job.Spec.TTLSecondsAfterFinished = pointer.Int32(destroyJobTTL)
+	if err := b.client.Create(ctx, job); err != nil {
+		return nil, fmt.Errorf("could not create Job: %w", err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name,
+			Namespace: job.Namespace,
+		},
+		Data: configuration.Data,
+	}
+	if err := controllerutil.SetOwnerReference(job, secret, b.scheme); err != nil {
+		return nil, err
+	}
+	if err := b.client.Create(ctx, secret); err != nil {
+		return nil, fmt.Errorf("could not create configuration Secret of destroy Job: %w", err)
+	}
+	return runFromJob(job), nil
+}
+
+// jobFinished returns true if the Job has completed or failed
+func jobFinished(job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// runFromJob returns the run a Job executes
+func runFromJob(job *batchv1.Job) *Run {
+	operation := job.Labels[RunOperationLabel]
+	run := &Run{
+		ID:         job.Name,
+		Status:     RunPending,
+		HasChanges: true,
+	}
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			run.Status = RunApplied
+			if operation == operationPlan {
+				run.Status = RunPlannedAndFinished
+			}
+			return run
+		case batchv1.JobFailed:
+			run.Status = RunErrored
+			return run
+		}
+	}
+	if job.Status.Active > 0 {
+		run.Status = RunApplying
+		if operation == operationPlan {
+			run.Status = RunPlanning
+		}
+	}
+	return run
+}
+
+// ReadRun reads the Job of the run
+func (b *Local) ReadRun(ctx context.Context, runID string) (*Run, error) {
+	var job batchv1.Job
+	if err := b.client.Get(ctx, client.ObjectKey{Namespace: b.owner.GetNamespace(), Name: runID}, &job); err != nil {
+		return nil, fmt.Errorf("could not read Job: %w", err)
+	}
+	return runFromJob(&job), nil
+}
+
+// PlanJSON reads the JSON plan from the log of the pod of a plan Job
+func (b *Local) PlanJSON(ctx context.Context, run *Run) ([]byte, error) {
+	if b.pods == nil {
+		return nil, fmt.Errorf("pod logs cannot be read")
+	}
+	var pods corev1.PodList
+	if err := b.client.List(ctx, &pods, client.InNamespace(b.owner.GetNamespace()),
+		client.MatchingLabels{"job-name": run.ID}); err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+		logs, err := b.pods.Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: "terraform"}).DoRaw(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the log of pod %s: %w", pod.Name, err)
+		}
+		return planFromLog(logs)
+	}
+	return nil, fmt.Errorf("no succeeded pod found for Job %s", run.ID)
+}
+
+// planFromLog returns the JSON plan printed after the marker
+func planFromLog(logs []byte) ([]byte, error) {
+	i := bytes.LastIndex(logs, []byte(planJSONMarker+"\n"))
+	if i < 0 {
+		return nil, fmt.Errorf("log does not contain a JSON plan")
+	}
+	return bytes.TrimSpace(logs[i+len(planJSONMarker)+1:]), nil
+}
+
+// terraformState is the subset of the Terraform state format outputs are read from
+type terraformState struct {
+	Serial  int64  `json:"serial"`
+	Lineage string `json:"lineage"`
+	Outputs map[string]struct {
+		Value any `json:"value"`
+	} `json:"outputs"`
+}
+
+// Outputs reads the outputs from the state Secret. The kubernetes backend keeps no history, so
+// the latest state is read and identified by its lineage and serial.
+func (b *Local) Outputs(ctx context.Context, run *Run, stateVersionID string) (string, map[string]any, error) {
+	var secret corev1.Secret
+	key := client.ObjectKey{Namespace: b.owner.GetNamespace(), Name: StateSecretName(b.workspace)}
+	if err := b.client.Get(ctx, key, &secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil, fmt.Errorf("%w: state Secret %s does not exist", errStateVersionNotReady, key.Name)
+		}
+		return "", nil, err
+	}
+	return parseState(secret.Data[stateSecretKey])
+}
+
+// parseState returns the ID and the outputs of gzipped state
+func parseState(data []byte) (string, map[string]any, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, fmt.Errorf("could not read state: %w", err)
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not read state: %w", err)
+	}
+	var state terraformState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return "", nil, fmt.Errorf("could not parse state: %w", err)
+	}
+	values := map[string]any{}
+	for name, o := range state.Outputs {
+		values[name] = o.Value
+	}
+	return fmt.Sprintf("%s-%d", state.Lineage, state.Serial), values, nil
+}
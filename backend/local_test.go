@@ -0,0 +1,199 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package backend
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+func testLocal(t *testing.T, objs ...client.Object) (*Local, client.Client) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := infrastructurev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	owner := &infrastructurev1alpha1.TFCManagedControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default", UID: "1234"},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	spec := &infrastructurev1alpha1.LocalBackendSpec{
+		ServiceAccountName: "terraform",
+		VariablesSecretRef: &corev1.LocalObjectReference{Name: "example-variables"},
+	}
+	return NewLocal(c, nil, scheme, owner, spec, "example-cluster"), c
+}
+
+func TestLocalUpload(t *testing.T) {
+	ctx := context.Background()
+	b, c := testLocal(t)
+
+	id, err := b.Upload(ctx, map[string][]byte{"main.tf": []byte(`module "cluster" {}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var secret corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "default", Name: id}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(id, "example-tfconfig-") || secret.Labels[ConfigurationOwnerLabel] != "1234" {
+		t.Errorf("unexpected configuration Secret %s with labels %v", id, secret.Labels)
+	}
+	if string(secret.Data["main.tf"]) != `module "cluster" {}` {
+		t.Errorf("unexpected content of main.tf: %s", secret.Data["main.tf"])
+	}
+	want := "terraform {\n  backend \"kubernetes\" {\n    secret_suffix     = \"example-cluster\"\n    namespace         = \"default\"\n    in_cluster_config = true\n  }\n}\n"
+	if got := string(secret.Data[BackendOverrideFileName]); got != want {
+		t.Errorf("unexpected backend configuration:\n%s", got)
+	}
+	if ready, err := b.ConfigurationVersionReady(ctx, id); err != nil || !ready {
+		t.Errorf("expected the configuration version to be ready, got %t, %v", ready, err)
+	}
+
+	if _, err := b.Upload(ctx, map[string][]byte{BackendOverrideFileName: nil}); err == nil {
+		t.Error("expected an error for a file named like the backend configuration")
+	}
+}
+
+func TestLocalVariables(t *testing.T) {
+	b, _ := testLocal(t, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-variables", Namespace: "default"},
+		Data:       map[string][]byte{"region": []byte("europe-west1")},
+	})
+	variables, err := b.Variables(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variables) != 1 || variables[0].Key != "region" || variables[0].Value != "europe-west1" {
+		t.Errorf("unexpected variables: %+v", variables)
+	}
+}
+
+func TestLocalJob(t *testing.T) {
+	b, _ := testLocal(t)
+	job := b.job(operationApply, "example-tfconfig-abcde", []string{"-replace=aws_instance.a"})
+
+	if job.Labels[RunOwnerLabel] != "1234" || job.Labels[RunOperationLabel] != operationApply {
+		t.Errorf("unexpected labels: %v", job.Labels)
+	}
+	pod := job.Spec.Template.Spec
+	if pod.ServiceAccountName != "terraform" || pod.RestartPolicy != corev1.RestartPolicyNever {
+		t.Errorf("unexpected pod spec: %+v", pod)
+	}
+	if pod.Volumes[0].Secret.SecretName != "example-tfconfig-abcde" {
+		t.Errorf("expected the configuration Secret to be mounted, got %q", pod.Volumes[0].Secret.SecretName)
+	}
+	container := pod.Containers[0]
+	if container.Image != infrastructurev1alpha1.DefaultLocalBackendImage {
+		t.Errorf("expected the default image, got %q", container.Image)
+	}
+	if !reflect.DeepEqual(container.Args, []string{"-replace=aws_instance.a"}) {
+		t.Errorf("unexpected arguments: %v", container.Args)
+	}
+	if !strings.HasSuffix(container.Command[2], `terraform apply -auto-approve -input=false -no-color "$@"`) {
+		t.Errorf("unexpected script: %s", container.Command[2])
+	}
+	if container.EnvFrom[0].Prefix != "TF_VAR_" || container.EnvFrom[0].SecretRef.Name != "example-variables" {
+		t.Errorf("expected variables to be read from the Secret, got %+v", container.EnvFrom)
+	}
+}
+
+func TestRunFromJob(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation string
+		status    batchv1.JobStatus
+		want      RunStatus
+	}{
+		{name: "pending", operation: operationApply, want: RunPending},
+		{name: "applying", operation: operationApply, status: batchv1.JobStatus{Active: 1}, want: RunApplying},
+		{name: "planning", operation: operationPlan, status: batchv1.JobStatus{Active: 1}, want: RunPlanning},
+		{
+			name:      "applied",
+			operation: operationApply,
+			status:    batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}},
+			want:      RunApplied,
+		},
+		{
+			name:      "planned",
+			operation: operationPlan,
+			status:    batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}},
+			want:      RunPlannedAndFinished,
+		},
+		{
+			name:      "errored",
+			operation: operationApply,
+			status:    batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}},
+			want:      RunErrored,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: "example-apply-abcde", Labels: map[string]string{RunOperationLabel: tt.operation}},
+				Status:     tt.status,
+			}
+			if got := runFromJob(job).Status; got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPlanFromLog(t *testing.T) {
+	logs := []byte("Initializing the backend...\nPlan: 1 to add.\n" + planJSONMarker + "\n{\"resource_changes\":[]}\n")
+	plan, err := planFromLog(logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plan) != `{"resource_changes":[]}` {
+		t.Errorf("unexpected plan: %s", plan)
+	}
+	if _, err := planFromLog([]byte("Error: Invalid reference\n")); err == nil {
+		t.Error("expected an error for a log without a plan")
+	}
+}
+
+func TestLocalOutputs(t *testing.T) {
+	var state bytes.Buffer
+	w := gzip.NewWriter(&state)
+	w.Write([]byte(`{"serial":3,"lineage":"abc","outputs":{"endpoint":{"value":"10.0.0.1","type":"string"},"port":{"value":443,"type":"number"}}}`))
+	w.Close()
+
+	b, _ := testLocal(t)
+	if _, _, err := b.Outputs(context.Background(), &Run{ID: "example-apply-abcde"}, ""); !IsStateVersionNotReady(err) {
+		t.Errorf("expected the state to not be ready, got %v", err)
+	}
+
+	b, _ = testLocal(t, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: StateSecretName("example-cluster"), Namespace: "default"},
+		Data:       map[string][]byte{stateSecretKey: state.Bytes()},
+	})
+	id, outputs, err := b.Outputs(context.Background(), &Run{ID: "example-apply-abcde"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "abc-3" {
+		t.Errorf("unexpected state version ID %q", id)
+	}
+	if outputs["endpoint"] != "10.0.0.1" || outputs["port"] != float64(443) {
+		t.Errorf("unexpected outputs: %v", outputs)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	tfc "github.com/hashicorp/go-tfe"
+
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/terraform"
+)
+
+// TerraformCloud executes runs in a Terraform Cloud workspace
+type TerraformCloud struct {
+	client       *tfc.Client
+	organization string
+	workspace    string
+	workspaceID  string
+	variables    *VariableCache
+
+	// workspaceNotFound is set once a request for the workspace ID was not found
+	workspaceNotFound bool
+}
+
+// NewTerraformCloud returns a backend executing runs in the named workspace of the organization.
+// The workspace is only looked up by name if its ID, cached from an earlier reconcile, is empty.
+// Variables are cached in the variable cache, if set.
+func NewTerraformCloud(ctx context.Context, client *tfc.Client, organization, workspace, workspaceID string, variables *VariableCache) (*TerraformCloud, error) {
+	if workspaceID == "" {
+		ws, err := client.Workspaces.Read(ctx, organization, workspace)
+		if err != nil {
+			return nil, fmt.Errorf("could not read Terraform Cloud workspace: %w", err)
+		}
+		workspaceID = ws.ID
+	}
+	return &TerraformCloud{
+		client:       client,
+		organization: organization,
+		workspace:    workspace,
+		workspaceID:  workspaceID,
+		variables:    variables,
+	}, nil
+}
+
+// WorkspaceID returns the ID of the workspace
+func (b *TerraformCloud) WorkspaceID() string {
+	return b.workspaceID
+}
+
+// WorkspaceNotFound returns true if Terraform Cloud no longer found the workspace with the ID,
+// e.g. because it was deleted and recreated, in which case the cached ID should be forgotten
+func (b *TerraformCloud) WorkspaceNotFound() bool {
+	return b.workspaceNotFound
+}
+
+// workspaceErr records that the workspace was not found if err says so, and returns err
+func (b *TerraformCloud) workspaceErr(err error) error {
+	if errors.Is(err, tfc.ErrResourceNotFound) {
+		b.workspaceNotFound = true
+	}
+	return err
+}
+
+func runFromTFC(run *tfc.Run) *Run {
+	r := &Run{
+		ID:         run.ID,
+		Status:     RunStatus(run.Status),
+		HasChanges: run.HasChanges,
+	}
+	if run.Actions != nil && run.Actions.IsConfirmable {
+		r.AwaitingApproval = true
+	}
+	if run.Plan != nil {
+		r.PlanID = run.Plan.ID
+	}
+	return r
+}
+
+// Variables returns the variables of the workspace and of the variable sets applied to it
+func (b *TerraformCloud) Variables(ctx context.Context) ([]terraform.WorkspaceVariable, error) {
+	if b.variables == nil {
+		return b.listVariables(ctx)
+	}
+	return b.variables.get(ctx, variablesKey{client: b.client, workspaceID: b.workspaceID}, b.listVariables)
+}
+
+// listVariables lists the variables of the workspace and of the variable sets applied to it
+func (b *TerraformCloud) listVariables(ctx context.Context) ([]terraform.WorkspaceVariable, error) {
+	variables := []terraform.WorkspaceVariable{}
+
+	options := &tfc.VariableListOptions{ListOptions: tfc.ListOptions{PageSize: 100}}
+	for {
+		list, err := b.client.Variables.List(ctx, b.workspaceID, options)
+		if err != nil {
+			return nil, b.workspaceErr(fmt.Errorf("could not list workspace variables: %w", err))
+		}
+		for _, v := range list.Items {
+			variables = append(variables, terraform.WorkspaceVariable{
+				Source:    "workspace",
+				ID:        v.ID,
+				Key:       v.Key,
+				Category:  string(v.Category),
+				Value:     v.Value,
+				HCL:       v.HCL,
+				Sensitive: v.Sensitive,
+			})
+		}
+		if list.Pagination == nil || list.NextPage == 0 {
+			break
+		}
+		options.PageNumber = list.NextPage
+	}
+
+	setOptions := &tfc.VariableSetListOptions{ListOptions: tfc.ListOptions{PageSize: 100}}
+	for {
+		sets, err := b.client.VariableSets.ListForWorkspace(ctx, b.workspaceID, setOptions)
+		if err != nil {
+			return nil, b.workspaceErr(fmt.Errorf("could not list variable sets: %w", err))
+		}
+		for _, set := range sets.Items {
+			varOptions := &tfc.VariableSetVariableListOptions{ListOptions: tfc.ListOptions{PageSize: 100}}
+			for {
+				list, err := b.client.VariableSetVariables.List(ctx, set.ID, varOptions)
+				if err != nil {
+					return nil, fmt.Errorf("could not list variables of variable set %s: %w", set.ID, err)
+				}
+				for _, v := range list.Items {
+					variables = append(variables, terraform.WorkspaceVariable{
+						Source:    set.ID,
+						ID:        v.ID,
+						Key:       v.Key,
+						Category:  string(v.Category),
+						Value:     v.Value,
+						HCL:       v.HCL,
+						Sensitive: v.Sensitive,
+					})
+				}
+				if list.Pagination == nil || list.NextPage == 0 {
+					break
+				}
+				varOptions.PageNumber = list.NextPage
+			}
+		}
+		if sets.Pagination == nil || sets.NextPage == 0 {
+			break
+		}
+		setOptions.PageNumber = sets.NextPage
+	}
+	return variables, nil
+}
+
+// Upload creates a ConfigurationVersion that does not queue runs and uploads the files to it
+func (b *TerraformCloud) Upload(ctx context.Context, files map[string][]byte) (string, error) {
+	dir, err := terraform.CreateConfiguration(files, nil)
+	defer os.RemoveAll(dir)
+	if err != nil {
+		return "", err
+	}
+
+	cv, err := b.client.ConfigurationVersions.Create(ctx, b.workspaceID, tfc.ConfigurationVersionCreateOptions{
+		AutoQueueRuns: tfc.Bool(false),
+	})
+	if err != nil {
+		return "", b.workspaceErr(fmt.Errorf("could not create ConfigurationVersion: %w", err))
+	}
+	if err := b.client.ConfigurationVersions.Upload(ctx, cv.UploadURL, dir); err != nil {
+		return "", fmt.Errorf("could not upload configuration to ConfigurationVersion: %w", err)
+	}
+	return cv.ID, nil
+}
+
+// ConfigurationVersionReady returns true once Terraform Cloud has processed the upload
+func (b *TerraformCloud) ConfigurationVersionReady(ctx context.Context, configurationVersionID string) (bool, error) {
+	cv, err := b.client.ConfigurationVersions.Read(ctx, configurationVersionID)
+	if err != nil {
+		return false, err
+	}
+	return cv.Status == tfc.ConfigurationUploaded, nil
+}
+
+func (b *TerraformCloud) createRun(ctx context.Context, options tfc.RunCreateOptions) (*Run, error) {
+	options.Workspace = &tfc.Workspace{ID: b.workspaceID}
+	run, err := b.client.Runs.Create(ctx, options)
+	if err != nil {
+		return nil, b.workspaceErr(err)
+	}
+	return runFromTFC(run), nil
+}
+
+// Apply queues a run of the configuration version, which waits to be confirmed unless it is auto-applied
+func (b *TerraformCloud) Apply(ctx context.Context, configurationVersionID string, options RunOptions) (*Run, error) {
+	runOptions := tfc.RunCreateOptions{
+		Message:              tfc.String(options.Message),
+		AutoApply:            tfc.Bool(options.AutoApply),
+		ConfigurationVersion: &tfc.ConfigurationVersion{ID: configurationVersionID},
+	}
+	if options.RefreshOnly {
+		runOptions.RefreshOnly = tfc.Bool(true)
+	}
+	if len(options.ReplaceAddrs) > 0 {
+		runOptions.ReplaceAddrs = options.ReplaceAddrs
+	}
+	if options.Destroy {
+		runOptions.IsDestroy = tfc.Bool(true)
+	}
+	if len(options.TargetAddrs) > 0 {
+		runOptions.TargetAddrs = options.TargetAddrs
+	}
+	return b.createRun(ctx, runOptions)
+}
+
+// Plan queues a plan-only run of the configuration version
+func (b *TerraformCloud) Plan(ctx context.Context, configurationVersionID string, message string) (*Run, error) {
+	return b.createRun(ctx, tfc.RunCreateOptions{
+		Message:              tfc.String(message),
+		PlanOnly:             tfc.Bool(true),
+		ConfigurationVersion: &tfc.ConfigurationVersion{ID: configurationVersionID},
+	})
+}
+
+// Destroy queues a destroy run of the latest configuration version of the workspace. No run is
+// queued while the workspace has no current state version, as no run has created any resources.
+func (b *TerraformCloud) Destroy(ctx context.Context, configurationVersionID string, options RunOptions) (*Run, error) {
+	ws, err := b.client.Workspaces.ReadByID(ctx, b.workspaceID)
+	if err != nil {
+		return nil, b.workspaceErr(fmt.Errorf("could not read Terraform Cloud workspace: %w", err))
+	}
+	if ws.CurrentStateVersion == nil {
+		return nil, nil
+	}
+	return b.createRun(ctx, tfc.RunCreateOptions{
+		Message:   tfc.String(options.Message),
+		AutoApply: tfc.Bool(options.AutoApply),
+		IsDestroy: tfc.Bool(true),
+	})
+}
+
+// ReadRun reads the run from Terraform Cloud
+func (b *TerraformCloud) ReadRun(ctx context.Context, runID string) (*Run, error) {
+	run, err := b.client.Runs.Read(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	return runFromTFC(run), nil
+}
+
+// PlanJSON reads the JSON output of the plan of the run
+func (b *TerraformCloud) PlanJSON(ctx context.Context, run *Run) ([]byte, error) {
+	return b.client.Plans.ReadJSONOutput(ctx, run.PlanID)
+}
+
+// stateVersion returns the state version produced by the run. Runs that applied without
+// changes do not create a state version, so the current state version of the workspace is used.
+func (b *TerraformCloud) stateVersion(ctx context.Context, run *Run) (*tfc.StateVersion, error) {
+	if !run.HasChanges {
+		ws, err := b.client.Workspaces.ReadByID(ctx, b.workspaceID)
+		if err != nil {
+			return nil, b.workspaceErr(fmt.Errorf("could not read Terraform Cloud workspace: %w", err))
+		}
+		if ws.CurrentStateVersion == nil {
+			return nil, fmt.Errorf("%w: workspace %s has no current state version", errStateVersionNotReady, b.workspace)
+		}
+		return b.client.StateVersions.Read(ctx, ws.CurrentStateVersion.ID)
+	}
+
+	stateVersions, err := b.client.StateVersions.List(ctx, &tfc.StateVersionListOptions{
+		ListOptions:  tfc.ListOptions{PageSize: 20},
+		Organization: b.organization,
+		Workspace:    b.workspace,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, sv := range stateVersions.Items {
+		if sv.Run != nil && sv.Run.ID == run.ID {
+			return sv, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no state version found for run %s", errStateVersionNotReady, run.ID)
+}
+
+// Outputs reads the outputs of the state version produced by the run. Sensitive outputs are
+// listed without a value, so each of them is read individually.
+func (b *TerraformCloud) Outputs(ctx context.Context, run *Run, stateVersionID string) (string, map[string]any, error) {
+	var sv *tfc.StateVersion
+	var err error
+	if stateVersionID == "" {
+		sv, err = b.stateVersion(ctx, run)
+	} else {
+		sv, err = b.client.StateVersions.Read(ctx, stateVersionID)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if !sv.ResourcesProcessed {
+		return sv.ID, nil, fmt.Errorf("%w: state version %s has not been processed yet", errStateVersionNotReady, sv.ID)
+	}
+
+	values := map[string]any{}
+	options := &tfc.StateVersionOutputsListOptions{ListOptions: tfc.ListOptions{PageSize: 100}}
+	for {
+		outputs, err := b.client.StateVersions.ListOutputs(ctx, sv.ID, options)
+		if err != nil {
+			return sv.ID, nil, err
+		}
+		for _, o := range outputs.Items {
+			if o.Sensitive && o.Value == nil {
+				o, err = b.client.StateVersionOutputs.Read(ctx, o.ID)
+				if err != nil {
+					return sv.ID, nil, fmt.Errorf("could not read sensitive output: %w", err)
+				}
+			}
+			values[o.Name] = o.Value
+		}
+		if outputs.Pagination == nil || outputs.NextPage == 0 {
+			break
+		}
+		options.PageNumber = outputs.NextPage
+	}
+	return sv.ID, values, nil
+}
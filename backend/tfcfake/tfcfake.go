@@ -0,0 +1,486 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Package tfcfake is an in-memory fake of the parts of the Terraform Cloud API used by the
+// Terraform Cloud backend: workspaces, variables, configuration versions, runs, plans and
+// state versions with their outputs. Runs do not progress on their own; tests finish them
+// with FinishRun.
+package tfcfake
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	tfc "github.com/hashicorp/go-tfe"
+
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/backend"
+)
+
+// TerraformCloud holds the state of the fake
+type TerraformCloud struct {
+	mu sync.Mutex
+
+	nextID                int
+	workspaces            map[string]*tfc.Workspace
+	variables             map[string][]*tfc.Variable
+	configurationVersions map[string]*tfc.ConfigurationVersion
+	uploads               map[string]map[string]string
+	runs                  []*tfc.Run
+	planJSON              map[string][]byte
+	stateVersions         []*tfc.StateVersion
+	errors                map[string]error
+}
+
+// New returns an empty fake
+func New() *TerraformCloud {
+	return &TerraformCloud{
+		workspaces:            map[string]*tfc.Workspace{},
+		variables:             map[string][]*tfc.Variable{},
+		configurationVersions: map[string]*tfc.ConfigurationVersion{},
+		uploads:               map[string]map[string]string{},
+		planJSON:              map[string][]byte{},
+		errors:                map[string]error{},
+	}
+}
+
+// Client returns a go-tfe client whose services are backed by the fake. Methods the fake
+// does not implement panic.
+func (f *TerraformCloud) Client() *tfc.Client {
+	return &tfc.Client{
+		Workspaces:            workspaces{f: f},
+		Variables:             variables{f: f},
+		VariableSets:          variableSets{f: f},
+		VariableSetVariables:  variableSetVariables{f: f},
+		ConfigurationVersions: configurationVersions{f: f},
+		Runs:                  runs{f: f},
+		Plans:                 plans{f: f},
+		StateVersions:         stateVersions{f: f},
+		StateVersionOutputs:   stateVersionOutputs{f: f},
+	}
+}
+
+// ClientFactory returns a factory creating clients backed by the fake for any configuration
+func (f *TerraformCloud) ClientFactory() backend.TFCClientFactory {
+	return func(config *tfc.Config) (*tfc.Client, error) {
+		return f.Client(), nil
+	}
+}
+
+// id returns a new ID with the prefix, e.g. run-1. The lock must be held.
+func (f *TerraformCloud) id(prefix string) string {
+	f.nextID++
+	return fmt.Sprintf("%s-%d", prefix, f.nextID)
+}
+
+// SetError makes the method, e.g. "Runs.Create", fail with err until it is set to nil
+func (f *TerraformCloud) SetError(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.errors, method)
+		return
+	}
+	f.errors[method] = err
+}
+
+// err returns the error set for the method. The lock must be held.
+func (f *TerraformCloud) err(method string) error {
+	return f.errors[method]
+}
+
+// CreateWorkspace adds a workspace to the organization
+func (f *TerraformCloud) CreateWorkspace(organization, name string) *tfc.Workspace {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ws := &tfc.Workspace{
+		ID:           f.id("ws"),
+		Name:         name,
+		Organization: &tfc.Organization{Name: organization},
+	}
+	f.workspaces[organization+"/"+name] = ws
+	return ws
+}
+
+// SetVariable sets a Terraform variable of the workspace
+func (f *TerraformCloud) SetVariable(workspaceID, key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, v := range f.variables[workspaceID] {
+		if v.Key == key {
+			v.Value = value
+			return
+		}
+	}
+	f.variables[workspaceID] = append(f.variables[workspaceID], &tfc.Variable{
+		ID:       f.id("var"),
+		Key:      key,
+		Value:    value,
+		Category: tfc.CategoryTerraform,
+	})
+}
+
+// Uploads returns the files uploaded to the configuration version
+func (f *TerraformCloud) Uploads(configurationVersionID string) map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.uploads[configurationVersionID]
+}
+
+// Runs returns the runs of every workspace in the order they were created
+func (f *TerraformCloud) Runs() []tfc.Run {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	runs := []tfc.Run{}
+	for _, r := range f.runs {
+		runs = append(runs, *r)
+	}
+	return runs
+}
+
+// FinishRun sets the status of the run. Runs that have planned without applying can be confirmed,
+// runs that finished planning report no changes, and applied runs create a state version with the outputs that becomes the current state version
+// of the workspace. planJSON is returned as the JSON plan of the run, if set.
+func (f *TerraformCloud) FinishRun(runID string, status tfc.RunStatus, outputs map[string]any, planJSON []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	run := f.run(runID)
+	if run == nil {
+		return tfc.ErrResourceNotFound
+	}
+	run.Status = status
+	run.HasChanges = status != tfc.RunPlannedAndFinished
+	switch status {
+	case tfc.RunPlanned, tfc.RunCostEstimated, tfc.RunPolicyChecked:
+		run.Actions = &tfc.RunActions{IsConfirmable: true}
+	default:
+		run.Actions = &tfc.RunActions{}
+	}
+	if planJSON != nil {
+		f.planJSON[run.Plan.ID] = planJSON
+	}
+	if status != tfc.RunApplied {
+		return nil
+	}
+
+	sv := &tfc.StateVersion{
+		ID:                 f.id("sv"),
+		Serial:             int64(len(f.stateVersions) + 1),
+		ResourcesProcessed: true,
+		Run:                &tfc.Run{ID: run.ID},
+	}
+	for name, value := range outputs {
+		sv.Outputs = append(sv.Outputs, &tfc.StateVersionOutput{
+			ID:    f.id("wsout"),
+			Name:  name,
+			Value: value,
+		})
+	}
+	f.stateVersions = append(f.stateVersions, sv)
+	run.Workspace.CurrentStateVersion = &tfc.StateVersion{ID: sv.ID}
+	return nil
+}
+
+// run returns the run with the ID. The lock must be held.
+func (f *TerraformCloud) run(runID string) *tfc.Run {
+	for _, r := range f.runs {
+		if r.ID == runID {
+			return r
+		}
+	}
+	return nil
+}
+
+type workspaces struct {
+	tfc.Workspaces
+	f *TerraformCloud
+}
+
+func (s workspaces) Read(ctx context.Context, organization, workspace string) (*tfc.Workspace, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if err := s.f.err("Workspaces.Read"); err != nil {
+		return nil, err
+	}
+	ws, ok := s.f.workspaces[organization+"/"+workspace]
+	if !ok {
+		return nil, tfc.ErrResourceNotFound
+	}
+	copy := *ws
+	return &copy, nil
+}
+
+func (s workspaces) ReadByID(ctx context.Context, workspaceID string) (*tfc.Workspace, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if err := s.f.err("Workspaces.ReadByID"); err != nil {
+		return nil, err
+	}
+	for _, ws := range s.f.workspaces {
+		if ws.ID == workspaceID {
+			copy := *ws
+			return &copy, nil
+		}
+	}
+	return nil, tfc.ErrResourceNotFound
+}
+
+type variables struct {
+	tfc.Variables
+	f *TerraformCloud
+}
+
+func (s variables) List(ctx context.Context, workspaceID string, options *tfc.VariableListOptions) (*tfc.VariableList, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if err := s.f.err("Variables.List"); err != nil {
+		return nil, err
+	}
+	list := &tfc.VariableList{}
+	for _, v := range s.f.variables[workspaceID] {
+		copy := *v
+		list.Items = append(list.Items, &copy)
+	}
+	return list, nil
+}
+
+type variableSets struct {
+	tfc.VariableSets
+	f *TerraformCloud
+}
+
+func (s variableSets) ListForWorkspace(ctx context.Context, workspaceID string, options *tfc.VariableSetListOptions) (*tfc.VariableSetList, error) {
+	return &tfc.VariableSetList{}, nil
+}
+
+type variableSetVariables struct {
+	tfc.VariableSetVariables
+	f *TerraformCloud
+}
+
+func (s variableSetVariables) List(ctx context.Context, variableSetID string, options *tfc.VariableSetVariableListOptions) (*tfc.VariableSetVariableList, error) {
+	return &tfc.VariableSetVariableList{}, nil
+}
+
+type configurationVersions struct {
+	tfc.ConfigurationVersions
+	f *TerraformCloud
+}
+
+func (s configurationVersions) Create(ctx context.Context, workspaceID string, options tfc.ConfigurationVersionCreateOptions) (*tfc.ConfigurationVersion, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if err := s.f.err("ConfigurationVersions.Create"); err != nil {
+		return nil, err
+	}
+	id := s.f.id("cv")
+	cv := &tfc.ConfigurationVersion{
+		ID:        id,
+		Status:    tfc.ConfigurationPending,
+		UploadURL: "fake://upload/" + id,
+	}
+	s.f.configurationVersions[id] = cv
+	copy := *cv
+	return &copy, nil
+}
+
+func (s configurationVersions) Upload(ctx context.Context, url string, path string) error {
+	files := map[string]string{}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		content, err := os.ReadFile(filepath.Join(path, e.Name()))
+		if err != nil {
+			return err
+		}
+		files[e.Name()] = string(content)
+	}
+
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if err := s.f.err("ConfigurationVersions.Upload"); err != nil {
+		return err
+	}
+	id := strings.TrimPrefix(url, "fake://upload/")
+	cv, ok := s.f.configurationVersions[id]
+	if !ok {
+		return tfc.ErrResourceNotFound
+	}
+	cv.Status = tfc.ConfigurationUploaded
+	s.f.uploads[id] = files
+	return nil
+}
+
+func (s configurationVersions) Read(ctx context.Context, cvID string) (*tfc.ConfigurationVersion, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	cv, ok := s.f.configurationVersions[cvID]
+	if !ok {
+		return nil, tfc.ErrResourceNotFound
+	}
+	copy := *cv
+	return &copy, nil
+}
+
+type runs struct {
+	tfc.Runs
+	f *TerraformCloud
+}
+
+func (s runs) Create(ctx context.Context, options tfc.RunCreateOptions) (*tfc.Run, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if err := s.f.err("Runs.Create"); err != nil {
+		return nil, err
+	}
+	if options.Workspace == nil {
+		return nil, tfc.ErrRequiredWorkspace
+	}
+	var workspace *tfc.Workspace
+	for _, ws := range s.f.workspaces {
+		if ws.ID == options.Workspace.ID {
+			workspace = ws
+		}
+	}
+	if workspace == nil {
+		return nil, tfc.ErrResourceNotFound
+	}
+	run := &tfc.Run{
+		ID:                   s.f.id("run"),
+		Status:               tfc.RunPending,
+		HasChanges:           true,
+		Message:              stringValue(options.Message),
+		AutoApply:            boolValue(options.AutoApply),
+		IsDestroy:            boolValue(options.IsDestroy),
+		RefreshOnly:          boolValue(options.RefreshOnly),
+		PlanOnly:             boolValue(options.PlanOnly),
+		ReplaceAddrs:         options.ReplaceAddrs,
+		TargetAddrs:          options.TargetAddrs,
+		ConfigurationVersion: options.ConfigurationVersion,
+		Plan:                 &tfc.Plan{ID: s.f.id("plan")},
+		Workspace:            workspace,
+	}
+	s.f.runs = append(s.f.runs, run)
+	copy := *run
+	return &copy, nil
+}
+
+func (s runs) Read(ctx context.Context, runID string) (*tfc.Run, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if err := s.f.err("Runs.Read"); err != nil {
+		return nil, err
+	}
+	run := s.f.run(runID)
+	if run == nil {
+		return nil, tfc.ErrResourceNotFound
+	}
+	copy := *run
+	return &copy, nil
+}
+
+type plans struct {
+	tfc.Plans
+	f *TerraformCloud
+}
+
+func (s plans) ReadJSONOutput(ctx context.Context, planID string) ([]byte, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if plan, ok := s.f.planJSON[planID]; ok {
+		return plan, nil
+	}
+	return []byte(`{"resource_changes":[]}`), nil
+}
+
+type stateVersions struct {
+	tfc.StateVersions
+	f *TerraformCloud
+}
+
+// stateVersion returns the state version with the ID. The lock must be held.
+func (f *TerraformCloud) stateVersion(svID string) *tfc.StateVersion {
+	for _, sv := range f.stateVersions {
+		if sv.ID == svID {
+			return sv
+		}
+	}
+	return nil
+}
+
+func (s stateVersions) List(ctx context.Context, options *tfc.StateVersionListOptions) (*tfc.StateVersionList, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	list := &tfc.StateVersionList{}
+	for i := len(s.f.stateVersions) - 1; i >= 0; i-- {
+		sv := s.f.stateVersions[i]
+		run := s.f.run(sv.Run.ID)
+		if run.Workspace.Name != options.Workspace || run.Workspace.Organization.Name != options.Organization {
+			continue
+		}
+		copy := *sv
+		list.Items = append(list.Items, &copy)
+	}
+	return list, nil
+}
+
+func (s stateVersions) Read(ctx context.Context, svID string) (*tfc.StateVersion, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	sv := s.f.stateVersion(svID)
+	if sv == nil {
+		return nil, tfc.ErrResourceNotFound
+	}
+	copy := *sv
+	return &copy, nil
+}
+
+func (s stateVersions) ListOutputs(ctx context.Context, svID string, options *tfc.StateVersionOutputsListOptions) (*tfc.StateVersionOutputsList, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	sv := s.f.stateVersion(svID)
+	if sv == nil {
+		return nil, tfc.ErrResourceNotFound
+	}
+	list := &tfc.StateVersionOutputsList{}
+	for _, o := range sv.Outputs {
+		copy := *o
+		list.Items = append(list.Items, &copy)
+	}
+	return list, nil
+}
+
+type stateVersionOutputs struct {
+	tfc.StateVersionOutputs
+	f *TerraformCloud
+}
+
+func (s stateVersionOutputs) Read(ctx context.Context, outputID string) (*tfc.StateVersionOutput, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	for _, sv := range s.f.stateVersions {
+		for _, o := range sv.Outputs {
+			if o.ID == outputID {
+				copy := *o
+				return &copy, nil
+			}
+		}
+	}
+	return nil, tfc.ErrResourceNotFound
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func boolValue(b *bool) bool {
+	return b != nil && *b
+}
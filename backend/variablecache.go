@@ -0,0 +1,76 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package backend
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	tfc "github.com/hashicorp/go-tfe"
+
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/terraform"
+)
+
+// DefaultVariablesTTL is how long the variables of a workspace are cached
+const DefaultVariablesTTL = 5 * time.Minute
+
+// variablesKey identifies the variables of a workspace read with a client. Variables read
+// with the client of a previous token are not reused.
+type variablesKey struct {
+	client      *tfc.Client
+	workspaceID string
+}
+
+// cachedVariables are the variables of a workspace and when they were listed
+type cachedVariables struct {
+	variables []terraform.WorkspaceVariable
+	listedAt  time.Time
+}
+
+// VariableCache caches the variables of workspaces and of their variable sets, which take a
+// request per variable set to list, so that they are not listed on every reconcile. Changed
+// variables are picked up once the cached list has expired.
+type VariableCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[variablesKey]cachedVariables
+}
+
+// NewVariableCache returns a cache keeping the variables of a workspace for the TTL
+func NewVariableCache(ttl time.Duration) *VariableCache {
+	return &VariableCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[variablesKey]cachedVariables{},
+	}
+}
+
+// get returns the cached variables, listing them again with list once they have expired.
+// Expired variables of other workspaces are dropped.
+func (c *VariableCache) get(ctx context.Context, key variablesKey, list func(ctx context.Context) ([]terraform.WorkspaceVariable, error)) ([]terraform.WorkspaceVariable, error) {
+	c.mu.Lock()
+	now := c.now()
+	for k, e := range c.entries {
+		if now.Sub(e.listedAt) >= c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok {
+		return e.variables, nil
+	}
+
+	variables, err := list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cachedVariables{variables: variables, listedAt: now}
+	return variables, nil
+}
@@ -0,0 +1,74 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	tfc "github.com/hashicorp/go-tfe"
+
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/terraform"
+)
+
+func TestVariableCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	cache := NewVariableCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	lists := 0
+	var listErr error
+	list := func(ctx context.Context) ([]terraform.WorkspaceVariable, error) {
+		lists++
+		if listErr != nil {
+			return nil, listErr
+		}
+		return []terraform.WorkspaceVariable{{ID: "var-1", Key: "region", Value: "europe-west1"}}, nil
+	}
+	key := variablesKey{client: &tfc.Client{}, workspaceID: "ws-1"}
+
+	for i := 0; i < 2; i++ {
+		variables, err := cache.get(ctx, key, list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(variables) != 1 || variables[0].Key != "region" {
+			t.Errorf("unexpected variables %+v", variables)
+		}
+	}
+	if lists != 1 {
+		t.Errorf("expected the variables to be listed once, got %d", lists)
+	}
+
+	// another workspace, or the same workspace read with the client of another token, is listed separately
+	if _, err := cache.get(ctx, variablesKey{client: key.client, workspaceID: "ws-2"}, list); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.get(ctx, variablesKey{client: &tfc.Client{}, workspaceID: "ws-1"}, list); err != nil {
+		t.Fatal(err)
+	}
+	if lists != 3 {
+		t.Errorf("expected each key to be listed, got %d lists", lists)
+	}
+
+	// expired variables are listed again, and errors are not cached
+	now = now.Add(time.Minute)
+	listErr = errors.New("service unavailable")
+	if _, err := cache.get(ctx, key, list); err == nil {
+		t.Error("expected the error to be returned")
+	}
+	if len(cache.entries) != 0 {
+		t.Errorf("expected expired variables to be dropped, got %d entries", len(cache.entries))
+	}
+	listErr = nil
+	if _, err := cache.get(ctx, key, list); err != nil {
+		t.Fatal(err)
+	}
+	if lists != 5 {
+		t.Errorf("expected the expired variables to be listed again, got %d lists", lists)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/backend"
+)
+
+// backendObject is implemented by the resources whose Terraform runs are executed by a backend
+type backendObject interface {
+	client.Object
+	GetBackend() infrastructurev1alpha1.Backend
+}
+
+// newBackend returns the backend executing the Terraform runs of obj. Terraform Cloud is
+// accessed with the token, and optionally the address, read from the terraform-cloud-token
+// Secret in its namespace. The ID of the workspace is cached in status, and its variables in the
+// client cache.
+func newBackend(ctx context.Context, c client.Client, clients *backend.ClientCache, pods corev1client.PodsGetter, scheme *runtime.Scheme, obj backendObject, organization, workspace string, status *infrastructurev1alpha1.TerraformStatus) (backend.Backend, error) {
+	if spec := obj.GetBackend(); spec.IsLocal() {
+		return backend.NewLocal(c, pods, scheme, obj, spec.Local, workspace), nil
+	}
+
+	// read the token secret
+	var tokenSecret corev1.Secret
+	secretKey := types.NamespacedName{Name: terraformCloudTokenSecretName, Namespace: obj.GetNamespace()}
+	err := c.Get(ctx, secretKey, &tokenSecret)
+	if err != nil {
+		return nil, fmt.Errorf("could not find token Secret object: %w", err)
+	}
+	token := string(tokenSecret.Data["value"])
+	address := string(tokenSecret.Data["address"])
+
+	// get the TFC client, reusing the one created by an earlier reconcile
+	tfcClient, err := clients.Client(secretKey, address, organization, token)
+	if err != nil {
+		return nil, fmt.Errorf("could not create Terraform Cloud client: %w", err)
+	}
+
+	// the cached workspace ID is only valid for the workspace it was looked up for
+	name := organization + "/" + workspace
+	workspaceID := ""
+	if status.Workspace == name {
+		workspaceID = status.WorkspaceID
+	}
+	tfBackend, err := backend.NewTerraformCloud(ctx, tfcClient, organization, workspace, workspaceID, clients.Variables())
+	if err != nil {
+		return nil, err
+	}
+	status.Workspace = name
+	status.WorkspaceID = tfBackend.WorkspaceID()
+	return tfBackend, nil
+}
+
+// forgetMissingWorkspace clears the workspace ID cached in status once Terraform Cloud no longer
+// found the workspace, so that it is looked up by name again on the next reconcile
+func forgetMissingWorkspace(b backend.Backend, status *infrastructurev1alpha1.TerraformStatus) {
+	if tfBackend, ok := b.(*backend.TerraformCloud); ok && tfBackend.WorkspaceNotFound() {
+		status.Workspace = ""
+		status.WorkspaceID = ""
+	}
+}
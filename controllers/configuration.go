@@ -0,0 +1,102 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+// configurationSource is implemented by the resources whose configuration is read from
+// ConfigMaps and Secrets
+type configurationSource interface {
+	client.Object
+	GetTemplateRef() *infrastructurev1alpha1.TemplateReference
+	GetExtraFiles() []infrastructurev1alpha1.ExtraFile
+}
+
+// referencesConfigMap returns true if the object's configuration is read from the named ConfigMap
+func referencesConfigMap(obj configurationSource, name string) bool {
+	if ref := obj.GetTemplateRef(); ref != nil && ref.Name == name {
+		return true
+	}
+	for _, f := range obj.GetExtraFiles() {
+		if f.ConfigMapKeyRef != nil && f.ConfigMapKeyRef.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// referencesSecret returns true if any of the object's extra files is read from the named Secret
+func referencesSecret(obj configurationSource, name string) bool {
+	for _, f := range obj.GetExtraFiles() {
+		if f.SecretKeyRef != nil && f.SecretKeyRef.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// configurationSourceToObjectsMapFunc returns a handler.MapFunc that enqueues every watched object
+// of the supplied list type whose configuration is read from a changed ConfigMap or Secret.
+func configurationSourceToObjectsMapFunc(ctx context.Context, c client.Client, list client.ObjectList, watchFilterValue string) handler.MapFunc {
+	logger := ctrl.LoggerFrom(ctx)
+	return func(o client.Object) []reconcile.Request {
+		var references func(configurationSource, string) bool
+		switch o.(type) {
+		case *corev1.ConfigMap:
+			references = referencesConfigMap
+		case *corev1.Secret:
+			references = referencesSecret
+		default:
+			return nil
+		}
+
+		l := list.DeepCopyObject().(client.ObjectList)
+		if err := c.List(ctx, l, watchedObjectsInNamespace(o.GetNamespace(), watchFilterValue)...); err != nil {
+			logger.Error(err, "Could not list objects referencing configuration source", "name", o.GetName())
+			return nil
+		}
+		items, err := meta.ExtractList(l)
+		if err != nil {
+			return nil
+		}
+
+		requests := []reconcile.Request{}
+		for _, item := range items {
+			obj, ok := item.(configurationSource)
+			if !ok || !references(obj, o.GetName()) {
+				continue
+			}
+			requests = append(requests, reconcile.Request{
+				NamespacedName: client.ObjectKeyFromObject(obj),
+			})
+		}
+		return requests
+	}
+}
+
+// changedConfigurationInputs returns the names of the inputs whose hashes differ
+func changedConfigurationInputs(previous, current infrastructurev1alpha1.ConfigurationHashes) []string {
+	changed := []string{}
+	if previous.Configuration != current.Configuration {
+		changed = append(changed, "configuration")
+	}
+	if previous.ExtraFiles != current.ExtraFiles {
+		changed = append(changed, "extraFiles")
+	}
+	if previous.Variables != current.Variables {
+		changed = append(changed, "variables")
+	}
+	return changed
+}
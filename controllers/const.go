@@ -5,3 +5,7 @@ package controllers
 
 const terraformCloudRunMessage = "Kubernetes Cluster API"
 const terraformCloudTokenSecretName = "terraform-cloud-token"
+
+// annotations set on a MachinePool by users of the Cluster API cluster-autoscaler provider
+const autoscalerMinSizeAnnotation = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size"
+const autoscalerMaxSizeAnnotation = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size"
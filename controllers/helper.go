@@ -7,27 +7,103 @@ import (
 	"context"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-func requeueAfterSeconds(seconds int) (ctrl.Result, error) {
+// RequeueIntervals are how long the controllers wait before reconciling a resource again
+type RequeueIntervals struct {
+	// Short is used to wait for what is expected to be ready soon, such as a state version
+	// or the control plane of a machine pool
+	Short time.Duration
+	// Default is used to poll runs and to retry after errors
+	Default time.Duration
+	// Long is used to wait for a configuration version or a new run to be processed
+	Long time.Duration
+}
+
+// DefaultRequeueIntervals are the intervals used when none are configured
+var DefaultRequeueIntervals = RequeueIntervals{
+	Short:   10 * time.Second,
+	Default: 30 * time.Second,
+	Long:    60 * time.Second,
+}
+
+// withDefaults returns the intervals with the unset ones replaced by DefaultRequeueIntervals
+func (i RequeueIntervals) withDefaults() RequeueIntervals {
+	if i.Short <= 0 {
+		i.Short = DefaultRequeueIntervals.Short
+	}
+	if i.Default <= 0 {
+		i.Default = DefaultRequeueIntervals.Default
+	}
+	if i.Long <= 0 {
+		i.Long = DefaultRequeueIntervals.Long
+	}
+	return i
+}
+
+func requeueAfter(interval time.Duration) (ctrl.Result, error) {
 	return ctrl.Result{
 		Requeue:      true,
-		RequeueAfter: time.Duration(seconds) * time.Second,
+		RequeueAfter: interval,
 	}, nil
 }
 
-func addFinalizer(ctx context.Context, c client.Client, obj client.Object, finalizer string) {
+func addFinalizer(obj client.Object, finalizer string) {
 	if !obj.GetDeletionTimestamp().IsZero() {
 		return
 	}
 
-	if controllerutil.ContainsFinalizer(obj, finalizer) {
-		return
+	controllerutil.AddFinalizer(obj, finalizer)
+}
+
+// watchedObjectsInNamespace returns the options listing the objects of a namespace that
+// carry the watch filter label, if one is set.
+func watchedObjectsInNamespace(namespace, watchFilterValue string) []client.ListOption {
+	opts := []client.ListOption{client.InNamespace(namespace)}
+	if watchFilterValue != "" {
+		opts = append(opts, client.MatchingLabels{clusterv1beta1.WatchLabel: watchFilterValue})
 	}
+	return opts
+}
 
-	controllerutil.AddFinalizer(obj, finalizer)
-	c.Update(ctx, obj)
+// tokenSecretToObjectsMapFunc returns a handler.MapFunc that enqueues every watched object
+// of the supplied list type in the namespace of a changed Terraform Cloud token Secret.
+func tokenSecretToObjectsMapFunc(ctx context.Context, c client.Client, list client.ObjectList, watchFilterValue string) handler.MapFunc {
+	logger := ctrl.LoggerFrom(ctx)
+	return func(o client.Object) []reconcile.Request {
+		secret, ok := o.(*corev1.Secret)
+		if !ok || secret.Name != terraformCloudTokenSecretName {
+			return nil
+		}
+
+		l := list.DeepCopyObject().(client.ObjectList)
+		if err := c.List(ctx, l, watchedObjectsInNamespace(secret.Namespace, watchFilterValue)...); err != nil {
+			logger.Error(err, "Could not list objects referencing token Secret", "secret", secret.Name)
+			return nil
+		}
+		items, err := meta.ExtractList(l)
+		if err != nil {
+			return nil
+		}
+
+		requests := []reconcile.Request{}
+		for _, item := range items {
+			obj, ok := item.(client.Object)
+			if !ok {
+				continue
+			}
+			requests = append(requests, reconcile.Request{
+				NamespacedName: client.ObjectKeyFromObject(obj),
+			})
+		}
+		return requests
+	}
 }
@@ -0,0 +1,41 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+func TestTokenSecretToObjectsMapFuncWatchFilter(t *testing.T) {
+	labelled := &infrastructurev1alpha1.TFCManagedControlPlane{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "labelled",
+			Namespace: "default",
+			Labels:    map[string]string{clusterv1beta1.WatchLabel: "shard"},
+		},
+	}
+	unlabelled := &infrastructurev1alpha1.TFCManagedControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "unlabelled", Namespace: "default"},
+	}
+	c := rollbackTestClient(t, labelled, unlabelled)
+	// the token Secret itself is not labelled
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: terraformCloudTokenSecretName, Namespace: "default"}}
+
+	requests := tokenSecretToObjectsMapFunc(context.Background(), c, &infrastructurev1alpha1.TFCManagedControlPlaneList{}, "shard")(secret)
+	if len(requests) != 1 || requests[0].Name != "labelled" {
+		t.Errorf("expected only the labelled control plane to be enqueued, got %v", requests)
+	}
+
+	requests = tokenSecretToObjectsMapFunc(context.Background(), c, &infrastructurev1alpha1.TFCManagedControlPlaneList{}, "")(secret)
+	if len(requests) != 2 {
+		t.Errorf("expected every control plane to be enqueued without a watch filter, got %v", requests)
+	}
+}
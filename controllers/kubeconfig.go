@@ -0,0 +1,185 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	kcfg "sigs.k8s.io/cluster-api/util/kubeconfig"
+	"sigs.k8s.io/cluster-api/util/secret"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+// kubeconfigFieldOwner is the field manager used when applying the kubeconfig Secret
+const kubeconfigFieldOwner = "terraform-cloud-cluster"
+
+// reconcileKubeconfig applies the `<cluster>-kubeconfig` Secret following the Cluster API kubeconfig
+// contract: it is named after the Cluster, labelled with the cluster name, has the cluster secret
+// type and is owned by the control plane so it is deleted with it.
+func (r *TFCManagedControlPlaneReconciler) reconcileKubeconfig(ctx context.Context, cluster *infrastructurev1alpha1.TFCManagedControlPlane, ownerCluster *clusterv1beta1.Cluster, data []byte) error {
+	owner := metav1.NewControllerRef(cluster, infrastructurev1alpha1.GroupVersion.WithKind("TFCManagedControlPlane"))
+	desired := kcfg.GenerateSecretWithOwner(util.ObjectKey(ownerCluster), data, *owner)
+	desired.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"}
+
+	// earlier versions created an untyped Secret named after the control plane; the type of a
+	// Secret is immutable so it has to be deleted before the compliant Secret can be applied
+	for _, name := range []string{desired.Name, secret.Name(cluster.Name, secret.Kubeconfig)} {
+		var existing corev1.Secret
+		err := r.Client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: name}, &existing)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if existing.Type == clusterv1beta1.ClusterSecretType {
+			continue
+		}
+		if err := client.IgnoreNotFound(r.Client.Delete(ctx, &existing)); err != nil {
+			return fmt.Errorf("could not delete legacy kubeconfig Secret %s: %w", name, err)
+		}
+	}
+
+	return r.Client.Patch(ctx, desired, client.Apply, client.FieldOwner(kubeconfigFieldOwner), client.ForceOwnership)
+}
+
+// kubeconfigFromOutputs returns the kubeconfig read from the kubeconfig output or, when the kubeconfig
+// is generated, assembled from the endpoint, CA certificate and token outputs. The CA certificate is
+// also published in the Cluster's CA Secret and the expiry of the token recorded in status.
+func (r *TFCManagedControlPlaneReconciler) kubeconfigFromOutputs(ctx context.Context, cluster *infrastructurev1alpha1.TFCManagedControlPlane, ownerCluster *clusterv1beta1.Cluster, fields map[string]any) ([]byte, error) {
+	if !cluster.Spec.Kubeconfig.Generate {
+		kubeconfig, err := outputString(infrastructurev1alpha1.OutputFieldKubeconfig, fields[infrastructurev1alpha1.OutputFieldKubeconfig], false)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(kubeconfig), nil
+	}
+
+	ca, err := outputString(infrastructurev1alpha1.OutputFieldClusterCACertificate, fields[infrastructurev1alpha1.OutputFieldClusterCACertificate], false)
+	if err != nil {
+		return nil, err
+	}
+	caData, err := decodeCACertificate(ca)
+	if err != nil {
+		return nil, err
+	}
+	token, err := outputString(infrastructurev1alpha1.OutputFieldToken, fields[infrastructurev1alpha1.OutputFieldToken], false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.reconcileCASecret(ctx, cluster, ownerCluster, caData); err != nil {
+		return nil, fmt.Errorf("could not create CA Secret: %w", err)
+	}
+
+	cluster.Status.TokenExpiresAt = nil
+	if v, ok := fields[infrastructurev1alpha1.OutputFieldTokenExpiry]; ok {
+		s, err := outputString(infrastructurev1alpha1.OutputFieldTokenExpiry, v, false)
+		if err != nil {
+			return nil, err
+		}
+		expiry, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("output %q is not an RFC 3339 time: %w", infrastructurev1alpha1.OutputFieldTokenExpiry, err)
+		}
+		cluster.Status.TokenExpiresAt = &metav1.Time{Time: expiry}
+	} else if ttl := cluster.Spec.Kubeconfig.TokenTTL; ttl != nil {
+		cluster.Status.TokenExpiresAt = &metav1.Time{Time: cluster.Status.Terraform.RunFinishedAt.Add(ttl.Duration)}
+	}
+
+	return generateKubeconfig(ownerCluster.Name, cluster.Spec.ControlPlaneEndpoint, caData, token)
+}
+
+// decodeCACertificate returns the PEM encoded CA certificate from an output that is either
+// PEM encoded or base64 encoded PEM
+func decodeCACertificate(ca string) ([]byte, error) {
+	data := []byte(strings.TrimSpace(ca))
+	if !bytes.HasPrefix(data, []byte("-----BEGIN")) {
+		decoded, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("CA certificate is neither PEM nor base64 encoded: %w", err)
+		}
+		data = decoded
+	}
+	if block, _ := pem.Decode(data); block == nil {
+		return nil, fmt.Errorf("CA certificate does not contain a PEM block")
+	}
+	return data, nil
+}
+
+// generateKubeconfig returns a kubeconfig that authenticates to the API server with a bearer token
+func generateKubeconfig(clusterName string, endpoint clusterv1beta1.APIEndpoint, caData []byte, token string) ([]byte, error) {
+	if endpoint.IsZero() {
+		return nil, fmt.Errorf("control plane endpoint is not set")
+	}
+	userName := fmt.Sprintf("%s-admin", clusterName)
+	contextName := fmt.Sprintf("%s@%s", userName, clusterName)
+	config := clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			clusterName: {
+				Server:                   fmt.Sprintf("https://%s", endpoint.String()),
+				CertificateAuthorityData: caData,
+			},
+		},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			userName: {
+				Token: token,
+			},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			contextName: {
+				Cluster:  clusterName,
+				AuthInfo: userName,
+			},
+		},
+		CurrentContext: contextName,
+	}
+	return clientcmd.Write(config)
+}
+
+// reconcileCASecret applies the `<cluster>-ca` Secret containing the CA certificate of the API server
+func (r *TFCManagedControlPlaneReconciler) reconcileCASecret(ctx context.Context, cluster *infrastructurev1alpha1.TFCManagedControlPlane, ownerCluster *clusterv1beta1.Cluster, caData []byte) error {
+	owner := metav1.NewControllerRef(cluster, infrastructurev1alpha1.GroupVersion.WithKind("TFCManagedControlPlane"))
+	caSecret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ownerCluster.Namespace,
+			Name:      secret.Name(ownerCluster.Name, secret.ClusterCA),
+			Labels: map[string]string{
+				clusterv1beta1.ClusterLabelName: ownerCluster.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{*owner},
+		},
+		Data: map[string][]byte{
+			secret.TLSCrtDataName: caData,
+		},
+		Type: clusterv1beta1.ClusterSecretType,
+	}
+	return r.Client.Patch(ctx, caSecret, client.Apply, client.FieldOwner(kubeconfigFieldOwner), client.ForceOwnership)
+}
+
+// tokenRefreshIn returns how long until the token of the generated kubeconfig should be
+// refreshed, or nil if it does not expire
+func tokenRefreshIn(cluster *infrastructurev1alpha1.TFCManagedControlPlane) *time.Duration {
+	if !cluster.Spec.Kubeconfig.Generate || cluster.Status.TokenExpiresAt == nil {
+		return nil
+	}
+	d := time.Until(cluster.Status.TokenExpiresAt.Add(-cluster.Spec.Kubeconfig.GetRefreshBefore()))
+	return &d
+}
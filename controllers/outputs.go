@@ -0,0 +1,247 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+// outputsObjectName returns the name of the Secret and ConfigMap that mapped outputs are written to
+func outputsObjectName(owner client.Object) string {
+	return fmt.Sprintf("%s-outputs", owner.GetName())
+}
+
+// reconcileOutputs validates the output values against their mappings, writes them to the
+// outputs Secret, the outputs ConfigMap and the annotations of the owner Cluster, and returns
+// the values mapped to well-known fields keyed by field. Keys that are no longer mapped are
+// pruned: the Secret and ConfigMap hold only the mapped keys and are deleted when there are
+// none, and the Cluster annotations recorded in the status by earlier runs are removed.
+func reconcileOutputs(ctx context.Context, c client.Client, scheme *runtime.Scheme, owner client.Object, cluster *clusterv1beta1.Cluster, status *infrastructurev1alpha1.TerraformStatus, mappings []infrastructurev1alpha1.OutputMapping, values map[string]any) (map[string]any, error) {
+	fields := map[string]any{}
+	secretData := map[string][]byte{}
+	configMapData := map[string]string{}
+	clusterAnnotations := map[string]string{}
+
+	for _, m := range mappings {
+		destinations := 0
+		for _, d := range []string{m.Field, m.SecretKey, m.ConfigMapKey, m.ClusterAnnotation} {
+			if d != "" {
+				destinations++
+			}
+		}
+		if destinations != 1 {
+			return nil, fmt.Errorf("output %q must be mapped to exactly one of field, secretKey, configMapKey or clusterAnnotation", m.Name)
+		}
+
+		value, ok := values[m.Name]
+		if !ok {
+			return nil, fmt.Errorf("output %q was not found in the Terraform state", m.Name)
+		}
+		if err := checkOutputType(m, value); err != nil {
+			return nil, err
+		}
+
+		if m.Field != "" {
+			fields[m.Field] = value
+			continue
+		}
+		s, err := outputString(m.Name, value, true)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case m.SecretKey != "":
+			secretData[m.SecretKey] = []byte(s)
+		case m.ConfigMapKey != "":
+			configMapData[m.ConfigMapKey] = s
+		case m.ClusterAnnotation != "":
+			clusterAnnotations[m.ClusterAnnotation] = s
+		}
+	}
+
+	secret := &corev1.Secret{}
+	secret.Namespace = owner.GetNamespace()
+	secret.Name = outputsObjectName(owner)
+	if len(secretData) > 0 {
+		_, err := controllerutil.CreateOrUpdate(ctx, c, secret, func() error {
+			if secret.Labels == nil {
+				secret.Labels = map[string]string{}
+			}
+			secret.Labels[clusterv1beta1.ClusterLabelName] = cluster.Name
+			secret.Data = secretData
+			return controllerutil.SetControllerReference(owner, secret, scheme)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not write outputs Secret: %w", err)
+		}
+	} else if err := deleteOwnedObject(ctx, c, owner, secret); err != nil {
+		return nil, fmt.Errorf("could not delete outputs Secret: %w", err)
+	}
+
+	configMap := &corev1.ConfigMap{}
+	configMap.Namespace = owner.GetNamespace()
+	configMap.Name = outputsObjectName(owner)
+	if len(configMapData) > 0 {
+		_, err := controllerutil.CreateOrUpdate(ctx, c, configMap, func() error {
+			if configMap.Labels == nil {
+				configMap.Labels = map[string]string{}
+			}
+			configMap.Labels[clusterv1beta1.ClusterLabelName] = cluster.Name
+			configMap.Data = configMapData
+			return controllerutil.SetControllerReference(owner, configMap, scheme)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not write outputs ConfigMap: %w", err)
+		}
+	} else if err := deleteOwnedObject(ctx, c, owner, configMap); err != nil {
+		return nil, fmt.Errorf("could not delete outputs ConfigMap: %w", err)
+	}
+
+	// remove the annotations written by earlier runs that are no longer mapped
+	patch := client.MergeFrom(cluster.DeepCopy())
+	changed := false
+	for _, k := range status.ClusterAnnotations {
+		if _, ok := clusterAnnotations[k]; !ok {
+			if _, ok := cluster.Annotations[k]; ok {
+				delete(cluster.Annotations, k)
+				changed = true
+			}
+		}
+	}
+	owned := []string{}
+	for k, v := range clusterAnnotations {
+		if cluster.Annotations == nil {
+			cluster.Annotations = map[string]string{}
+		}
+		if current, ok := cluster.Annotations[k]; !ok || current != v {
+			cluster.Annotations[k] = v
+			changed = true
+		}
+		owned = append(owned, k)
+	}
+	if changed {
+		if err := c.Patch(ctx, cluster, patch); err != nil {
+			return nil, fmt.Errorf("could not annotate Cluster: %w", err)
+		}
+	}
+	sort.Strings(owned)
+	status.ClusterAnnotations = nil
+	if len(owned) > 0 {
+		status.ClusterAnnotations = owned
+	}
+
+	return fields, nil
+}
+
+// deleteOwnedObject deletes the object if it exists and is controlled by the owner
+func deleteOwnedObject(ctx context.Context, c client.Client, owner client.Object, obj client.Object) error {
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(obj, owner) {
+		return nil
+	}
+	return client.IgnoreNotFound(c.Delete(ctx, obj))
+}
+
+// checkOutputType returns an error if the value does not have the type declared in the mapping
+func checkOutputType(m infrastructurev1alpha1.OutputMapping, value any) error {
+	var ok bool
+	switch m.Type {
+	case "":
+		return nil
+	case infrastructurev1alpha1.OutputTypeString:
+		_, ok = value.(string)
+	case infrastructurev1alpha1.OutputTypeNumber:
+		_, ok = value.(float64)
+	case infrastructurev1alpha1.OutputTypeBool:
+		_, ok = value.(bool)
+	case infrastructurev1alpha1.OutputTypeList:
+		_, ok = value.([]any)
+	case infrastructurev1alpha1.OutputTypeObject:
+		_, ok = value.(map[string]any)
+	default:
+		return fmt.Errorf("output %q has unknown type %q", m.Name, m.Type)
+	}
+	if !ok {
+		return fmt.Errorf("output %q is %s, expected %s", m.Name, describeOutputType(value), m.Type)
+	}
+	return nil
+}
+
+// describeOutputType returns the Terraform type name of a decoded output value
+func describeOutputType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "a string"
+	case float64:
+		return "a number"
+	case bool:
+		return "a bool"
+	case []any:
+		return "a list"
+	case map[string]any:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// outputString returns the value of a string output. If encode is set, values of
+// other types are returned JSON encoded rather than as an error.
+func outputString(name string, value any, encode bool) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	if !encode || value == nil {
+		return "", fmt.Errorf("output %q is %s, expected a string", name, describeOutputType(value))
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("could not encode output %q: %w", name, err)
+	}
+	return string(b), nil
+}
+
+// outputInt32 returns the value of a number output that must be a 32-bit integer
+func outputInt32(name string, value any) (int32, error) {
+	n, ok := value.(float64)
+	if !ok {
+		return 0, fmt.Errorf("output %q is %s, expected a number", name, describeOutputType(value))
+	}
+	if n != float64(int32(n)) {
+		return 0, fmt.Errorf("output %q is %v, expected a 32-bit integer", name, n)
+	}
+	return int32(n), nil
+}
+
+// outputStringList returns the value of an output that must be a list of strings
+func outputStringList(name string, value any) ([]string, error) {
+	items, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("output %q is %s, expected a list of strings", name, describeOutputType(value))
+	}
+	list := []string{}
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("element %d of output %q is %s, expected a string", i, name, describeOutputType(item))
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+func TestReconcileOutputsPrunesUnmappedKeys(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{corev1.AddToScheme, clusterv1beta1.AddToScheme, infrastructurev1alpha1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	owner := &infrastructurev1alpha1.TFCManagedControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default", UID: "uid"},
+	}
+	cluster := &clusterv1beta1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "example",
+			Namespace:   "default",
+			Annotations: map[string]string{"example.com/owner": "team"},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(owner, cluster).Build()
+	values := map[string]any{"region": "us-east1", "password": "secret", "network": "default"}
+
+	mappings := []infrastructurev1alpha1.OutputMapping{
+		{Name: "region", ClusterAnnotation: "example.com/region"},
+		{Name: "region", ConfigMapKey: "region"},
+		{Name: "network", ConfigMapKey: "network"},
+		{Name: "password", SecretKey: "password"},
+	}
+	if _, err := reconcileOutputs(ctx, c, scheme, owner, cluster, &owner.Status.Terraform, mappings, values); err != nil {
+		t.Fatal(err)
+	}
+	if got := owner.Status.Terraform.ClusterAnnotations; len(got) != 1 || got[0] != "example.com/region" {
+		t.Errorf("expected the written annotation to be recorded, got %v", got)
+	}
+
+	// the annotation and the Secret are no longer mapped, nor is one of the ConfigMap keys
+	mappings = []infrastructurev1alpha1.OutputMapping{{Name: "network", ConfigMapKey: "network"}}
+	if _, err := reconcileOutputs(ctx, c, scheme, owner, cluster, &owner.Status.Terraform, mappings, values); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(cluster), cluster); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cluster.Annotations["example.com/region"]; ok {
+		t.Error("expected the unmapped annotation to be removed")
+	}
+	if cluster.Annotations["example.com/owner"] != "team" {
+		t.Error("expected annotations not written from outputs to be kept")
+	}
+	if owner.Status.Terraform.ClusterAnnotations != nil {
+		t.Errorf("expected no recorded annotations, got %v", owner.Status.Terraform.ClusterAnnotations)
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "example-outputs"}, configMap); err != nil {
+		t.Fatal(err)
+	}
+	if len(configMap.Data) != 1 || configMap.Data["network"] != "default" {
+		t.Errorf("expected only the mapped ConfigMap key, got %v", configMap.Data)
+	}
+	err := c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "example-outputs"}, &corev1.Secret{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected the outputs Secret to be deleted, got %v", err)
+	}
+}
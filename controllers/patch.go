@@ -0,0 +1,85 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+// ownedConditions are the conditions set by the controllers, which are kept over changes
+// made by other processes when they conflict
+var ownedConditions = []clusterv1beta1.ConditionType{
+	infrastructurev1alpha1.WorkloadClusterReadyCondition,
+	infrastructurev1alpha1.NodesReadyCondition,
+	infrastructurev1alpha1.VersionUpgradeCondition,
+	infrastructurev1alpha1.ConfigurationSyncedCondition,
+}
+
+// objectPatcher persists the changes made to a resource while it is reconciled. Changes to the
+// metadata, spec, status and conditions are sent as patches computed with the Cluster API patch
+// helper against the resource as it was read, or as it was last patched.
+type objectPatcher struct {
+	client client.Client
+	obj    client.Object
+	helper *patch.Helper
+}
+
+// newObjectPatcher returns a patcher for the changes made to obj from now on
+func newObjectPatcher(c client.Client, obj client.Object) (*objectPatcher, error) {
+	helper, err := patch.NewHelper(obj, c)
+	if err != nil {
+		return nil, err
+	}
+	return &objectPatcher{client: c, obj: obj, helper: helper}, nil
+}
+
+// patch persists the changes made since the resource was read or last patched
+func (p *objectPatcher) patch(ctx context.Context) error {
+	if err := p.helper.Patch(ctx, p.obj, patch.WithOwnedConditions{Conditions: ownedConditions}); err != nil {
+		return err
+	}
+	helper, err := patch.NewHelper(p.obj, p.client)
+	if err != nil {
+		return err
+	}
+	p.helper = helper
+	return nil
+}
+
+// patchOnExit persists the changes made to the resource once a reconcile ends, and is deferred
+// by Reconcile. The resource is requeued if the patch conflicts with another change, and it is
+// not an error for the resource to be gone once its finalizer was removed.
+func (p *objectPatcher) patchOnExit(ctx context.Context, result *ctrl.Result, reterr *error) {
+	err := kerrors.FilterOut(p.patch(ctx), apierrors.IsNotFound)
+	if err == nil {
+		return
+	}
+	if kerrors.FilterOut(err, isPatchConflict) == nil {
+		log.FromContext(ctx).Info("Changes conflict with another update, requeueing", "reason", err.Error())
+		if result.IsZero() {
+			*result = ctrl.Result{Requeue: true}
+		}
+		return
+	}
+	log.FromContext(ctx).Error(err, "Error patching resource")
+	*reterr = kerrors.NewAggregate([]error{*reterr, err})
+}
+
+// isPatchConflict returns true if err means the resource was changed by another process,
+// including conditions that kept conflicting until the patch helper gave up
+func isPatchConflict(err error) bool {
+	return apierrors.IsConflict(err) || errors.Is(err, wait.ErrWaitTimeout)
+}
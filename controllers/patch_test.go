@@ -0,0 +1,66 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+func TestObjectPatcher(t *testing.T) {
+	ctx := context.Background()
+	cp := &infrastructurev1alpha1.TFCManagedControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"},
+	}
+	c := rollbackTestClient(t, cp)
+	if err := c.Get(ctx, client.ObjectKeyFromObject(cp), cp); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("persists spec and status", func(t *testing.T) {
+		patcher, err := newObjectPatcher(c, cp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addFinalizer(cp, tfcManagedControlPlaneFinalizer)
+		cp.Status.Terraform.RunID = "run-1"
+		var result ctrl.Result
+		patcher.patchOnExit(ctx, &result, &err)
+		if err != nil || !result.IsZero() {
+			t.Fatalf("expected the patch to succeed, got %+v, %v", result, err)
+		}
+
+		var stored infrastructurev1alpha1.TFCManagedControlPlane
+		if err := c.Get(ctx, client.ObjectKeyFromObject(cp), &stored); err != nil {
+			t.Fatal(err)
+		}
+		if len(stored.Finalizers) != 1 || stored.Status.Terraform.RunID != "run-1" {
+			t.Errorf("expected the finalizer and run ID to be persisted, got %v and %q", stored.Finalizers, stored.Status.Terraform.RunID)
+		}
+	})
+
+	t.Run("requeues on conflict", func(t *testing.T) {
+		var stored infrastructurev1alpha1.TFCManagedControlPlane
+		if err := c.Get(ctx, client.ObjectKeyFromObject(cp), &stored); err != nil {
+			t.Fatal(err)
+		}
+		patcher, err := newObjectPatcher(c, &stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored.ResourceVersion = "1"
+		stored.Annotations = map[string]string{"example": "value"}
+		var result ctrl.Result
+		patcher.patchOnExit(ctx, &result, &err)
+		if err != nil || !result.Requeue {
+			t.Fatalf("expected a requeue, got %+v, %v", result, err)
+		}
+	})
+}
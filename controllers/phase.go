@@ -0,0 +1,472 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/backend"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/terraform"
+)
+
+// maxPhaseTransitions is the number of phase transitions recorded in status
+const maxPhaseTransitions = 10
+
+// phaseObject is implemented by the resources reconciled in phases
+type phaseObject interface {
+	configurationSource
+	conditions.Setter
+	GetPhaseStatus() *infrastructurev1alpha1.PhaseStatus
+	GetTerraformStatus() *infrastructurev1alpha1.TerraformStatus
+}
+
+// phaseResource is the part of reconciling a resource that is specific to its kind
+type phaseResource interface {
+	// object returns the reconciled resource
+	object() phaseObject
+
+	// description names the resource in the messages of its runs, e.g. Control Plane "example"
+	description() string
+
+	// revisionHistoryLimit is the number of configuration revisions to keep
+	revisionHistoryLimit() *int32
+
+	// validate returns an error if the spec cannot be reconciled, after recording why in a condition
+	validate(ctx context.Context) error
+
+	// configuration returns the generated or rendered configuration files, without the extra files
+	configuration(ctx context.Context) (map[string][]byte, error)
+
+	// configurationUploaded is called once a new configuration version has been uploaded
+	configurationUploaded()
+
+	// needsPlan returns true if a speculative plan must be reviewed before the configuration is applied
+	needsPlan() bool
+
+	// reviewPlan reviews the speculative plan of the configuration version and returns true once
+	// it may be applied. An error wrapping errUpgradeRefused means it must not be applied.
+	reviewPlan(ctx context.Context, b backend.Backend, configurationVersionID string) (bool, error)
+
+	// observeRun is called with the run each time it is read while it is in progress or has failed
+	observeRun(run *backend.Run)
+
+	// runFailed is called once the run errored, was canceled or was discarded
+	runFailed(run *backend.Run)
+
+	// provision reconciles the outputs of an applied run. It may start another run with startRun.
+	provision(ctx context.Context, m *phaseMachine, run *backend.Run) (ctrl.Result, error)
+
+	// cleanup removes what depends on the resource once its destroy run has been queued
+	cleanup(ctx context.Context) error
+}
+
+// phaseMachine reconciles a resource by moving it through the phases recorded in status.phase.
+// Each reconcile first uploads the configuration if it changed, which moves the resource to
+// Uploading, and then runs the handler of the current phase. Handlers move the resource to
+// the next phase, and the next handler runs in the same reconcile unless a requeue is returned.
+// Changes to the resource are persisted by the patcher once the reconcile ends, except for the
+// IDs of new runs which are persisted as soon as the run is created.
+type phaseMachine struct {
+	client      client.Client
+	scheme      *runtime.Scheme
+	backend     backend.Backend
+	resource    phaseResource
+	patcher     *objectPatcher
+	clusterName string
+	finalizer   string
+	requeue     RequeueIntervals
+
+	// autoApply is spec.autoApply: runs are applied without waiting to be confirmed
+	autoApply bool
+
+	// pinned is true while the rollback annotation pins a previous configuration version
+	pinned bool
+
+	// run is the run read in this reconcile
+	run *backend.Run
+}
+
+// phaseHandler reconciles a resource in a phase
+type phaseHandler func(m *phaseMachine, ctx context.Context) (ctrl.Result, error)
+
+// phaseHandlers are the handlers of each phase
+var phaseHandlers = map[infrastructurev1alpha1.Phase]phaseHandler{
+	infrastructurev1alpha1.PhasePending:          (*phaseMachine).reconcilePending,
+	infrastructurev1alpha1.PhaseUploading:        (*phaseMachine).reconcileUploading,
+	infrastructurev1alpha1.PhasePlanning:         (*phaseMachine).reconcilePlanning,
+	infrastructurev1alpha1.PhaseAwaitingApproval: (*phaseMachine).reconcileRun,
+	infrastructurev1alpha1.PhaseApplying:         (*phaseMachine).reconcileApplying,
+	infrastructurev1alpha1.PhaseProvisioned:      (*phaseMachine).reconcileProvisioned,
+	infrastructurev1alpha1.PhaseFailed:           (*phaseMachine).reconcileFailed,
+}
+
+// phase returns the current phase of the resource
+func (m *phaseMachine) phase() infrastructurev1alpha1.Phase {
+	return m.resource.object().GetPhaseStatus().Phase
+}
+
+// setPhase moves the resource to a phase and records the transition
+func (m *phaseMachine) setPhase(phase infrastructurev1alpha1.Phase) {
+	status := m.resource.object().GetPhaseStatus()
+	if status.Phase == phase {
+		return
+	}
+	status.Phase = phase
+	transitions := append(status.PhaseTransitions, infrastructurev1alpha1.PhaseTransition{
+		Phase:              phase,
+		LastTransitionTime: metav1.Now(),
+	})
+	if len(transitions) > maxPhaseTransitions {
+		transitions = transitions[len(transitions)-maxPhaseTransitions:]
+	}
+	status.PhaseTransitions = transitions
+}
+
+// reconcile moves the resource through its phases until it has to wait
+func (m *phaseMachine) reconcile(ctx context.Context) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if m.phase() == "" {
+		m.setPhase(infrastructurev1alpha1.PhasePending)
+	}
+
+	if err := m.resource.validate(ctx); err != nil {
+		logger.Error(err, "Unsupported spec")
+		m.setPhase(infrastructurev1alpha1.PhaseFailed)
+		return ctrl.Result{}, nil
+	}
+
+	if result, done, err := m.reconcileConfiguration(ctx); done {
+		return result, err
+	}
+
+	visited := map[infrastructurev1alpha1.Phase]bool{}
+	for {
+		phase := m.phase()
+		visited[phase] = true
+		handler, ok := phaseHandlers[phase]
+		if !ok {
+			return ctrl.Result{}, fmt.Errorf("unknown phase %q", phase)
+		}
+		result, err := handler(m, ctx)
+
+		// continue with the next phase unless the resource has to wait, or has failed
+		next := m.phase()
+		if err != nil || !result.IsZero() || next == phase || next == infrastructurev1alpha1.PhaseFailed || visited[next] {
+			return result, err
+		}
+	}
+}
+
+// reconcileConfiguration uploads the configuration if it changed, or applies the rollback
+// annotation. It returns true if the reconcile must end with the returned result.
+func (m *phaseMachine) reconcileConfiguration(ctx context.Context) (ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
+	obj := m.resource.object()
+	status := obj.GetTerraformStatus()
+
+	// generate the Terraform config, or render it from the user's templates
+	files, err := m.resource.configuration(ctx)
+	if err != nil {
+		logger.Error(err, "Error generating Terraform configuration")
+		result, _ := requeueAfter(m.requeue.Default)
+		return result, true, nil
+	}
+	extra, err := terraform.ReadExtraFiles(ctx, m.client, obj.GetNamespace(), obj.GetExtraFiles())
+	if err != nil {
+		logger.Error(err, "Error reading extra files")
+		result, _ := requeueAfter(m.requeue.Default)
+		return result, true, nil
+	}
+	configFiles, err := terraform.MergeFiles(files, extra)
+	if err != nil {
+		logger.Error(err, "Error generating Terraform configuration")
+		return ctrl.Result{}, true, err
+	}
+
+	// hash the configuration together with the variables it is run with
+	variables, err := m.backend.Variables(ctx)
+	if err != nil {
+		logger.Error(err, "Error reading workspace variables")
+		result, _ := requeueAfter(m.requeue.Default)
+		return result, true, nil
+	}
+	configHash, configHashes := terraform.HashConfiguration(files, extra, variables)
+
+	// the rollback annotation pins a previous configuration version instead
+	m.pinned, err = reconcileRollback(ctx, m.client, obj, status, configHash)
+	if err != nil {
+		logger.Error(err, "Error rolling back configuration")
+		m.setPhase(infrastructurev1alpha1.PhaseFailed)
+		return ctrl.Result{}, true, nil
+	}
+
+	if m.pinned || (status.ConfigurationVersionID != "" && configHash == status.ConfigurationHash) {
+		return ctrl.Result{}, false, nil
+	}
+
+	// upload the terraform config as a new ConfigurationVersion
+	logger.Info("Uploading Terraform Configuration", "changed", changedConfigurationInputs(status.ConfigurationHashes, configHashes))
+	cvID, err := m.backend.Upload(ctx, configFiles)
+	if err != nil {
+		logger.Error(err, "Error uploading Terraform configuration")
+		result, _ := requeueAfter(m.requeue.Default)
+		return result, true, nil
+	}
+
+	// keep the uploaded files for auditing
+	revision, err := recordConfigurationRevision(ctx, m.client, m.scheme, obj, m.clusterName,
+		m.resource.revisionHistoryLimit(), cvID, configHash, files, extra)
+	if err != nil {
+		logger.Error(err, "Error recording configuration revision")
+	}
+
+	status.ConfigurationVersionID = cvID
+	status.ConfigurationRevision = revision
+	status.ConfigurationHash = configHash
+	status.ConfigurationHashes = configHashes
+	recordConfigurationHistory(status, infrastructurev1alpha1.ConfigurationHistoryEntry{
+		Revision:               revision,
+		ConfigurationVersionID: cvID,
+		ConfigurationHash:      configHash,
+		ConfigurationHashes:    configHashes,
+		UploadedAt:             metav1.Now(),
+	})
+	status.RunID = ""
+	status.RunStatus = ""
+	status.PlanRunID = ""
+	m.resource.configurationUploaded()
+	m.setPhase(infrastructurev1alpha1.PhaseUploading)
+	result, _ := requeueAfter(m.requeue.Default)
+	return result, true, nil
+}
+
+// reconcilePending resumes a resource that has not been reconciled in phases yet
+func (m *phaseMachine) reconcilePending(ctx context.Context) (ctrl.Result, error) {
+	if m.resource.object().GetTerraformStatus().RunID != "" {
+		m.setPhase(infrastructurev1alpha1.PhaseApplying)
+	} else {
+		m.setPhase(infrastructurev1alpha1.PhaseUploading)
+	}
+	return ctrl.Result{}, nil
+}
+
+// reconcileUploading waits for the configuration version to be processed
+func (m *phaseMachine) reconcileUploading(ctx context.Context) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	cvReady, err := m.backend.ConfigurationVersionReady(ctx, m.resource.object().GetTerraformStatus().ConfigurationVersionID)
+	if err != nil {
+		logger.Error(err, "Error reading ConfigurationVersion")
+		return requeueAfter(m.requeue.Default)
+	}
+	if !cvReady {
+		logger.Info("ConfigurationVersion not ready yet")
+		return requeueAfter(m.requeue.Long)
+	}
+
+	if !m.pinned && m.resource.needsPlan() {
+		m.setPhase(infrastructurev1alpha1.PhasePlanning)
+	} else {
+		m.setPhase(infrastructurev1alpha1.PhaseApplying)
+	}
+	return ctrl.Result{}, nil
+}
+
+// reconcilePlanning reviews a speculative plan before the configuration version is applied
+func (m *phaseMachine) reconcilePlanning(ctx context.Context) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	obj := m.resource.object()
+
+	if m.pinned || !m.resource.needsPlan() {
+		m.setPhase(infrastructurev1alpha1.PhaseApplying)
+		return ctrl.Result{}, nil
+	}
+
+	status := obj.GetTerraformStatus()
+	planRunID := status.PlanRunID
+	approved, err := m.resource.reviewPlan(ctx, m.backend, status.ConfigurationVersionID)
+	if status.PlanRunID != planRunID {
+		if err := m.patcher.patch(ctx); err != nil {
+			logger.Error(err, "Error persisting speculative plan", "run", status.PlanRunID)
+			return ctrl.Result{}, err
+		}
+	}
+	if err != nil {
+		logger.Error(err, "Error reviewing plan")
+		if isUpgradeRefused(err) {
+			m.setPhase(infrastructurev1alpha1.PhaseFailed)
+			return ctrl.Result{}, nil
+		}
+		return requeueAfter(m.requeue.Default)
+	}
+	if !approved {
+		return requeueAfter(m.requeue.Default)
+	}
+	m.setPhase(infrastructurev1alpha1.PhaseApplying)
+	return ctrl.Result{}, nil
+}
+
+// reconcileApplying starts a run of the configuration version, or follows the run in progress
+func (m *phaseMachine) reconcileApplying(ctx context.Context) (ctrl.Result, error) {
+	if m.resource.object().GetTerraformStatus().RunID == "" {
+		return m.startRun(ctx, backend.RunOptions{
+			Message: fmt.Sprintf("%s: Reconcile %s", terraformCloudRunMessage, m.resource.description()),
+		})
+	}
+	return m.reconcileRun(ctx)
+}
+
+// startRun queues a run of the configuration version and moves the resource to Applying. The ID
+// of the run is persisted before anything else is done, so that it is not queued again.
+func (m *phaseMachine) startRun(ctx context.Context, options backend.RunOptions) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	obj := m.resource.object()
+	status := obj.GetTerraformStatus()
+
+	logger.Info("Triggering Terraform Run")
+	options.AutoApply = m.autoApply
+	run, err := m.backend.Apply(ctx, status.ConfigurationVersionID, options)
+	if err != nil {
+		logger.Error(err, "Error triggering new Terraform run")
+		return requeueAfter(m.requeue.Default)
+	}
+
+	status.RunID = run.ID
+	status.RunStatus = string(run.Status)
+	status.RunStartedAt = metav1.NewTime(time.Now())
+	status.RunFinishedAt = metav1.Time{}
+	status.StateVersionID = ""
+	m.setPhase(infrastructurev1alpha1.PhaseApplying)
+	if err := m.patcher.patch(ctx); err != nil {
+		logger.Error(err, "Error persisting Terraform run", "run", run.ID)
+		return ctrl.Result{}, err
+	}
+	return requeueAfter(m.requeue.Long)
+}
+
+// reconcileRun follows the run in progress, which moves the resource to AwaitingApproval while
+// it waits to be confirmed, and to Provisioned or Failed once it has finished
+func (m *phaseMachine) reconcileRun(ctx context.Context) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	obj := m.resource.object()
+	status := obj.GetTerraformStatus()
+
+	if status.RunID == "" {
+		m.setPhase(infrastructurev1alpha1.PhaseUploading)
+		return ctrl.Result{}, nil
+	}
+
+	run, err := m.backend.ReadRun(ctx, status.RunID)
+	if err != nil {
+		logger.Error(err, "Error reading Terraform Run")
+		return requeueAfter(m.requeue.Default)
+	}
+	m.run = run
+	status.RunStatus = string(run.Status)
+	m.resource.observeRun(run)
+
+	switch {
+	case run.Status == backend.RunDiscarded, run.Status == backend.RunCanceled, run.Status == backend.RunErrored:
+		logger.Info("The Terraform run has failed", "status", run.Status)
+		m.resource.runFailed(run)
+		m.setPhase(infrastructurev1alpha1.PhaseFailed)
+		return ctrl.Result{}, nil
+	case run.Status == backend.RunApplied, run.Status == backend.RunPlannedAndFinished:
+		m.setPhase(infrastructurev1alpha1.PhaseProvisioned)
+		return ctrl.Result{}, nil
+	case run.AwaitingApproval:
+		logger.Info("The Terraform run is waiting to be confirmed")
+		m.setPhase(infrastructurev1alpha1.PhaseAwaitingApproval)
+		return requeueAfter(m.requeue.Default)
+	default:
+		// run is still in progress
+		m.setPhase(infrastructurev1alpha1.PhaseApplying)
+		return requeueAfter(m.requeue.Default)
+	}
+}
+
+// reconcileProvisioned reconciles the outputs of the run once it has applied or finished without changes
+func (m *phaseMachine) reconcileProvisioned(ctx context.Context) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	status := m.resource.object().GetTerraformStatus()
+
+	// the rollback annotation pinned a configuration version that has not been run
+	if status.RunID == "" {
+		m.setPhase(infrastructurev1alpha1.PhaseUploading)
+		return ctrl.Result{}, nil
+	}
+
+	run := m.run
+	if run == nil || run.ID != status.RunID {
+		var err error
+		run, err = m.backend.ReadRun(ctx, status.RunID)
+		if err != nil {
+			logger.Error(err, "Error reading Terraform Run")
+			return requeueAfter(m.requeue.Default)
+		}
+		m.run = run
+		status.RunStatus = string(run.Status)
+	}
+	if run.Status != backend.RunApplied && run.Status != backend.RunPlannedAndFinished {
+		return ctrl.Result{}, nil
+	}
+	return m.resource.provision(ctx, m, run)
+}
+
+// reconcileFailed waits for the resource to be changed after it failed. A failed run or a refused
+// plan is checked again, while a new configuration version moves the resource to Uploading.
+func (m *phaseMachine) reconcileFailed(ctx context.Context) (ctrl.Result, error) {
+	status := m.resource.object().GetTerraformStatus()
+	switch {
+	case status.RunID != "":
+		return m.reconcileRun(ctx)
+	case status.PlanRunID != "":
+		return m.reconcilePlanning(ctx)
+	default:
+		m.setPhase(infrastructurev1alpha1.PhaseUploading)
+		return ctrl.Result{}, nil
+	}
+}
+
+// reconcileDelete queues a destroy run and removes the finalizer once the resource is deleted
+func (m *phaseMachine) reconcileDelete(ctx context.Context) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	obj := m.resource.object()
+
+	if !controllerutil.ContainsFinalizer(obj, m.finalizer) {
+		return ctrl.Result{}, nil
+	}
+	logger.Info("Resource is deleted, triggering destroy")
+	m.setPhase(infrastructurev1alpha1.PhaseDeleting)
+
+	// trigger destroy run, which is always auto-applied as the finalizer is removed once it is queued
+	_, err := m.backend.Destroy(ctx, obj.GetTerraformStatus().ConfigurationVersionID, backend.RunOptions{
+		Message:   fmt.Sprintf("%s: Destroy %s", terraformCloudRunMessage, m.resource.description()),
+		AutoApply: true,
+	})
+	if err != nil {
+		logger.Error(err, "Error triggering destroy run")
+		return ctrl.Result{}, err
+	}
+
+	if err := m.resource.cleanup(ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// TODO: wait until the destroy plan has completed
+	controllerutil.RemoveFinalizer(obj, m.finalizer)
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,514 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/backend"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/terraform"
+)
+
+// phaseTestBackend is a backend whose runs are finished by the test
+type phaseTestBackend struct {
+	cvReady   bool
+	applyErr  error
+	uploads   int
+	runs      map[string]*backend.Run
+	applied   []backend.RunOptions
+	destroyed int
+}
+
+func (b *phaseTestBackend) Variables(ctx context.Context) ([]terraform.WorkspaceVariable, error) {
+	return nil, nil
+}
+
+func (b *phaseTestBackend) Upload(ctx context.Context, files map[string][]byte) (string, error) {
+	b.uploads++
+	return fmt.Sprintf("cv-%d", b.uploads), nil
+}
+
+func (b *phaseTestBackend) ConfigurationVersionReady(ctx context.Context, configurationVersionID string) (bool, error) {
+	return b.cvReady, nil
+}
+
+func (b *phaseTestBackend) newRun() *backend.Run {
+	run := &backend.Run{ID: fmt.Sprintf("run-%d", len(b.runs)+1), Status: backend.RunPending}
+	b.runs[run.ID] = run
+	return run
+}
+
+func (b *phaseTestBackend) Apply(ctx context.Context, configurationVersionID string, options backend.RunOptions) (*backend.Run, error) {
+	if b.applyErr != nil {
+		return nil, b.applyErr
+	}
+	b.applied = append(b.applied, options)
+	return b.newRun(), nil
+}
+
+func (b *phaseTestBackend) Plan(ctx context.Context, configurationVersionID string, message string) (*backend.Run, error) {
+	return b.newRun(), nil
+}
+
+func (b *phaseTestBackend) Destroy(ctx context.Context, configurationVersionID string, options backend.RunOptions) (*backend.Run, error) {
+	b.destroyed++
+	return b.newRun(), nil
+}
+
+func (b *phaseTestBackend) ReadRun(ctx context.Context, runID string) (*backend.Run, error) {
+	run, ok := b.runs[runID]
+	if !ok {
+		return nil, errors.New("run not found")
+	}
+	copy := *run
+	return &copy, nil
+}
+
+func (b *phaseTestBackend) PlanJSON(ctx context.Context, run *backend.Run) ([]byte, error) {
+	return []byte(`{"resource_changes":[]}`), nil
+}
+
+func (b *phaseTestBackend) Outputs(ctx context.Context, run *backend.Run, stateVersionID string) (string, map[string]any, error) {
+	return "sv-1", map[string]any{}, nil
+}
+
+// phaseTestResource records the hooks called by the phase machine
+type phaseTestResource struct {
+	cluster     *infrastructurev1alpha1.TFCManagedControlPlane
+	files       map[string][]byte
+	validateErr error
+	plan        bool
+	approved    bool
+	reviewErr   error
+	failedRuns  []string
+	provisioned []string
+	cleanedUp   bool
+}
+
+func (p *phaseTestResource) object() phaseObject {
+	return p.cluster
+}
+
+func (p *phaseTestResource) description() string {
+	return fmt.Sprintf("Control Plane %q", p.cluster.Name)
+}
+
+func (p *phaseTestResource) revisionHistoryLimit() *int32 {
+	return nil
+}
+
+func (p *phaseTestResource) validate(ctx context.Context) error {
+	return p.validateErr
+}
+
+func (p *phaseTestResource) configuration(ctx context.Context) (map[string][]byte, error) {
+	return p.files, nil
+}
+
+func (p *phaseTestResource) configurationUploaded() {}
+
+func (p *phaseTestResource) needsPlan() bool {
+	return p.plan
+}
+
+func (p *phaseTestResource) reviewPlan(ctx context.Context, b backend.Backend, configurationVersionID string) (bool, error) {
+	return p.approved, p.reviewErr
+}
+
+func (p *phaseTestResource) observeRun(run *backend.Run) {}
+
+func (p *phaseTestResource) runFailed(run *backend.Run) {
+	p.failedRuns = append(p.failedRuns, run.ID)
+}
+
+func (p *phaseTestResource) provision(ctx context.Context, m *phaseMachine, run *backend.Run) (ctrl.Result, error) {
+	p.provisioned = append(p.provisioned, run.ID)
+	return ctrl.Result{}, nil
+}
+
+func (p *phaseTestResource) cleanup(ctx context.Context) error {
+	p.cleanedUp = true
+	return nil
+}
+
+func phaseTestMachine(t *testing.T) (*phaseMachine, *phaseTestResource, *phaseTestBackend) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := infrastructurev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	cluster := &infrastructurev1alpha1.TFCManagedControlPlane{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "example",
+			Namespace:  "default",
+			Finalizers: []string{tfcManagedControlPlaneFinalizer},
+		},
+	}
+	if err := c.Create(context.Background(), cluster); err != nil {
+		t.Fatal(err)
+	}
+	resource := &phaseTestResource{cluster: cluster, files: map[string][]byte{"main.tf": []byte("# v1")}}
+	b := &phaseTestBackend{cvReady: true, runs: map[string]*backend.Run{}}
+	return &phaseMachine{
+		client:      c,
+		scheme:      scheme,
+		backend:     b,
+		resource:    resource,
+		clusterName: "example",
+		finalizer:   tfcManagedControlPlaneFinalizer,
+		requeue:     DefaultRequeueIntervals,
+	}, resource, b
+}
+
+// reconcilePhase reconciles and persists the changes, as Reconcile does
+func reconcilePhase(t *testing.T, m *phaseMachine) ctrl.Result {
+	t.Helper()
+	ctx := context.Background()
+	patcher, err := newObjectPatcher(m.client, m.resource.object())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.patcher = patcher
+	m.pinned = false
+	m.run = nil
+	result, err := m.reconcile(ctx)
+	patcher.patchOnExit(ctx, &result, &err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func expectPhase(t *testing.T, m *phaseMachine, phase infrastructurev1alpha1.Phase) {
+	t.Helper()
+	if m.phase() != phase {
+		t.Fatalf("expected phase %s, got %s", phase, m.phase())
+	}
+	var persisted infrastructurev1alpha1.TFCManagedControlPlane
+	if err := m.client.Get(context.Background(), client.ObjectKeyFromObject(m.resource.object()), &persisted); err != nil {
+		t.Fatal(err)
+	}
+	if persisted.Status.Phase != phase {
+		t.Fatalf("expected phase %s to be persisted, got %s", phase, persisted.Status.Phase)
+	}
+}
+
+func TestPhaseUploading(t *testing.T) {
+	m, _, b := phaseTestMachine(t)
+
+	result := reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseUploading)
+	if b.uploads != 1 || result.RequeueAfter != 30*time.Second {
+		t.Errorf("expected the configuration to be uploaded, got %d uploads and %+v", b.uploads, result)
+	}
+	transitions := m.resource.object().GetPhaseStatus().PhaseTransitions
+	if len(transitions) != 2 || transitions[0].Phase != infrastructurev1alpha1.PhasePending || transitions[1].Phase != infrastructurev1alpha1.PhaseUploading {
+		t.Errorf("expected transitions to Pending and Uploading, got %+v", transitions)
+	}
+
+	// the configuration version is still being processed
+	b.cvReady = false
+	result = reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseUploading)
+	if result.RequeueAfter != 60*time.Second || len(b.applied) != 0 {
+		t.Errorf("expected to wait for the configuration version, got %+v", result)
+	}
+}
+
+func TestPhaseRequeueIntervals(t *testing.T) {
+	m, _, b := phaseTestMachine(t)
+	m.requeue = RequeueIntervals{Default: time.Minute}.withDefaults()
+
+	result := reconcilePhase(t, m)
+	if result.RequeueAfter != time.Minute {
+		t.Errorf("expected the configured interval to be used, got %+v", result)
+	}
+
+	// intervals that are not configured keep their default
+	b.cvReady = false
+	result = reconcilePhase(t, m)
+	if result.RequeueAfter != DefaultRequeueIntervals.Long {
+		t.Errorf("expected the default interval to be used, got %+v", result)
+	}
+}
+
+func TestPhaseApplying(t *testing.T) {
+	m, resource, b := phaseTestMachine(t)
+	m.autoApply = true
+	reconcilePhase(t, m)
+
+	b.applyErr = errors.New("service unavailable")
+	result := reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseApplying)
+	if result.RequeueAfter != 30*time.Second || resource.cluster.Status.Terraform.RunID != "" {
+		t.Errorf("expected the run to be retried, got %+v", result)
+	}
+
+	b.applyErr = nil
+	result = reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseApplying)
+	if len(b.applied) != 1 || resource.cluster.Status.Terraform.RunID != "run-1" || result.RequeueAfter != 60*time.Second {
+		t.Fatalf("expected a run to be started, got %+v", b.applied)
+	}
+	if b.applied[0].Message != terraformCloudRunMessage+`: Reconcile Control Plane "example"` {
+		t.Errorf("unexpected run message %q", b.applied[0].Message)
+	}
+	if !b.applied[0].AutoApply {
+		t.Error("expected the run to be auto-applied")
+	}
+
+	b.runs["run-1"].Status = backend.RunApplying
+	result = reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseApplying)
+	if result.RequeueAfter != 30*time.Second || resource.cluster.Status.Terraform.RunStatus != string(backend.RunApplying) {
+		t.Errorf("expected to wait for the run, got %+v", result)
+	}
+}
+
+func TestPhaseAwaitingApproval(t *testing.T) {
+	m, resource, b := phaseTestMachine(t)
+	reconcilePhase(t, m)
+	reconcilePhase(t, m)
+
+	if len(b.applied) != 1 || b.applied[0].AutoApply {
+		t.Fatalf("expected a run that waits to be confirmed, got %+v", b.applied)
+	}
+
+	b.runs["run-1"].Status = "planned"
+	b.runs["run-1"].AwaitingApproval = true
+	result := reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseAwaitingApproval)
+	if result.RequeueAfter != 30*time.Second {
+		t.Errorf("expected to wait for the run to be confirmed, got %+v", result)
+	}
+
+	b.runs["run-1"].Status = backend.RunApplied
+	b.runs["run-1"].AwaitingApproval = false
+	reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseProvisioned)
+	if len(resource.provisioned) != 1 {
+		t.Errorf("expected the run to be provisioned once, got %v", resource.provisioned)
+	}
+}
+
+func TestPhaseProvisioned(t *testing.T) {
+	m, resource, b := phaseTestMachine(t)
+	reconcilePhase(t, m)
+	reconcilePhase(t, m)
+
+	b.runs["run-1"].Status = backend.RunApplied
+	reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseProvisioned)
+	reconcilePhase(t, m)
+	if len(resource.provisioned) != 2 {
+		t.Errorf("expected the outputs to be reconciled on each reconcile, got %v", resource.provisioned)
+	}
+
+	// a changed configuration is uploaded and applied again
+	resource.files = map[string][]byte{"main.tf": []byte("# v2")}
+	reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseUploading)
+	if resource.cluster.Status.Terraform.RunID != "" || resource.cluster.Status.Terraform.ConfigurationVersionID != "cv-2" {
+		t.Errorf("expected the new configuration version to be run, got %+v", resource.cluster.Status.Terraform)
+	}
+}
+
+func TestPhaseProvisionedWithoutChanges(t *testing.T) {
+	m, resource, b := phaseTestMachine(t)
+	reconcilePhase(t, m)
+	reconcilePhase(t, m)
+
+	// a run whose plan has no changes finishes without applying
+	b.runs["run-1"].Status = backend.RunPlannedAndFinished
+	reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseProvisioned)
+	reconcilePhase(t, m)
+	if len(resource.provisioned) != 2 || resource.provisioned[0] != "run-1" {
+		t.Errorf("expected the outputs of the run to be reconciled, got %v", resource.provisioned)
+	}
+}
+
+func TestPhasePlanning(t *testing.T) {
+	m, resource, b := phaseTestMachine(t)
+	resource.plan = true
+	reconcilePhase(t, m)
+
+	result := reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhasePlanning)
+	if result.RequeueAfter != 30*time.Second || len(b.applied) != 0 {
+		t.Errorf("expected to wait for the plan to be reviewed, got %+v", result)
+	}
+
+	resource.approved = true
+	reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseApplying)
+	if len(b.applied) != 1 {
+		t.Errorf("expected the configuration to be applied once the plan is approved, got %d runs", len(b.applied))
+	}
+}
+
+func TestPhasePlanningRefused(t *testing.T) {
+	m, resource, b := phaseTestMachine(t)
+	resource.plan = true
+	resource.reviewErr = fmt.Errorf("%w: plan would replace resources", errUpgradeRefused)
+	reconcilePhase(t, m)
+	resource.cluster.Status.Terraform.PlanRunID = "run-0"
+
+	reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseFailed)
+	reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseFailed)
+	if len(b.applied) != 0 {
+		t.Errorf("expected the refused upgrade not to be applied, got %d runs", len(b.applied))
+	}
+}
+
+func TestPhaseFailed(t *testing.T) {
+	m, resource, b := phaseTestMachine(t)
+	reconcilePhase(t, m)
+	reconcilePhase(t, m)
+
+	b.runs["run-1"].Status = backend.RunErrored
+	result := reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseFailed)
+	if !result.IsZero() || len(resource.failedRuns) != 1 {
+		t.Errorf("expected the failed run to be reported, got %+v and %v", result, resource.failedRuns)
+	}
+
+	// the failed run is not retried until the configuration changes
+	reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseFailed)
+	if len(b.applied) != 1 {
+		t.Errorf("expected no new run, got %d runs", len(b.applied))
+	}
+
+	resource.files = map[string][]byte{"main.tf": []byte("# fixed")}
+	reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseUploading)
+	reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseApplying)
+	if len(b.applied) != 2 {
+		t.Errorf("expected the new configuration to be applied, got %d runs", len(b.applied))
+	}
+}
+
+func TestPhaseFailedValidation(t *testing.T) {
+	m, resource, b := phaseTestMachine(t)
+	resource.validateErr = errors.New("unsupported version skew")
+
+	result := reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseFailed)
+	if !result.IsZero() || b.uploads != 0 {
+		t.Errorf("expected nothing to be uploaded, got %+v", result)
+	}
+
+	resource.validateErr = nil
+	reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseUploading)
+}
+
+func TestPhasePending(t *testing.T) {
+	m, resource, b := phaseTestMachine(t)
+	reconcilePhase(t, m)
+	reconcilePhase(t, m)
+
+	// resources reconciled before phases were recorded resume following their run
+	resource.cluster.Status.Phase = ""
+	resource.cluster.Status.PhaseTransitions = nil
+	b.runs["run-1"].Status = backend.RunApplied
+	reconcilePhase(t, m)
+	expectPhase(t, m, infrastructurev1alpha1.PhaseProvisioned)
+	phases := []infrastructurev1alpha1.Phase{}
+	for _, transition := range resource.cluster.Status.PhaseTransitions {
+		phases = append(phases, transition.Phase)
+	}
+	if fmt.Sprint(phases) != "[Pending Applying Provisioned]" {
+		t.Errorf("unexpected transitions %v", phases)
+	}
+}
+
+func TestPhaseDeleting(t *testing.T) {
+	m, resource, b := phaseTestMachine(t)
+	reconcilePhase(t, m)
+	ctx := context.Background()
+	if err := m.client.Delete(ctx, resource.cluster); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.client.Get(ctx, client.ObjectKeyFromObject(resource.cluster), resource.cluster); err != nil {
+		t.Fatal(err)
+	}
+
+	patcher, err := newObjectPatcher(m.client, resource.cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := m.reconcileDelete(ctx)
+	patcher.patchOnExit(ctx, &result, &err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.destroyed != 1 || !resource.cleanedUp {
+		t.Errorf("expected a destroy run and cleanup, got %d destroy runs", b.destroyed)
+	}
+	if resource.cluster.Status.Phase != infrastructurev1alpha1.PhaseDeleting {
+		t.Errorf("expected the phase to be Deleting, got %s", resource.cluster.Status.Phase)
+	}
+	err = m.client.Get(ctx, client.ObjectKeyFromObject(resource.cluster), &infrastructurev1alpha1.TFCManagedControlPlane{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected the resource to be gone once its finalizer is removed, got %v", err)
+	}
+}
+
+func TestStartRunPersistsRunID(t *testing.T) {
+	m, resource, _ := phaseTestMachine(t)
+	reconcilePhase(t, m)
+	ctx := context.Background()
+	patcher, err := newObjectPatcher(m.client, resource.cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.patcher = patcher
+
+	if _, err := m.startRun(ctx, backend.RunOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var persisted infrastructurev1alpha1.TFCManagedControlPlane
+	if err := m.client.Get(ctx, client.ObjectKeyFromObject(resource.cluster), &persisted); err != nil {
+		t.Fatal(err)
+	}
+	if persisted.Status.Terraform.RunID != "run-1" || persisted.Status.Phase != infrastructurev1alpha1.PhaseApplying {
+		t.Errorf("expected the run to be persisted as soon as it is created, got %q in phase %s", persisted.Status.Terraform.RunID, persisted.Status.Phase)
+	}
+}
+
+func TestSetPhase(t *testing.T) {
+	m, resource, _ := phaseTestMachine(t)
+	for i := 0; i < 2*maxPhaseTransitions; i++ {
+		m.setPhase(infrastructurev1alpha1.PhaseApplying)
+		m.setPhase(infrastructurev1alpha1.PhaseProvisioned)
+	}
+	transitions := resource.cluster.Status.PhaseTransitions
+	if len(transitions) != maxPhaseTransitions {
+		t.Fatalf("expected %d transitions, got %d", maxPhaseTransitions, len(transitions))
+	}
+	if transitions[len(transitions)-1].Phase != infrastructurev1alpha1.PhaseProvisioned {
+		t.Errorf("expected the latest transition last, got %+v", transitions)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/terraform"
+)
+
+// recordConfigurationRevision stores the files uploaded as a ConfigurationVersion in a new revision
+// ConfigMap owned by the resource, deletes the revisions beyond the history limit and returns the
+// number of the new revision, or 0 if no revisions are kept.
+func recordConfigurationRevision(ctx context.Context, c client.Client, scheme *runtime.Scheme, owner configurationSource, clusterName string, limit *int32, configurationVersionID, hash string, files, extra map[string][]byte) (int64, error) {
+	keep := terraform.DefaultRevisionHistoryLimit
+	if limit != nil {
+		keep = int(*limit)
+	}
+
+	revisions, err := terraform.ListRevisions(ctx, c, owner)
+	if err != nil {
+		return 0, fmt.Errorf("could not list configuration revisions: %w", err)
+	}
+
+	var revision int64
+	if keep > 0 {
+		revision = 1
+		if len(revisions) > 0 {
+			revision = terraform.Revision(&revisions[len(revisions)-1]) + 1
+		}
+		configMap := terraform.NewRevision(owner, clusterName, revision, configurationVersionID, hash,
+			files, extra, terraform.SecretFileNames(owner.GetExtraFiles()))
+		if err := controllerutil.SetControllerReference(owner, configMap, scheme); err != nil {
+			return 0, err
+		}
+		if err := c.Create(ctx, configMap); err != nil {
+			return 0, fmt.Errorf("could not store configuration revision: %w", err)
+		}
+		keep--
+	}
+
+	for i := 0; i < len(revisions)-keep; i++ {
+		if err := c.Delete(ctx, &revisions[i]); client.IgnoreNotFound(err) != nil {
+			return revision, fmt.Errorf("could not delete configuration revision %d: %w", terraform.Revision(&revisions[i]), err)
+		}
+	}
+	return revision, nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+// maxConfigurationHistory is the number of uploaded configuration versions recorded in status
+const maxConfigurationHistory = 10
+
+// rollbackObject is implemented by the resources that can be rolled back
+type rollbackObject interface {
+	client.Object
+	conditions.Setter
+}
+
+// recordConfigurationHistory adds an uploaded configuration version to the history in status
+func recordConfigurationHistory(status *infrastructurev1alpha1.TerraformStatus, entry infrastructurev1alpha1.ConfigurationHistoryEntry) {
+	history := append(status.ConfigurationHistory, entry)
+	if len(history) > maxConfigurationHistory {
+		history = history[len(history)-maxConfigurationHistory:]
+	}
+	status.ConfigurationHistory = history
+}
+
+// findConfigurationHistory returns the history entry with the given revision or configuration version ID
+func findConfigurationHistory(status *infrastructurev1alpha1.TerraformStatus, target string) *infrastructurev1alpha1.ConfigurationHistoryEntry {
+	revision, err := strconv.ParseInt(target, 10, 64)
+	for i := len(status.ConfigurationHistory) - 1; i >= 0; i-- {
+		entry := &status.ConfigurationHistory[i]
+		if entry.ConfigurationVersionID == target || (err == nil && entry.Revision != 0 && entry.Revision == revision) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// reconcileRollback applies the rollback annotation and returns true while it pins a previous
+// configuration version, in which case the configuration produced from the spec must not be
+// uploaded. The pin is cleared once the spec produces the pinned configuration again.
+func reconcileRollback(ctx context.Context, c client.Client, obj rollbackObject, status *infrastructurev1alpha1.TerraformStatus, configHash string) (bool, error) {
+	target := obj.GetAnnotations()[infrastructurev1alpha1.RollbackAnnotation]
+	if target == "" {
+		conditions.MarkTrue(obj, infrastructurev1alpha1.ConfigurationSyncedCondition)
+		return false, nil
+	}
+
+	entry := findConfigurationHistory(status, target)
+	if entry == nil {
+		conditions.MarkFalse(obj, infrastructurev1alpha1.ConfigurationSyncedCondition,
+			infrastructurev1alpha1.RollbackTargetNotFoundReason, clusterv1beta1.ConditionSeverityError,
+			"%s annotation refers to %q, which is not in status.terraform.configurationHistory", infrastructurev1alpha1.RollbackAnnotation, target)
+		return true, fmt.Errorf("rollback target %q is not in the configuration history", target)
+	}
+
+	if status.ConfigurationVersionID != entry.ConfigurationVersionID {
+		status.ConfigurationVersionID = entry.ConfigurationVersionID
+		status.ConfigurationHash = entry.ConfigurationHash
+		status.ConfigurationHashes = entry.ConfigurationHashes
+		status.ConfigurationRevision = entry.Revision
+		status.RunID = ""
+		status.RunStatus = ""
+		status.PlanRunID = ""
+		status.StateVersionID = ""
+	}
+
+	if entry.ConfigurationHash == configHash {
+		if err := removeRollbackAnnotation(ctx, c, obj); err != nil {
+			return true, err
+		}
+		conditions.MarkTrue(obj, infrastructurev1alpha1.ConfigurationSyncedCondition)
+		return false, nil
+	}
+
+	conditions.MarkFalse(obj, infrastructurev1alpha1.ConfigurationSyncedCondition,
+		infrastructurev1alpha1.RolledBackReason, clusterv1beta1.ConditionSeverityWarning,
+		"Configuration version %s is pinned by the %s annotation; remove it or change the spec to match to resume",
+		entry.ConfigurationVersionID, infrastructurev1alpha1.RollbackAnnotation)
+	return true, nil
+}
+
+// removeRollbackAnnotation patches the rollback annotation away without
+// discarding the changes made to the status of obj
+func removeRollbackAnnotation(ctx context.Context, c client.Client, obj rollbackObject) error {
+	patched := obj.DeepCopyObject().(client.Object)
+	patch := client.MergeFrom(patched.DeepCopyObject().(client.Object))
+	annotations := patched.GetAnnotations()
+	delete(annotations, infrastructurev1alpha1.RollbackAnnotation)
+	patched.SetAnnotations(annotations)
+	if err := c.Patch(ctx, patched, patch); err != nil {
+		return fmt.Errorf("could not remove %s annotation: %w", infrastructurev1alpha1.RollbackAnnotation, err)
+	}
+	obj.SetAnnotations(patched.GetAnnotations())
+	obj.SetResourceVersion(patched.GetResourceVersion())
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+func rollbackTestControlPlane(target string) *infrastructurev1alpha1.TFCManagedControlPlane {
+	cp := &infrastructurev1alpha1.TFCManagedControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"},
+	}
+	if target != "" {
+		cp.Annotations = map[string]string{infrastructurev1alpha1.RollbackAnnotation: target}
+	}
+	for i, id := range []string{"cv-1", "cv-2", "cv-3"} {
+		recordConfigurationHistory(&cp.Status.Terraform, infrastructurev1alpha1.ConfigurationHistoryEntry{
+			Revision:               int64(i + 1),
+			ConfigurationVersionID: id,
+			ConfigurationHash:      "hash-" + id,
+		})
+	}
+	cp.Status.Terraform.ConfigurationVersionID = "cv-3"
+	cp.Status.Terraform.ConfigurationHash = "hash-cv-3"
+	cp.Status.Terraform.RunID = "run-3"
+	return cp
+}
+
+func rollbackTestClient(t *testing.T, objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	if err := infrastructurev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func TestReconcileRollback(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("not pinned", func(t *testing.T) {
+		cp := rollbackTestControlPlane("")
+		pinned, err := reconcileRollback(ctx, rollbackTestClient(t, cp), cp, &cp.Status.Terraform, "hash-cv-4")
+		if err != nil || pinned {
+			t.Fatalf("expected no pin, got %t, %v", pinned, err)
+		}
+		if !conditions.IsTrue(cp, infrastructurev1alpha1.ConfigurationSyncedCondition) {
+			t.Error("expected ConfigurationSynced to be true")
+		}
+	})
+
+	t.Run("pinned by revision", func(t *testing.T) {
+		cp := rollbackTestControlPlane("2")
+		pinned, err := reconcileRollback(ctx, rollbackTestClient(t, cp), cp, &cp.Status.Terraform, "hash-cv-4")
+		if err != nil || !pinned {
+			t.Fatalf("expected a pin, got %t, %v", pinned, err)
+		}
+		if cp.Status.Terraform.ConfigurationVersionID != "cv-2" || cp.Status.Terraform.RunID != "" {
+			t.Errorf("expected cv-2 to be run, got %q with run %q", cp.Status.Terraform.ConfigurationVersionID, cp.Status.Terraform.RunID)
+		}
+		if conditions.GetReason(cp, infrastructurev1alpha1.ConfigurationSyncedCondition) != infrastructurev1alpha1.RolledBackReason {
+			t.Error("expected ConfigurationSynced to be false with reason RolledBack")
+		}
+	})
+
+	t.Run("pinned by configuration version", func(t *testing.T) {
+		cp := rollbackTestControlPlane("cv-1")
+		pinned, err := reconcileRollback(ctx, rollbackTestClient(t, cp), cp, &cp.Status.Terraform, "hash-cv-4")
+		if err != nil || !pinned || cp.Status.Terraform.ConfigurationVersionID != "cv-1" {
+			t.Fatalf("expected a pin to cv-1, got %t, %q, %v", pinned, cp.Status.Terraform.ConfigurationVersionID, err)
+		}
+	})
+
+	t.Run("unknown target", func(t *testing.T) {
+		cp := rollbackTestControlPlane("cv-9")
+		pinned, err := reconcileRollback(ctx, rollbackTestClient(t, cp), cp, &cp.Status.Terraform, "hash-cv-4")
+		if err == nil || !pinned {
+			t.Fatalf("expected an error and no automatic runs, got %t, %v", pinned, err)
+		}
+		if cp.Status.Terraform.ConfigurationVersionID != "cv-3" {
+			t.Errorf("expected the configuration version not to change, got %q", cp.Status.Terraform.ConfigurationVersionID)
+		}
+		if conditions.GetReason(cp, infrastructurev1alpha1.ConfigurationSyncedCondition) != infrastructurev1alpha1.RollbackTargetNotFoundReason {
+			t.Error("expected ConfigurationSynced to be false with reason RollbackTargetNotFound")
+		}
+	})
+
+	t.Run("spec matches", func(t *testing.T) {
+		cp := rollbackTestControlPlane("2")
+		c := rollbackTestClient(t, cp)
+		pinned, err := reconcileRollback(ctx, c, cp, &cp.Status.Terraform, "hash-cv-2")
+		if err != nil || pinned {
+			t.Fatalf("expected the pin to be cleared, got %t, %v", pinned, err)
+		}
+		if cp.Status.Terraform.ConfigurationVersionID != "cv-2" {
+			t.Errorf("expected cv-2 to be kept, got %q", cp.Status.Terraform.ConfigurationVersionID)
+		}
+		var stored infrastructurev1alpha1.TFCManagedControlPlane
+		if err := c.Get(ctx, client.ObjectKeyFromObject(cp), &stored); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := stored.Annotations[infrastructurev1alpha1.RollbackAnnotation]; ok {
+			t.Error("expected the rollback annotation to be removed")
+		}
+	})
+}
+
+func TestRecordConfigurationHistory(t *testing.T) {
+	var status infrastructurev1alpha1.TerraformStatus
+	for i := 1; i <= maxConfigurationHistory+2; i++ {
+		recordConfigurationHistory(&status, infrastructurev1alpha1.ConfigurationHistoryEntry{Revision: int64(i)})
+	}
+	if len(status.ConfigurationHistory) != maxConfigurationHistory {
+		t.Fatalf("expected %d entries, got %d", maxConfigurationHistory, len(status.ConfigurationHistory))
+	}
+	if status.ConfigurationHistory[0].Revision != 3 {
+		t.Errorf("expected the oldest entries to be dropped, first is revision %d", status.ConfigurationHistory[0].Revision)
+	}
+}
@@ -19,27 +19,31 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"os"
 	"time"
 
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/predicates"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/backend"
 	"github.com/hashicorp/cluster-api-provider-terraform-cloud/terraform"
-	"github.com/hashicorp/go-tfe"
-
-	tfc "github.com/hashicorp/go-tfe"
 )
 
 const tfcManagedControlPlaneFinalizer = "infrastructure.cluster.x-k8s.io/tfc-managed-control-plane"
@@ -48,19 +52,38 @@ const tfcManagedControlPlaneFinalizer = "infrastructure.cluster.x-k8s.io/tfc-man
 type TFCManagedControlPlaneReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// TFCClients caches the Terraform Cloud clients shared by the controllers
+	TFCClients *backend.ClientCache
+
+	// PodLogs reads the logs of the Jobs of the local backend.
+	PodLogs corev1client.PodsGetter
+
+	// WatchFilterValue is the label value used to filter events prior to reconciliation.
+	WatchFilterValue string
+
+	// MaxConcurrentReconciles is the number of resources reconciled at the same time.
+	MaxConcurrentReconciles int
+
+	// RequeueIntervals are how long to wait before reconciling a resource again.
+	RequeueIntervals RequeueIntervals
 }
 
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=tfcmanagedcontrolplanes,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=tfcmanagedcontrolplanes/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=tfcmanagedcontrolplanes/finalizers,verbs=update
-//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups="",resources=secrets;configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list
+//+kubebuilder:rbac:groups="",resources=pods/log,verbs=get
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.13.0/pkg/reconcile
-func (r *TFCManagedControlPlaneReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *TFCManagedControlPlaneReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, reterr error) {
 	logger := log.FromContext(ctx)
 	logger.Info("Reconciling TFCManagedControlPlane")
 
@@ -86,221 +109,243 @@ func (r *TFCManagedControlPlaneReconciler) Reconcile(ctx context.Context, req ct
 		return ctrl.Result{}, nil
 	}
 
-	// add controller finalizer
-	addFinalizer(ctx, r.Client, &cluster, tfcManagedControlPlaneFinalizer)
-
-	// read the token secret
-	var tokenSecret corev1.Secret
-	err = r.Client.Get(ctx, types.NamespacedName{Name: terraformCloudTokenSecretName, Namespace: req.Namespace}, &tokenSecret)
-	if err != nil {
-		logger.Error(err, "Could not find token Secret object")
-		return ctrl.Result{}, err
+	if annotations.IsPaused(ownerCluster, &cluster) {
+		logger.Info("TFCManagedControlPlane or linked Cluster is marked as paused, won't reconcile")
+		return ctrl.Result{}, nil
 	}
-	token := string(tokenSecret.Data["value"])
 
-	// create the TFC client
-	tfcClient, err := tfc.NewClient(&tfc.Config{
-		Token: token,
-	})
+	// persist the changes made to the control plane once the reconcile ends
+	patcher, err := newObjectPatcher(r.Client, &cluster)
 	if err != nil {
-		logger.Error(err, "Error creating Terraform Cloud client")
+		logger.Error(err, "Error creating patch helper")
 		return ctrl.Result{}, err
 	}
+	defer patcher.patchOnExit(ctx, &result, &reterr)
+
+	// add controller finalizer
+	addFinalizer(&cluster, tfcManagedControlPlaneFinalizer)
 
-	// get the TFC workspace
-	workspace, err := tfcClient.Workspaces.Read(ctx, cluster.Spec.Organization, cluster.Spec.Workspace)
+	// get the backend executing Terraform runs, in Terraform Cloud or in local Jobs
+	tfBackend, err := newBackend(ctx, r.Client, r.TFCClients, r.PodLogs, r.Scheme, &cluster, cluster.Spec.Organization, cluster.Spec.Workspace, &cluster.Status.Terraform)
 	if err != nil {
-		logger.Error(err, "Error getting Terraform Cloud Workspace")
+		logger.Error(err, "Error creating Terraform backend")
 		return ctrl.Result{}, err
 	}
+	defer forgetMissingWorkspace(tfBackend, &cluster.Status.Terraform)
+
+	m := &phaseMachine{
+		client:      r.Client,
+		scheme:      r.Scheme,
+		backend:     tfBackend,
+		resource:    &controlPlanePhases{r: r, cluster: &cluster, ownerCluster: ownerCluster},
+		patcher:     patcher,
+		clusterName: ownerCluster.Name,
+		finalizer:   tfcManagedControlPlaneFinalizer,
+		requeue:     r.RequeueIntervals.withDefaults(),
+		autoApply:   cluster.Spec.AutoApply,
+	}
 
 	// run a destroy if the Kubernetes resource is deleted
-	// TODO: move this into a reconcileDelete() function
 	if !cluster.ObjectMeta.DeletionTimestamp.IsZero() {
-		if controllerutil.ContainsFinalizer(&cluster, tfcManagedControlPlaneFinalizer) {
-			logger.Info("Resource is deleted, triggering destroy")
-
-			// trigger destroy run
-			_, err := tfcClient.Runs.Create(ctx, tfc.RunCreateOptions{
-				Message:   tfc.String(fmt.Sprintf("%s: Destroy Control Plane %q", terraformCloudRunMessage, cluster.ObjectMeta.Name)),
-				Workspace: workspace,
-				AutoApply: tfc.Bool(true),
-				IsDestroy: tfc.Bool(true),
-			})
-			if err != nil {
-				logger.Error(err, "Error triggering destroy run")
-				return ctrl.Result{}, err
-			}
-
-			// delete the kubeconfig secret
-			err = r.Client.Delete(ctx, &corev1.Secret{ObjectMeta: v1.ObjectMeta{
-				Namespace: cluster.GetNamespace(),
-				Name:      fmt.Sprintf("%s-kubeconfig", cluster.GetName()),
-			}})
-			if err != nil && !errors.IsNotFound(err) {
-				logger.Error(err, "Error deleting kubeconfig secret")
-				return ctrl.Result{}, err
-			}
-
-			// TODO: wait until the destroy plan has completed
-			controllerutil.RemoveFinalizer(&cluster, tfcManagedControlPlaneFinalizer)
-			err = r.Client.Update(ctx, &cluster)
-			if err != nil {
-				logger.Error(err, "Error removing finalizer")
-				return ctrl.Result{}, err
-			}
-		}
-		return ctrl.Result{}, nil
+		return m.reconcileDelete(ctx)
 	}
+	return m.reconcile(ctx)
+}
 
-	// generate the Terraform config
-	terraformConfigPath, configHash, err := terraform.CreateConfiguration(terraform.ManagedClusterConfigurationTemplate, &cluster, &ownerCluster)
-	defer os.RemoveAll(terraformConfigPath)
-	if err != nil {
-		logger.Error(err, "Error generating Terraform configuration")
-		return ctrl.Result{}, err
-	}
+// controlPlanePhases reconciles the parts of the phases of a TFCManagedControlPlane specific to control planes
+type controlPlanePhases struct {
+	r            *TFCManagedControlPlaneReconciler
+	cluster      *infrastructurev1alpha1.TFCManagedControlPlane
+	ownerCluster *clusterv1beta1.Cluster
+}
 
-	// upload the terraform configuration
-	configurationVersionID := cluster.Status.Terraform.ConfigurationVersionID
-	if configurationVersionID == "" || configHash != cluster.Status.Terraform.ConfigurationHash {
-		// create a new ConfigurationVersion
-		logger.Info("Creating new Terraform ConfigurationVersion")
-		cv, err := tfcClient.ConfigurationVersions.Create(ctx, workspace.ID, tfc.ConfigurationVersionCreateOptions{
-			AutoQueueRuns: tfc.Bool(false),
-		})
-		if err != nil {
-			logger.Error(err, "Error creating new Terraform Cloud ConfigurationVersion")
-			return requeueAfterSeconds(30)
-		}
+func (p *controlPlanePhases) object() phaseObject {
+	return p.cluster
+}
 
-		// upload the terraform config
-		logger.Info("Uploading Terraform Configuration")
-		err = tfcClient.ConfigurationVersions.Upload(ctx, cv.UploadURL, terraformConfigPath)
-		if err != nil {
-			logger.Error(err, "Error uploading configuration to ConfigurationVersion")
-			return requeueAfterSeconds(30)
-		}
+func (p *controlPlanePhases) description() string {
+	return fmt.Sprintf("Control Plane %q", p.cluster.Name)
+}
+
+func (p *controlPlanePhases) revisionHistoryLimit() *int32 {
+	return p.cluster.Spec.RevisionHistoryLimit
+}
 
-		configurationVersionID = cv.ID
-		cluster.Status.Terraform.ConfigurationVersionID = configurationVersionID
-		cluster.Status.Terraform.ConfigurationHash = configHash
-		cluster.Status.Terraform.RunID = ""
-		cluster.Status.Terraform.RunStatus = ""
-		r.Client.Status().Update(ctx, &cluster)
-		return requeueAfterSeconds(30)
+// validate refuses version changes that Kubernetes does not support
+func (p *controlPlanePhases) validate(ctx context.Context) error {
+	if !upgradingVersion(p.cluster) {
+		return nil
 	}
+	if err := validateVersionUpgrade(*p.cluster.Status.Version, p.cluster.Spec.Version); err != nil {
+		conditions.MarkFalse(p.cluster, infrastructurev1alpha1.VersionUpgradeCondition,
+			infrastructurev1alpha1.UnsupportedVersionSkewReason, clusterv1beta1.ConditionSeverityError, "%s", err.Error())
+		return err
+	}
+	return nil
+}
 
-	cv, err := tfcClient.ConfigurationVersions.Read(ctx, configurationVersionID)
-	if err != nil {
-		logger.Error(err, "Error reading ConfigurationVersion")
-		return requeueAfterSeconds(30)
+func (p *controlPlanePhases) configuration(ctx context.Context) (map[string][]byte, error) {
+	return terraform.ManagedControlPlaneFiles(ctx, p.r.Client, p.cluster, p.ownerCluster)
+}
+
+func (p *controlPlanePhases) configurationUploaded() {}
+
+// needsPlan reviews a speculative plan before upgrading the cluster
+func (p *controlPlanePhases) needsPlan() bool {
+	return upgradingVersion(p.cluster)
+}
+
+func (p *controlPlanePhases) reviewPlan(ctx context.Context, b backend.Backend, configurationVersionID string) (bool, error) {
+	approved, err := p.r.reviewUpgradePlan(ctx, b, configurationVersionID, p.cluster)
+	if err != nil || !approved {
+		return false, err
 	}
+	conditions.MarkFalse(p.cluster, infrastructurev1alpha1.VersionUpgradeCondition,
+		infrastructurev1alpha1.WaitingForTerraformRunReason, clusterv1beta1.ConditionSeverityInfo,
+		"Upgrading from %s to %s", *p.cluster.Status.Version, p.cluster.Spec.Version)
+	return true, nil
+}
 
-	if cv.Status != tfe.ConfigurationUploaded {
-		logger.Info("ConfigurationVersion not ready yet")
-		return ctrl.Result{Requeue: true, RequeueAfter: 60 * time.Second}, nil
+func (p *controlPlanePhases) observeRun(run *backend.Run) {
+	if run.Status != backend.RunApplied && !conditions.IsTrue(p.cluster, infrastructurev1alpha1.WorkloadClusterReadyCondition) {
+		conditions.MarkFalse(p.cluster, infrastructurev1alpha1.WorkloadClusterReadyCondition,
+			infrastructurev1alpha1.WaitingForTerraformRunReason, clusterv1beta1.ConditionSeverityInfo,
+			"Terraform run %s is %s", run.ID, run.Status)
 	}
+}
 
-	// check if there is a run in progress
-	runID := cluster.Status.Terraform.RunID
-	if runID == "" {
-		// trigger a new run
-		logger.Info("Triggering Terraform Cloud Run")
-		run, err := tfcClient.Runs.Create(ctx, tfc.RunCreateOptions{
-			Message:              tfc.String(fmt.Sprintf("%s: Reconcile Control Plane %q", terraformCloudRunMessage, cluster.ObjectMeta.Name)),
-			Workspace:            workspace,
-			AutoApply:            tfc.Bool(true),
-			ConfigurationVersion: cv,
-		})
-		if err != nil {
-			logger.Error(err, "Error triggering new Terraform run")
-			return requeueAfterSeconds(30)
-		}
+func (p *controlPlanePhases) runFailed(run *backend.Run) {}
+
+// provision reads the control plane endpoint and kubeconfig from the outputs of the run, and
+// marks the control plane as ready once the workload cluster API server responds
+func (p *controlPlanePhases) provision(ctx context.Context, m *phaseMachine, run *backend.Run) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	r, cluster, ownerCluster := p.r, p.cluster, p.ownerCluster
 
-		// set status
-		cluster.Status.Terraform.RunID = run.ID
-		cluster.Status.Terraform.RunStatus = string(run.Status)
-		cluster.Status.Terraform.RunStartedAt = metav1.NewTime(time.Now())
-		r.Client.Status().Update(ctx, &cluster)
-		return ctrl.Result{Requeue: true, RequeueAfter: 60 * time.Second}, nil
+	stateVersionID, outputs, err := m.backend.Outputs(ctx, run, cluster.Status.Terraform.StateVersionID)
+	if backend.IsStateVersionNotReady(err) {
+		logger.Info("Waiting for Terraform state version", "reason", err.Error())
+		return requeueAfter(m.requeue.Short)
+	}
+	if err != nil {
+		logger.Error(err, "Error reading terraform run state")
+		return requeueAfter(m.requeue.Default)
+	}
+	fields, err := reconcileOutputs(ctx, r.Client, r.Scheme, cluster, ownerCluster, &cluster.Status.Terraform, cluster.Spec.GetOutputs(), outputs)
+	if err != nil {
+		logger.Error(err, "Error reading Terraform outputs")
+		return requeueAfter(m.requeue.Default)
+	}
+	host, err := outputString(infrastructurev1alpha1.OutputFieldControlPlaneEndpointHost, fields[infrastructurev1alpha1.OutputFieldControlPlaneEndpointHost], false)
+	if err != nil {
+		logger.Error(err, "Error reading control plane endpoint")
+		return requeueAfter(m.requeue.Default)
+	}
+	port, err := outputInt32(infrastructurev1alpha1.OutputFieldControlPlaneEndpointPort, fields[infrastructurev1alpha1.OutputFieldControlPlaneEndpointPort])
+	if err != nil {
+		logger.Error(err, "Error reading control plane endpoint")
+		return requeueAfter(m.requeue.Default)
+	}
+	cluster.Spec.ControlPlaneEndpoint.Host = host
+	cluster.Spec.ControlPlaneEndpoint.Port = port
+	cluster.Status.Terraform.StateVersionID = stateVersionID
+	if cluster.Status.Terraform.RunFinishedAt.IsZero() {
+		cluster.Status.Terraform.RunFinishedAt = metav1.NewTime(time.Now())
 	}
 
-	run, err := tfcClient.Runs.Read(ctx, runID)
+	// create the Cluster API kubeconfig Secret
+	kubeconfig, err := r.kubeconfigFromOutputs(ctx, cluster, ownerCluster, fields)
 	if err != nil {
-		logger.Error(err, "Error reading Terraform Cloud Run")
-		return requeueAfterSeconds(30)
+		logger.Error(err, "Error reading kubeconfig")
+		return requeueAfter(m.requeue.Default)
+	}
+	if err := r.reconcileKubeconfig(ctx, cluster, ownerCluster, kubeconfig); err != nil {
+		logger.Error(err, "Error creating kubeconfig Secret")
+		return ctrl.Result{}, err
 	}
 
-	cluster.Status.Terraform.RunStatus = string(run.Status)
-	r.Client.Status().Update(ctx, &cluster)
-
-	switch run.Status {
-	case tfc.RunDiscarded:
-		logger.Info("The Terraform Cloud run was discarded")
-	case tfc.RunCanceled:
-		logger.Info("The Terraform Cloud run was cancelled")
-	case tfc.RunErrored:
-		logger.Info("The Terraform Cloud run produced an error")
-	case tfc.RunPlannedAndFinished:
-	case tfc.RunApplied:
-		// TODO: we're going to want some kind of standard way to confirm
-		// that the cluster is ready after a terraform apply is done
-		cluster.Status.Initialized = true
-		cluster.Status.Ready = true
-		cluster.Status.Terraform.RunFinishedAt = metav1.NewTime(time.Now())
-		r.Client.Status().Update(ctx, &cluster)
+	// renew the token of a generated kubeconfig before it expires
+	refreshIn := tokenRefreshIn(cluster)
+	if refreshIn != nil && *refreshIn <= 0 {
+		logger.Info("Triggering Terraform refresh-only run to renew the kubeconfig token")
+		return m.startRun(ctx, backend.RunOptions{
+			Message:     fmt.Sprintf("%s: Refresh credentials of Control Plane %q", terraformCloudRunMessage, cluster.ObjectMeta.Name),
+			RefreshOnly: true,
+		})
+	}
 
-		outputs, err := tfcClient.StateVersions.ListOutputs(ctx,
-			workspace.CurrentStateVersion.ID, &tfc.StateVersionOutputsListOptions{})
-		if err != nil {
-			logger.Error(err, "Error reading terraform run state")
-			return requeueAfterSeconds(30)
-		}
-		// TODO: getOutput() function
-		var kubeconfig string
-		for _, o := range outputs.Items {
-			switch o.Name {
-			case "control_plane_endpoint_host":
-				cluster.Spec.ControlPlaneEndpoint.Host = o.Value.(string)
-			case "control_plane_endpoint_port":
-				cluster.Spec.ControlPlaneEndpoint.Port = int32(o.Value.(float64))
-			case "kubeconfig":
-				kubeconfig = o.Value.(string)
-			}
-		}
-		r.Client.Update(ctx, &cluster)
-
-		// create secret containing kubeconfig
-		// TODO: createKubeconfig function
-		secret := corev1.Secret{
-			TypeMeta: v1.TypeMeta{
-				APIVersion: "v1",
-				Kind:       "Secret",
-			},
-			ObjectMeta: v1.ObjectMeta{
-				Namespace: cluster.GetNamespace(),
-				Name:      fmt.Sprintf("%s-kubeconfig", cluster.GetName()),
-			},
-			StringData: map[string]string{
-				"value": kubeconfig,
-			},
-		}
-		err = r.Client.Patch(ctx, &secret, client.Apply, client.FieldOwner("terraform-cloud-cluster"))
-		if err != nil {
-			logger.Error(err, "Error creating kubeconfig Secret")
-			return ctrl.Result{}, err
-		}
-	default:
-		// run is still in progress
-		return requeueAfterSeconds(30)
+	// confirm the workload cluster is ready before marking the control plane as ready
+	if err := r.reconcileReadiness(ctx, cluster, kubeconfig); err != nil {
+		logger.Info("Workload cluster is not ready yet", "reason", err.Error())
+		cluster.Status.Ready = false
+		return requeueAfter(m.requeue.Default)
+	}
+	if conditions.Has(cluster, infrastructurev1alpha1.VersionUpgradeCondition) {
+		conditions.MarkTrue(cluster, infrastructurev1alpha1.VersionUpgradeCondition)
+	}
+	cluster.Status.Initialized = true
+	cluster.Status.Ready = true
+	if refreshIn != nil {
+		return ctrl.Result{RequeueAfter: *refreshIn}, nil
 	}
 	return ctrl.Result{}, nil
 }
 
+func (p *controlPlanePhases) cleanup(ctx context.Context) error {
+	return nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
-func (r *TFCManagedControlPlaneReconciler) SetupWithManager(mgr ctrl.Manager) error {
+func (r *TFCManagedControlPlaneReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
+	logger := log.FromContext(ctx)
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&infrastructurev1alpha1.TFCManagedControlPlane{}).
+		For(
+			&infrastructurev1alpha1.TFCManagedControlPlane{},
+			builder.WithPredicates(predicates.ResourceNotPausedAndHasFilterLabel(logger, r.WatchFilterValue)),
+		).
+		Owns(&batchv1.Job{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Watches(
+			&source.Kind{Type: &clusterv1beta1.Cluster{}},
+			handler.EnqueueRequestsFromMapFunc(clusterToTFCManagedControlPlane),
+			builder.WithPredicates(predicates.ClusterUnpaused(logger), predicates.ResourceHasFilterLabel(logger, r.WatchFilterValue)),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(tokenSecretToObjectsMapFunc(ctx, r.Client, &infrastructurev1alpha1.TFCManagedControlPlaneList{}, r.WatchFilterValue)),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(configurationSourceToObjectsMapFunc(ctx, r.Client, &infrastructurev1alpha1.TFCManagedControlPlaneList{}, r.WatchFilterValue)),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(configurationSourceToObjectsMapFunc(ctx, r.Client, &infrastructurev1alpha1.TFCManagedControlPlaneList{}, r.WatchFilterValue)),
+		).
 		Complete(r)
 }
+
+// clusterToTFCManagedControlPlane maps a Cluster to the TFCManagedControlPlane
+// referenced as its control plane or infrastructure.
+func clusterToTFCManagedControlPlane(o client.Object) []reconcile.Request {
+	c, ok := o.(*clusterv1beta1.Cluster)
+	if !ok {
+		return nil
+	}
+
+	gk := infrastructurev1alpha1.GroupVersion.WithKind("TFCManagedControlPlane").GroupKind()
+	for _, ref := range []*corev1.ObjectReference{c.Spec.ControlPlaneRef, c.Spec.InfrastructureRef} {
+		if ref == nil || ref.GroupVersionKind().GroupKind() != gk {
+			continue
+		}
+		return []reconcile.Request{
+			{
+				NamespacedName: client.ObjectKey{
+					Namespace: c.Namespace,
+					Name:      ref.Name,
+				},
+			},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	tfc "github.com/hashicorp/go-tfe"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/secret"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/backend"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/backend/tfcfake"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: example
+  cluster:
+    server: https://10.0.0.1:6443
+contexts:
+- name: example
+  context:
+    cluster: example
+current-context: example
+`
+
+// testControlPlaneOutputs are the outputs of a control plane module
+var testControlPlaneOutputs = map[string]any{
+	"control_plane_endpoint_host": "10.0.0.1",
+	"control_plane_endpoint_port": float64(6443),
+	"kubeconfig":                  testKubeconfig,
+}
+
+// createTestNamespace creates a namespace holding the token Secret, so that every spec
+// starts from an empty namespace
+func createTestNamespace() string {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "test-"}}
+	Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+	Expect(k8sClient.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: terraformCloudTokenSecretName, Namespace: ns.Name},
+		Data:       map[string][]byte{"value": []byte("token")},
+	})).To(Succeed())
+	return ns.Name
+}
+
+// createTestCluster creates a Cluster whose control plane is the named TFCManagedControlPlane
+func createTestCluster(namespace, controlPlane string) *clusterv1beta1.Cluster {
+	cluster := &clusterv1beta1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: namespace},
+		Spec: clusterv1beta1.ClusterSpec{
+			ControlPlaneRef: &corev1.ObjectReference{
+				APIVersion: infrastructurev1alpha1.GroupVersion.String(),
+				Kind:       "TFCManagedControlPlane",
+				Name:       controlPlane,
+				Namespace:  namespace,
+			},
+		},
+	}
+	Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+	return cluster
+}
+
+var _ = Describe("TFCManagedControlPlane controller", func() {
+	var (
+		fake       *tfcfake.TerraformCloud
+		workspace  *tfc.Workspace
+		reconciler *TFCManagedControlPlaneReconciler
+		namespace  string
+		key        client.ObjectKey
+	)
+
+	reconcile := func() (ctrl.Result, error) {
+		return reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	}
+
+	get := func() *infrastructurev1alpha1.TFCManagedControlPlane {
+		var controlPlane infrastructurev1alpha1.TFCManagedControlPlane
+		Expect(k8sClient.Get(ctx, key, &controlPlane)).To(Succeed())
+		return &controlPlane
+	}
+
+	// apply reconciles until the first run is created, finishes it and reconciles the outputs
+	apply := func() {
+		_, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		runID := get().Status.Terraform.RunID
+		Expect(runID).NotTo(BeEmpty())
+		Expect(fake.FinishRun(runID, tfc.RunApplied, testControlPlaneOutputs, nil)).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		fake = tfcfake.New()
+		workspace = fake.CreateWorkspace("example-org", "example-cluster")
+		reconciler = &TFCManagedControlPlaneReconciler{
+			Client:     k8sClient,
+			Scheme:     scheme.Scheme,
+			TFCClients: backend.NewClientCache(fake.ClientFactory()),
+		}
+
+		namespace = createTestNamespace()
+		cluster := createTestCluster(namespace, "example-control-plane")
+		controlPlane := &infrastructurev1alpha1.TFCManagedControlPlane{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "example-control-plane",
+				Namespace: namespace,
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: clusterv1beta1.GroupVersion.String(),
+					Kind:       "Cluster",
+					Name:       cluster.Name,
+					UID:        cluster.UID,
+				}},
+			},
+			Spec: infrastructurev1alpha1.TFCManagedControlPlaneSpec{
+				Organization:   "example-org",
+				Workspace:      "example-cluster",
+				Module:         infrastructurev1alpha1.TerraformModule{Source: "example/cluster/google", Version: "1.0.0"},
+				Version:        "1.25.0",
+				AutoApply:      true,
+				Variables:      []infrastructurev1alpha1.Variable{},
+				ReadinessCheck: infrastructurev1alpha1.ReadinessCheck{Disabled: true},
+			},
+		}
+		Expect(k8sClient.Create(ctx, controlPlane)).To(Succeed())
+		key = client.ObjectKeyFromObject(controlPlane)
+	})
+
+	It("uploads the configuration, applies it and publishes the outputs", func() {
+		_, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		controlPlane := get()
+		Expect(controllerutil.ContainsFinalizer(controlPlane, tfcManagedControlPlaneFinalizer)).To(BeTrue())
+		cvID := controlPlane.Status.Terraform.ConfigurationVersionID
+		Expect(cvID).NotTo(BeEmpty())
+		Expect(fake.Uploads(cvID)).To(HaveKeyWithValue("main.tf", MatchRegexp(`kubernetes_version\s+= "1.25.0"`)))
+		Expect(controlPlane.Status.Terraform.ConfigurationRevision).To(Equal(int64(1)))
+		Expect(controlPlane.Status.Terraform.WorkspaceID).To(Equal(workspace.ID))
+		Expect(controlPlane.Status.Phase).To(Equal(infrastructurev1alpha1.PhaseUploading))
+
+		// the cached workspace ID is used instead of looking the workspace up again
+		fake.SetError("Workspaces.Read", errors.New("rate limited"))
+
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		controlPlane = get()
+		runs := fake.Runs()
+		Expect(runs).To(HaveLen(1))
+		Expect(runs[0].AutoApply).To(BeTrue())
+		Expect(runs[0].ConfigurationVersion.ID).To(Equal(cvID))
+		Expect(controlPlane.Status.Terraform.RunID).To(Equal(runs[0].ID))
+		Expect(controlPlane.Status.Terraform.RunStatus).To(Equal(string(tfc.RunPending)))
+		Expect(controlPlane.Status.Phase).To(Equal(infrastructurev1alpha1.PhaseApplying))
+
+		fake.SetError("Workspaces.Read", nil)
+
+		// the run is still in progress
+		result, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(30 * time.Second))
+		Expect(conditions.IsFalse(get(), infrastructurev1alpha1.WorkloadClusterReadyCondition)).To(BeTrue())
+
+		Expect(fake.FinishRun(runs[0].ID, tfc.RunApplied, testControlPlaneOutputs, nil)).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+
+		controlPlane = get()
+		Expect(controlPlane.Spec.ControlPlaneEndpoint).To(Equal(clusterv1beta1.APIEndpoint{Host: "10.0.0.1", Port: 6443}))
+		Expect(controlPlane.Status.Ready).To(BeTrue())
+		Expect(controlPlane.Status.Initialized).To(BeTrue())
+		Expect(controlPlane.Status.Version).To(HaveValue(Equal("1.25.0")))
+		Expect(controlPlane.Status.Terraform.StateVersionID).NotTo(BeEmpty())
+		Expect(controlPlane.Status.Terraform.RunFinishedAt.IsZero()).To(BeFalse())
+		Expect(controlPlane.Status.Phase).To(Equal(infrastructurev1alpha1.PhaseProvisioned))
+
+		var kubeconfig corev1.Secret
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: secret.Name("example", secret.Kubeconfig)}, &kubeconfig)).To(Succeed())
+		Expect(kubeconfig.Type).To(Equal(clusterv1beta1.ClusterSecretType))
+		Expect(string(kubeconfig.Data[secret.KubeconfigDataName])).To(Equal(testKubeconfig))
+
+		// nothing changed, so nothing is uploaded or run again
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(get().Status.Terraform.ConfigurationVersionID).To(Equal(cvID))
+		Expect(fake.Runs()).To(HaveLen(1))
+	})
+
+	It("renews a generated token with a refresh-only run that finishes without changes", func() {
+		controlPlane := get()
+		controlPlane.Spec.Kubeconfig = infrastructurev1alpha1.KubeconfigSpec{
+			Generate: true,
+			TokenTTL: &metav1.Duration{Duration: time.Hour},
+		}
+		Expect(k8sClient.Update(ctx, controlPlane)).To(Succeed())
+		outputs := map[string]any{
+			"control_plane_endpoint_host": "10.0.0.1",
+			"control_plane_endpoint_port": float64(6443),
+			"cluster_ca_certificate":      "-----BEGIN CERTIFICATE-----\nZXhhbXBsZQ==\n-----END CERTIFICATE-----\n",
+			"token":                       "example-token",
+		}
+		kubeconfigKey := client.ObjectKey{Namespace: namespace, Name: secret.Name("example", secret.Kubeconfig)}
+
+		_, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fake.FinishRun(get().Status.Terraform.RunID, tfc.RunApplied, outputs, nil)).To(Succeed())
+		result, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", 50*time.Minute, time.Minute))
+
+		// the token is about to expire
+		controlPlane = get()
+		controlPlane.Status.Terraform.RunFinishedAt = metav1.NewTime(time.Now().Add(-55 * time.Minute))
+		Expect(k8sClient.Status().Update(ctx, controlPlane)).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		runs := fake.Runs()
+		Expect(runs).To(HaveLen(2))
+		Expect(runs[1].RefreshOnly).To(BeTrue())
+
+		// the refresh finds nothing to change, and the kubeconfig is still written from the current state
+		Expect(k8sClient.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: kubeconfigKey.Namespace, Name: kubeconfigKey.Name}})).To(Succeed())
+		Expect(fake.FinishRun(runs[1].ID, tfc.RunPlannedAndFinished, nil, nil)).To(Succeed())
+		result, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", 50*time.Minute, time.Minute))
+		controlPlane = get()
+		Expect(controlPlane.Status.Phase).To(Equal(infrastructurev1alpha1.PhaseProvisioned))
+		Expect(controlPlane.Status.TokenExpiresAt.Time).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+		var kubeconfig corev1.Secret
+		Expect(k8sClient.Get(ctx, kubeconfigKey, &kubeconfig)).To(Succeed())
+		Expect(string(kubeconfig.Data[secret.KubeconfigDataName])).To(ContainSubstring("example-token"))
+		Expect(fake.Runs()).To(HaveLen(2))
+	})
+
+	It("reviews a speculative plan before applying a version upgrade", func() {
+		apply()
+		previousCV := get().Status.Terraform.ConfigurationVersionID
+
+		controlPlane := get()
+		controlPlane.Spec.Version = "1.26.0"
+		Expect(k8sClient.Update(ctx, controlPlane)).To(Succeed())
+
+		// the changed configuration is uploaded
+		_, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		controlPlane = get()
+		cvID := controlPlane.Status.Terraform.ConfigurationVersionID
+		Expect(cvID).NotTo(Equal(previousCV))
+		Expect(fake.Uploads(cvID)).To(HaveKeyWithValue("main.tf", MatchRegexp(`kubernetes_version\s+= "1.26.0"`)))
+		Expect(controlPlane.Status.Terraform.RunID).To(BeEmpty())
+		Expect(controlPlane.Status.Terraform.ConfigurationHistory).To(HaveLen(2))
+
+		// a plan-only run is queued first
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		controlPlane = get()
+		planRunID := controlPlane.Status.Terraform.PlanRunID
+		Expect(planRunID).NotTo(BeEmpty())
+		Expect(controlPlane.Status.Terraform.RunID).To(BeEmpty())
+		runs := fake.Runs()
+		Expect(runs).To(HaveLen(2))
+		Expect(runs[1].PlanOnly).To(BeTrue())
+		Expect(conditions.GetReason(controlPlane, infrastructurev1alpha1.VersionUpgradeCondition)).To(Equal(infrastructurev1alpha1.WaitingForUpgradePlanReason))
+		Expect(controlPlane.Status.Phase).To(Equal(infrastructurev1alpha1.PhasePlanning))
+
+		// the upgrade is applied once the plan finished without replacing resources
+		Expect(fake.FinishRun(planRunID, tfc.RunPlannedAndFinished, nil, []byte(`{"resource_changes":[]}`))).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		controlPlane = get()
+		runs = fake.Runs()
+		Expect(runs).To(HaveLen(3))
+		Expect(runs[2].AutoApply).To(BeTrue())
+		Expect(runs[2].ConfigurationVersion.ID).To(Equal(cvID))
+		Expect(controlPlane.Status.Terraform.RunID).To(Equal(runs[2].ID))
+
+		Expect(fake.FinishRun(runs[2].ID, tfc.RunApplied, testControlPlaneOutputs, nil)).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		controlPlane = get()
+		Expect(controlPlane.Status.Version).To(HaveValue(Equal("1.26.0")))
+		Expect(conditions.IsTrue(controlPlane, infrastructurev1alpha1.VersionUpgradeCondition)).To(BeTrue())
+	})
+
+	It("retries when a run cannot be created and reports errored runs", func() {
+		_, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+
+		fake.SetError("Runs.Create", errors.New("service unavailable"))
+		result, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(30 * time.Second))
+		Expect(get().Status.Terraform.RunID).To(BeEmpty())
+
+		fake.SetError("Runs.Create", nil)
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		runID := get().Status.Terraform.RunID
+		Expect(runID).NotTo(BeEmpty())
+
+		Expect(fake.FinishRun(runID, tfc.RunErrored, nil, nil)).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		controlPlane := get()
+		Expect(controlPlane.Status.Terraform.RunStatus).To(Equal(string(tfc.RunErrored)))
+		Expect(controlPlane.Status.Ready).To(BeFalse())
+		Expect(controlPlane.Status.Phase).To(Equal(infrastructurev1alpha1.PhaseFailed))
+		Expect(conditions.GetMessage(controlPlane, infrastructurev1alpha1.WorkloadClusterReadyCondition)).To(ContainSubstring("errored"))
+	})
+
+	It("returns an error when the workspace does not exist", func() {
+		controlPlane := get()
+		controlPlane.Spec.Workspace = "missing"
+		Expect(k8sClient.Update(ctx, controlPlane)).To(Succeed())
+
+		_, err := reconcile()
+		Expect(err).To(MatchError(tfc.ErrResourceNotFound))
+		Expect(fake.Runs()).To(BeEmpty())
+	})
+
+	It("looks the workspace up again once its cached ID is not found", func() {
+		_, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(get().Status.Terraform.WorkspaceID).To(Equal(workspace.ID))
+
+		// the workspace was deleted and recreated
+		fake.SetError("Runs.Create", tfc.ErrResourceNotFound)
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(get().Status.Terraform.WorkspaceID).To(BeEmpty())
+
+		fake.SetError("Runs.Create", nil)
+		fake.SetError("Workspaces.Read", errors.New("rate limited"))
+		_, err = reconcile()
+		Expect(err).To(MatchError("could not read Terraform Cloud workspace: rate limited"))
+
+		fake.SetError("Workspaces.Read", nil)
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		controlPlane := get()
+		Expect(controlPlane.Status.Terraform.WorkspaceID).To(Equal(workspace.ID))
+		Expect(controlPlane.Status.Terraform.RunID).NotTo(BeEmpty())
+	})
+
+	It("queues a destroy run and removes the finalizer when deleted", func() {
+		apply()
+		Expect(k8sClient.Delete(ctx, get())).To(Succeed())
+
+		_, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		runs := fake.Runs()
+		Expect(runs).To(HaveLen(2))
+		Expect(runs[1].IsDestroy).To(BeTrue())
+		Expect(runs[1].AutoApply).To(BeTrue())
+
+		var controlPlane infrastructurev1alpha1.TFCManagedControlPlane
+		err = k8sClient.Get(ctx, key, &controlPlane)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -19,28 +19,41 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"os"
+	"strconv"
 	"time"
 
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/types"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/utils/pointer"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/controllers/remote"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 	expclusterv1beta1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	exputil "sigs.k8s.io/cluster-api/exp/util"
 	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/predicates"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/backend"
 	"github.com/hashicorp/cluster-api-provider-terraform-cloud/terraform"
-	"github.com/hashicorp/go-tfe"
-	tfc "github.com/hashicorp/go-tfe"
 )
 
 const tfcManagedMachinePoolFinalizer = "infrastructure.cluster.x-k8s.io/tfc-managed-machine-pool"
@@ -49,11 +62,37 @@ const tfcManagedMachinePoolFinalizer = "infrastructure.cluster.x-k8s.io/tfc-mana
 type TFCManagedMachinePoolReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// TFCClients caches the Terraform Cloud clients shared by the controllers
+	TFCClients *backend.ClientCache
+
+	// PodLogs reads the logs of the Jobs of the local backend.
+	PodLogs corev1client.PodsGetter
+
+	// Tracker caches the clients of the workload clusters, whose Nodes are matched with the instances.
+	Tracker *remote.ClusterCacheTracker
+
+	// WatchFilterValue is the label value used to filter events prior to reconciliation.
+	WatchFilterValue string
+
+	// MaxConcurrentReconciles is the number of resources reconciled at the same time.
+	MaxConcurrentReconciles int
+
+	// RequeueIntervals are how long to wait before reconciling a resource again.
+	RequeueIntervals RequeueIntervals
 }
 
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=tfcmanagedmachinepools,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=tfcmanagedmachinepools/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=tfcmanagedmachinepools/finalizers,verbs=update
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=tfcmanagedmachinepoolmachines,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=tfcmanagedmachinepoolmachines/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machinepools;machinepools/status,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups="",resources=secrets;configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list
+//+kubebuilder:rbac:groups="",resources=pods/log,verbs=get
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -64,7 +103,7 @@ type TFCManagedMachinePoolReconciler struct {
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.13.0/pkg/reconcile
-func (r *TFCManagedMachinePoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *TFCManagedMachinePoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, reterr error) {
 	logger := log.FromContext(ctx)
 	logger.Info("Reconciling TFCManagedMachinePool")
 
@@ -96,204 +135,408 @@ func (r *TFCManagedMachinePoolReconciler) Reconcile(ctx context.Context, req ctr
 		return ctrl.Result{}, nil
 	}
 	if ownerCluster == nil || !ownerCluster.Status.ControlPlaneReady {
-		// TODO: perhaps we should make waiting for this this configurable
 		logger.Info("Control plane is not ready yet")
-		return requeueAfterSeconds(10)
+		return requeueAfter(r.RequeueIntervals.withDefaults().Short)
 	}
 
-	// add controller finalizer
-	addFinalizer(ctx, r.Client, &machinePool, tfcManagedMachinePoolFinalizer)
+	if annotations.IsPaused(ownerCluster, &machinePool) {
+		logger.Info("TFCManagedMachinePool or linked Cluster is marked as paused, won't reconcile")
+		return ctrl.Result{}, nil
+	}
 
-	// read the token secret
-	var tokenSecret corev1.Secret
-	err = r.Client.Get(ctx, types.NamespacedName{Name: terraformCloudTokenSecretName, Namespace: req.Namespace}, &tokenSecret)
+	// persist the changes made to the machine pool once the reconcile ends
+	patcher, err := newObjectPatcher(r.Client, &machinePool)
 	if err != nil {
-		logger.Error(err, "Could not find token Secret object")
+		logger.Error(err, "Error creating patch helper")
 		return ctrl.Result{}, err
 	}
-	token := string(tokenSecret.Data["value"])
+	defer patcher.patchOnExit(ctx, &result, &reterr)
 
-	// create the TFC client
-	tfcClient, err := tfc.NewClient(&tfc.Config{
-		Token: token,
-	})
-	if err != nil {
-		logger.Error(err, "Error creating Terraform Cloud client")
+	// add controller finalizer
+	addFinalizer(&machinePool, tfcManagedMachinePoolFinalizer)
+
+	// sync the replicas of the scale subresource with the MachinePool
+	if err := r.reconcileReplicas(ctx, &machinePool, ownerMachinePool); err != nil {
+		logger.Error(err, "Error scaling MachinePool")
 		return ctrl.Result{}, err
 	}
 
-	// get the TFC workspace
-	workspace, err := tfcClient.Workspaces.Read(ctx, machinePool.Spec.Organization, machinePool.Spec.Workspace)
+	// get the backend executing Terraform runs, in Terraform Cloud or in local Jobs
+	tfBackend, err := newBackend(ctx, r.Client, r.TFCClients, r.PodLogs, r.Scheme, &machinePool, machinePool.Spec.Organization, machinePool.Spec.Workspace, &machinePool.Status.Terraform)
 	if err != nil {
-		logger.Error(err, "Error getting Terraform Cloud Workspace")
+		logger.Error(err, "Error creating Terraform backend")
 		return ctrl.Result{}, err
 	}
+	defer forgetMissingWorkspace(tfBackend, &machinePool.Status.Terraform)
+
+	m := &phaseMachine{
+		client:      r.Client,
+		scheme:      r.Scheme,
+		backend:     tfBackend,
+		resource:    &machinePoolPhases{r: r, machinePool: &machinePool, ownerMachinePool: ownerMachinePool, ownerCluster: ownerCluster},
+		patcher:     patcher,
+		clusterName: ownerCluster.Name,
+		finalizer:   tfcManagedMachinePoolFinalizer,
+		requeue:     r.RequeueIntervals.withDefaults(),
+		autoApply:   machinePool.Spec.AutoApply,
+	}
 
 	// run a destroy if the Kubernetes resource is deleted
-	// TODO: move this into a reconcileDelete() function
 	if !machinePool.ObjectMeta.DeletionTimestamp.IsZero() {
-		if controllerutil.ContainsFinalizer(&machinePool, tfcManagedMachinePoolFinalizer) {
-			logger.Info("Resource is deleted, triggering destroy")
-
-			// trigger destroy run
-			_, err := tfcClient.Runs.Create(ctx, tfc.RunCreateOptions{
-				Message:   tfc.String(fmt.Sprintf("%s: Destroy MachinePool %q", terraformCloudRunMessage, machinePool.ObjectMeta.Name)),
-				Workspace: workspace,
-				AutoApply: tfc.Bool(true),
-				IsDestroy: tfc.Bool(true),
-			})
-			if err != nil {
-				logger.Error(err, "Error triggering destroy run")
-				return ctrl.Result{}, err
-			}
+		return m.reconcileDelete(ctx)
+	}
+	return m.reconcile(ctx)
+}
 
-			// delete the kubeconfig secret
-			err = r.Client.Delete(ctx, &corev1.Secret{ObjectMeta: v1.ObjectMeta{
-				Namespace: machinePool.GetNamespace(),
-				Name:      fmt.Sprintf("%s-kubeconfig", machinePool.GetName()),
-			}})
-			if err != nil && !errors.IsNotFound(err) {
-				logger.Error(err, "Error deleting kubeconfig secret")
-				return ctrl.Result{}, err
-			}
+// machinePoolPhases reconciles the parts of the phases of a TFCManagedMachinePool specific to machine pools
+type machinePoolPhases struct {
+	r                *TFCManagedMachinePoolReconciler
+	machinePool      *infrastructurev1alpha1.TFCManagedMachinePool
+	ownerMachinePool *expclusterv1beta1.MachinePool
+	ownerCluster     *clusterv1beta1.Cluster
+
+	// version is the Kubernetes version the configuration was generated with, once known
+	version *string
+}
+
+func (p *machinePoolPhases) object() phaseObject {
+	return p.machinePool
+}
 
-			// TODO: wait until the destroy plan has completed
-			controllerutil.RemoveFinalizer(&machinePool, tfcManagedMachinePoolFinalizer)
-			err = r.Client.Update(ctx, &machinePool)
-			if err != nil {
-				logger.Error(err, "Error removing finalizer")
-				return ctrl.Result{}, err
+func (p *machinePoolPhases) description() string {
+	return fmt.Sprintf("MachinePool %q", p.machinePool.Name)
+}
+
+func (p *machinePoolPhases) revisionHistoryLimit() *int32 {
+	return p.machinePool.Spec.RevisionHistoryLimit
+}
+
+// validate checks the autoscaler size annotations, which are passed to the module so they must be integers
+func (p *machinePoolPhases) validate(ctx context.Context) error {
+	for _, a := range []string{autoscalerMinSizeAnnotation, autoscalerMaxSizeAnnotation} {
+		if v, ok := p.ownerMachinePool.Annotations[a]; ok {
+			if n, err := strconv.Atoi(v); err != nil || n < 0 {
+				err := fmt.Errorf("MachinePool has an invalid %s annotation %q, it must be a non-negative integer", a, v)
+				conditions.MarkFalse(p.machinePool, infrastructurev1alpha1.ConfigurationSyncedCondition,
+					infrastructurev1alpha1.InvalidAutoscalerAnnotationReason, clusterv1beta1.ConditionSeverityError, "%s", err.Error())
+				return err
 			}
 		}
-		return ctrl.Result{}, nil
 	}
+	return nil
+}
 
-	// generate the Terraform config
-	terraformConfigPath, configHash, err := terraform.CreateConfiguration(terraform.ManagedMachinePoolConfigurationTemplate, &machinePool, &ownerMachinePool)
-	defer os.RemoveAll(terraformConfigPath)
+// configuration generates the configuration of the machine pool, once its version is known
+func (p *machinePoolPhases) configuration(ctx context.Context) (map[string][]byte, error) {
+	machinePool := p.machinePool
+
+	// upgrade the machine pool once the control plane is running the new version
+	version, err := p.r.machinePoolVersion(ctx, machinePool, p.ownerMachinePool, p.ownerCluster)
 	if err != nil {
-		logger.Error(err, "Error generating Terraform configuration")
-		return ctrl.Result{}, err
+		return nil, fmt.Errorf("could not determine machine pool version: %w", err)
 	}
+	p.version = &version
 
-	// upload the terraform configuration
-	configurationVersionID := machinePool.Status.Terraform.ConfigurationVersionID
-	if configurationVersionID == "" || configHash != machinePool.Status.Terraform.ConfigurationHash {
-		// create a new ConfigurationVersion
-		logger.Info("Creating new Terraform ConfigurationVersion")
-		cv, err := tfcClient.ConfigurationVersions.Create(ctx, workspace.ID, tfc.ConfigurationVersionCreateOptions{
-			AutoQueueRuns: tfc.Bool(false),
-		})
-		if err != nil {
-			logger.Error(err, "Error creating new Terraform Cloud ConfigurationVersion")
-			return requeueAfterSeconds(30)
-		}
+	// the version is only reported in status once a run has applied it
+	machinePool = machinePool.DeepCopy()
+	machinePool.Status.Version = version
 
-		// upload the terraform config
-		logger.Info("Uploading Terraform Configuration")
-		err = tfcClient.ConfigurationVersions.Upload(ctx, cv.UploadURL, terraformConfigPath)
+	// hold back a lower number of replicas until the instances of the deleted machines have been
+	// removed, so that Terraform does not remove other instances instead
+	owner := p.ownerMachinePool
+	if machinePool.Spec.MachinePoolMachines {
+		deleted, err := p.r.machinesPendingReplacement(ctx, machinePool, owner)
 		if err != nil {
-			logger.Error(err, "Error uploading configuration to ConfigurationVersion")
-			return requeueAfterSeconds(30)
+			return nil, fmt.Errorf("could not list deleted machines: %w", err)
 		}
+		if scalesIn(machinePool, owner, len(deleted)) {
+			owner = owner.DeepCopy()
+			owner.Spec.Replicas = pointer.Int32(machinePool.Status.Replicas)
+		}
+	}
+
+	return terraform.ManagedMachinePoolFiles(ctx, p.r.Client, machinePool, owner, p.ownerCluster)
+}
+
+// configurationUploaded clears the failure, and the deleted machines of a run a new one supersedes
+func (p *machinePoolPhases) configurationUploaded() {
+	p.machinePool.Status.FailureReason = nil
+	p.machinePool.Status.FailureMessage = nil
+	p.machinePool.Status.DeletedMachines = nil
+}
+
+func (p *machinePoolPhases) needsPlan() bool {
+	return false
+}
+
+func (p *machinePoolPhases) reviewPlan(ctx context.Context, b backend.Backend, configurationVersionID string) (bool, error) {
+	return true, nil
+}
+
+func (p *machinePoolPhases) observeRun(run *backend.Run) {}
 
-		configurationVersionID = cv.ID
-		machinePool.Status.Terraform.ConfigurationVersionID = configurationVersionID
-		machinePool.Status.Terraform.ConfigurationHash = configHash
-		machinePool.Status.Terraform.RunID = ""
-		machinePool.Status.Terraform.RunStatus = ""
-		r.Client.Status().Update(ctx, &machinePool)
-		return requeueAfterSeconds(30)
+func (p *machinePoolPhases) runFailed(run *backend.Run) {
+	// the instances of deleted machines are handled again by the next applied run
+	p.machinePool.Status.DeletedMachines = nil
+	if run.Status != backend.RunErrored {
+		return
 	}
+	failureReason := capierrors.CreateMachineError
+	if p.machinePool.Status.Ready {
+		failureReason = capierrors.UpdateMachineError
+	}
+	p.machinePool.Status.FailureReason = &failureReason
+	p.machinePool.Status.FailureMessage = pointer.String(fmt.Sprintf("Terraform run %q produced an error", run.ID))
+}
 
-	cv, err := tfcClient.ConfigurationVersions.Read(ctx, configurationVersionID)
+// provision reads the instances of the machine pool from the outputs of the run, and marks the
+// machine pool as ready once they have joined the workload cluster
+func (p *machinePoolPhases) provision(ctx context.Context, m *phaseMachine, run *backend.Run) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	r, machinePool, ownerMachinePool, ownerCluster := p.r, p.machinePool, p.ownerMachinePool, p.ownerCluster
+
+	stateVersionID, outputs, err := m.backend.Outputs(ctx, run, machinePool.Status.Terraform.StateVersionID)
+	if backend.IsStateVersionNotReady(err) {
+		logger.Info("Waiting for Terraform state version", "reason", err.Error())
+		return requeueAfter(m.requeue.Short)
+	}
 	if err != nil {
-		logger.Error(err, "Error reading ConfigurationVersion")
-		return requeueAfterSeconds(30)
-	}
-
-	if cv.Status != tfe.ConfigurationUploaded {
-		logger.Info("ConfigurationVersion not ready yet")
-		return ctrl.Result{Requeue: true, RequeueAfter: 60 * time.Second}, nil
-	}
-
-	// check if there is a run in progress
-	runID := machinePool.Status.Terraform.RunID
-	if runID == "" {
-		// trigger a new run
-		logger.Info("Triggering Terraform Cloud Run")
-		run, err := tfcClient.Runs.Create(ctx, tfc.RunCreateOptions{
-			Message:              tfc.String(fmt.Sprintf("%s: Reconcile MachinePool %q", terraformCloudRunMessage, machinePool.ObjectMeta.Name)),
-			Workspace:            workspace,
-			AutoApply:            tfc.Bool(true),
-			ConfigurationVersion: cv,
-		})
+		logger.Error(err, "Error reading terraform run state")
+		return requeueAfter(m.requeue.Default)
+	}
+	fields, err := reconcileOutputs(ctx, r.Client, r.Scheme, machinePool, ownerCluster, &machinePool.Status.Terraform, machinePool.Spec.GetOutputs(), outputs)
+	if err != nil {
+		logger.Error(err, "Error reading Terraform outputs")
+		return requeueAfter(m.requeue.Default)
+	}
+	providerIDList, err := outputStringList(infrastructurev1alpha1.OutputFieldProviderIDList, fields[infrastructurev1alpha1.OutputFieldProviderIDList])
+	if err != nil {
+		logger.Error(err, "Error reading provider ID list")
+		return requeueAfter(m.requeue.Default)
+	}
+	machinePool.Spec.ProviderIDList = providerIDList
+	var replicas *int32
+	if v, ok := fields[infrastructurev1alpha1.OutputFieldReplicas]; ok {
+		n, err := outputInt32(infrastructurev1alpha1.OutputFieldReplicas, v)
+		if err != nil {
+			logger.Error(err, "Error reading replicas")
+			return requeueAfter(m.requeue.Default)
+		}
+		replicas = pointer.Int32(n)
+	}
+	instances := []terraformInstance{}
+	if v, ok := fields[infrastructurev1alpha1.OutputFieldInstances]; ok {
+		instances, err = parseInstances(v)
 		if err != nil {
-			logger.Error(err, "Error triggering new Terraform run")
-			return requeueAfterSeconds(30)
+			logger.Error(err, "Error reading instances output")
+			return requeueAfter(m.requeue.Default)
 		}
+	}
+	machinePool.Status.Terraform.StateVersionID = stateVersionID
 
-		// set status
-		machinePool.Status.Terraform.RunID = run.ID
-		machinePool.Status.Terraform.RunStatus = string(run.Status)
-		machinePool.Status.Terraform.RunStartedAt = metav1.NewTime(time.Now())
-		r.Client.Status().Update(ctx, &machinePool)
-		return ctrl.Result{Requeue: true, RequeueAfter: 60 * time.Second}, nil
+	// the configuration of the run is the current one, unless a previous one is pinned
+	if p.version != nil && !m.pinned && *p.version != machinePool.Status.Version {
+		logger.Info("Updated machine pool version", "from", machinePool.Status.Version, "to", *p.version)
+		machinePool.Status.Version = *p.version
 	}
 
-	run, err := tfcClient.Runs.Read(ctx, runID)
+	// report the number of replicas for the MachinePool contract, preferring an output
+	// mapped to the replicas field over the number of provisioned instances
+	machinePool.Status.Replicas = int32(len(machinePool.Spec.ProviderIDList))
+	if replicas != nil {
+		machinePool.Status.Replicas = *replicas
+	}
+
+	// only mark the machine pool as ready once its instances have joined the workload cluster
+	nodesReady, err := r.reconcileNodes(ctx, machinePool, ownerMachinePool, ownerCluster)
 	if err != nil {
-		logger.Error(err, "Error reading Terraform Cloud Run")
-		return requeueAfterSeconds(30)
-	}
-
-	machinePool.Status.Terraform.RunStatus = string(run.Status)
-	r.Client.Status().Update(ctx, &machinePool)
-
-	switch run.Status {
-	case tfc.RunDiscarded:
-		logger.Info("The Terraform Cloud run was discarded")
-	case tfc.RunCanceled:
-		logger.Info("The Terraform Cloud run was cancelled")
-	case tfc.RunErrored:
-		logger.Info("The Terraform Cloud run produced an error")
-	case tfc.RunPlannedAndFinished:
-	case tfc.RunApplied:
-		// TODO: we're going to want some kind of standard way to confirm
-		// that the machine pool is ready after a terraform apply is done
-		machinePool.Status.Ready = true
+		logger.Error(err, "Error checking Nodes in the workload cluster")
+	}
+	machinePool.Status.Ready = nodesReady
+	machinePool.Status.FailureReason = nil
+	machinePool.Status.FailureMessage = nil
+	if machinePool.Status.Terraform.RunFinishedAt.IsZero() {
 		machinePool.Status.Terraform.RunFinishedAt = metav1.NewTime(time.Now())
-		r.Client.Status().Update(ctx, &machinePool)
+	}
+	if machinePool.Spec.MachinePoolMachines {
+		machinePool.Status.InfrastructureMachineKind = "TFCManagedMachinePoolMachine"
+	}
 
-		outputs, err := tfcClient.StateVersions.ListOutputs(ctx,
-			workspace.CurrentStateVersion.ID, &tfc.StateVersionOutputsListOptions{})
-		if err != nil {
-			logger.Error(err, "Error reading terraform run state")
-			return requeueAfterSeconds(30)
+	if !machinePool.Spec.MachinePoolMachines {
+		if !nodesReady {
+			return requeueAfter(m.requeue.Default)
 		}
-		// TODO: getOutput() function
-		for _, o := range outputs.Items {
-			switch o.Name {
-			case "provider_id_list":
-				providerIDList := []string{}
-				for _, v := range o.Value.([]interface{}) {
-					providerIDList = append(providerIDList, v.(string))
-				}
-				machinePool.Spec.ProviderIDList = providerIDList
-			}
+		return ctrl.Result{}, nil
+	}
+
+	// keep a TFCManagedMachinePoolMachine for each instance in the pool, releasing the deleted
+	// machines whose instances the run replaced or removed
+	err = r.reconcileMachinePoolMachines(ctx, machinePool, ownerMachinePool, instances)
+	if err != nil {
+		logger.Error(err, "Error reconciling TFCManagedMachinePoolMachines")
+		return requeueAfter(m.requeue.Default)
+	}
+	released := map[string]bool{}
+	for _, name := range machinePool.Status.DeletedMachines {
+		released[name] = true
+	}
+	machinePool.Status.DeletedMachines = nil
+
+	// replace or remove the instances of machines that have been deleted
+	deleted, err := r.machinesPendingReplacement(ctx, machinePool, ownerMachinePool)
+	if err != nil {
+		logger.Error(err, "Error listing deleted TFCManagedMachinePoolMachines")
+		return requeueAfter(m.requeue.Default)
+	}
+	current := map[string]bool{}
+	for _, i := range instances {
+		current[i.ID] = true
+	}
+	addrs := []string{}
+	for _, machine := range deleted {
+		// the cache may not have seen the machines released above yet
+		if released[machine.Name] || !current[machine.Spec.InstanceID] {
+			continue
 		}
-		r.Client.Update(ctx, &machinePool)
-	default:
-		// run is still in progress
-		return requeueAfterSeconds(30)
+		addrs = append(addrs, machine.Status.ResourceAddress)
+		machinePool.Status.DeletedMachines = append(machinePool.Status.DeletedMachines, machine.Name)
 	}
-	return ctrl.Result{}, nil
+	if len(addrs) == 0 {
+		if !nodesReady {
+			return requeueAfter(m.requeue.Default)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// the deleted machines are persisted in status together with the ID of the run, so they
+	// are only released once that run has been applied
+	options := backend.RunOptions{
+		Message:      fmt.Sprintf("%s: Replace instances in MachinePool %q", terraformCloudRunMessage, machinePool.ObjectMeta.Name),
+		ReplaceAddrs: addrs,
+	}
+	if scalesIn(machinePool, ownerMachinePool, len(addrs)) {
+		options = backend.RunOptions{
+			Message:     fmt.Sprintf("%s: Remove instances from MachinePool %q", terraformCloudRunMessage, machinePool.ObjectMeta.Name),
+			Destroy:     true,
+			TargetAddrs: addrs,
+		}
+	}
+	logger.Info("Triggering Terraform Run for deleted instances", "addresses", addrs, "destroy", options.Destroy)
+	result, err := m.startRun(ctx, options)
+	if machinePool.Status.Terraform.RunID == run.ID {
+		// the run could not be started
+		machinePool.Status.DeletedMachines = nil
+	}
+	return result, err
+}
+
+// cleanup deletes the kubeconfig Secret and releases the machines so they are garbage collected with the pool
+func (p *machinePoolPhases) cleanup(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	// delete the kubeconfig secret
+	err := p.r.Client.Delete(ctx, &corev1.Secret{ObjectMeta: v1.ObjectMeta{
+		Namespace: p.machinePool.GetNamespace(),
+		Name:      fmt.Sprintf("%s-kubeconfig", p.machinePool.GetName()),
+	}})
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Error deleting kubeconfig secret")
+		return err
+	}
+
+	machines, err := p.r.listMachinePoolMachines(ctx, p.machinePool, p.ownerMachinePool)
+	if err != nil {
+		logger.Error(err, "Error listing TFCManagedMachinePoolMachines")
+		return err
+	}
+	for i := range machines {
+		if err := removeMachineFinalizer(ctx, p.r.Client, &machines[i]); err != nil {
+			logger.Error(err, "Error removing TFCManagedMachinePoolMachine finalizer")
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileReplicas keeps spec.replicas, exposed through the scale subresource, in sync with
+// the owning MachinePool. A scale of the TFCManagedMachinePool is written through to the
+// MachinePool, which remains the source of the replicas passed to the module; any other
+// difference follows the MachinePool.
+func (r *TFCManagedMachinePoolReconciler) reconcileReplicas(ctx context.Context, machinePool *infrastructurev1alpha1.TFCManagedMachinePool, ownerMachinePool *expclusterv1beta1.MachinePool) error {
+	logger := log.FromContext(ctx)
+
+	machinePool.Status.Selector = labels.SelectorFromSet(labels.Set{
+		clusterv1beta1.ClusterLabelName: ownerMachinePool.Spec.ClusterName,
+		machinePoolNameLabel:            ownerMachinePool.Name,
+	}).String()
+
+	desired, synced, owned := machinePool.Spec.Replicas, machinePool.Status.SyncedReplicas, ownerMachinePool.Spec.Replicas
+	if desired != nil && synced != nil && *desired != *synced && (owned == nil || *owned != *desired) {
+		patch := client.MergeFrom(ownerMachinePool.DeepCopy())
+		ownerMachinePool.Spec.Replicas = pointer.Int32(*desired)
+		if err := r.Client.Patch(ctx, ownerMachinePool, patch); err != nil {
+			return fmt.Errorf("could not scale MachinePool: %w", err)
+		}
+		logger.Info("Scaled MachinePool", "replicas", *desired)
+	}
+
+	if ownerMachinePool.Spec.Replicas != nil {
+		machinePool.Spec.Replicas = pointer.Int32(*ownerMachinePool.Spec.Replicas)
+	}
+	if machinePool.Spec.Replicas != nil {
+		machinePool.Status.SyncedReplicas = pointer.Int32(*machinePool.Spec.Replicas)
+	}
+	return nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
-func (r *TFCManagedMachinePoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
+func (r *TFCManagedMachinePoolReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
+	logger := log.FromContext(ctx)
+
+	clusterToMachinePools, err := util.ClusterToObjectsMapper(mgr.GetClient(), &infrastructurev1alpha1.TFCManagedMachinePoolList{}, mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&infrastructurev1alpha1.TFCManagedMachinePool{}).
+		For(
+			&infrastructurev1alpha1.TFCManagedMachinePool{},
+			builder.WithPredicates(predicates.ResourceNotPausedAndHasFilterLabel(logger, r.WatchFilterValue)),
+		).
+		Owns(&infrastructurev1alpha1.TFCManagedMachinePoolMachine{}).
+		Owns(&batchv1.Job{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Watches(
+			&source.Kind{Type: &expclusterv1beta1.MachinePool{}},
+			handler.EnqueueRequestsFromMapFunc(exputil.MachinePoolToInfrastructureMapFunc(
+				infrastructurev1alpha1.GroupVersion.WithKind("TFCManagedMachinePool"), logger)),
+			builder.WithPredicates(
+				predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}),
+				predicates.ResourceHasFilterLabel(logger, r.WatchFilterValue),
+			),
+		).
+		Watches(
+			&source.Kind{Type: &clusterv1beta1.Cluster{}},
+			handler.EnqueueRequestsFromMapFunc(clusterToMachinePools),
+			builder.WithPredicates(predicates.ClusterUnpaused(logger), predicates.ResourceHasFilterLabel(logger, r.WatchFilterValue)),
+		).
+		Watches(
+			&source.Kind{Type: &infrastructurev1alpha1.TFCManagedControlPlane{}},
+			handler.EnqueueRequestsFromMapFunc(controlPlaneToTFCManagedMachinePools(ctx, r.Client)),
+			builder.WithPredicates(predicates.ResourceHasFilterLabel(logger, r.WatchFilterValue)),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(tokenSecretToObjectsMapFunc(ctx, r.Client, &infrastructurev1alpha1.TFCManagedMachinePoolList{}, r.WatchFilterValue)),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(configurationSourceToObjectsMapFunc(ctx, r.Client, &infrastructurev1alpha1.TFCManagedMachinePoolList{}, r.WatchFilterValue)),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(configurationSourceToObjectsMapFunc(ctx, r.Client, &infrastructurev1alpha1.TFCManagedMachinePoolList{}, r.WatchFilterValue)),
+		).
 		Complete(r)
 }
 
@@ -0,0 +1,381 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	tfc "github.com/hashicorp/go-tfe"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	expclusterv1beta1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/backend"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/backend/tfcfake"
+)
+
+var _ = Describe("TFCManagedMachinePool controller", func() {
+	var (
+		fake       *tfcfake.TerraformCloud
+		reconciler *TFCManagedMachinePoolReconciler
+		key        client.ObjectKey
+		ownerKey   client.ObjectKey
+	)
+
+	reconcile := func() (ctrl.Result, error) {
+		return reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	}
+
+	get := func() *infrastructurev1alpha1.TFCManagedMachinePool {
+		var machinePool infrastructurev1alpha1.TFCManagedMachinePool
+		Expect(k8sClient.Get(ctx, key, &machinePool)).To(Succeed())
+		return &machinePool
+	}
+
+	instanceOutputs := func(names ...string) map[string]any {
+		providerIDs := []any{}
+		instances := []any{}
+		for _, name := range names {
+			providerIDs = append(providerIDs, "gce://example/"+name)
+			instances = append(instances, map[string]any{
+				"id":               "instance-" + name,
+				"provider_id":      "gce://example/" + name,
+				"resource_address": fmt.Sprintf("google_compute_instance.pool[%q]", name),
+			})
+		}
+		return map[string]any{"provider_id_list": providerIDs, "instances": instances}
+	}
+
+	getMachine := func(name string) (*infrastructurev1alpha1.TFCManagedMachinePoolMachine, error) {
+		var machine infrastructurev1alpha1.TFCManagedMachinePoolMachine
+		err := k8sClient.Get(ctx, client.ObjectKey{Namespace: key.Namespace, Name: machinePoolMachineName(get(), "instance-"+name)}, &machine)
+		return &machine, err
+	}
+
+	// provisionMachines applies a pool of three instances with a machine for each
+	provisionMachines := func() {
+		machinePool := get()
+		machinePool.Spec.MachinePoolMachines = true
+		Expect(k8sClient.Update(ctx, machinePool)).To(Succeed())
+		_, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fake.FinishRun(get().Status.Terraform.RunID, tfc.RunApplied, instanceOutputs("a", "b", "c"), nil)).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(get().Status.Replicas).To(Equal(int32(3)))
+		_, err = getMachine("a")
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		fake = tfcfake.New()
+		fake.CreateWorkspace("example-org", "example-pool")
+		reconciler = &TFCManagedMachinePoolReconciler{
+			Client:     k8sClient,
+			Scheme:     scheme.Scheme,
+			TFCClients: backend.NewClientCache(fake.ClientFactory()),
+		}
+
+		namespace := createTestNamespace()
+		cluster := createTestCluster(namespace, "example-control-plane")
+		cluster.Status.ControlPlaneReady = true
+		Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+
+		ownerMachinePool := &expclusterv1beta1.MachinePool{
+			ObjectMeta: metav1.ObjectMeta{Name: "example-pool", Namespace: namespace},
+			Spec: expclusterv1beta1.MachinePoolSpec{
+				ClusterName: cluster.Name,
+				Replicas:    pointer.Int32(3),
+				Template: clusterv1beta1.MachineTemplateSpec{
+					Spec: clusterv1beta1.MachineSpec{
+						ClusterName: cluster.Name,
+						Bootstrap:   clusterv1beta1.Bootstrap{DataSecretName: pointer.String("")},
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, ownerMachinePool)).To(Succeed())
+		ownerKey = client.ObjectKeyFromObject(ownerMachinePool)
+
+		machinePool := &infrastructurev1alpha1.TFCManagedMachinePool{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "example-pool",
+				Namespace: namespace,
+				Labels:    map[string]string{clusterv1beta1.ClusterLabelName: cluster.Name},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: expclusterv1beta1.GroupVersion.String(),
+					Kind:       "MachinePool",
+					Name:       ownerMachinePool.Name,
+					UID:        ownerMachinePool.UID,
+				}},
+			},
+			Spec: infrastructurev1alpha1.TFCManagedMachinePoolSpec{
+				Organization: "example-org",
+				Workspace:    "example-pool",
+				Module:       infrastructurev1alpha1.TerraformModule{Source: "example/node-pool/google", Version: "1.0.0"},
+				AutoApply:    true,
+				Variables:    []infrastructurev1alpha1.Variable{},
+			},
+		}
+		Expect(k8sClient.Create(ctx, machinePool)).To(Succeed())
+		key = client.ObjectKeyFromObject(machinePool)
+	})
+
+	It("uploads the configuration and applies it", func() {
+		_, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		machinePool := get()
+		Expect(controllerutil.ContainsFinalizer(machinePool, tfcManagedMachinePoolFinalizer)).To(BeTrue())
+		Expect(machinePool.Spec.Replicas).To(HaveValue(Equal(int32(3))))
+		Expect(machinePool.Status.Selector).To(ContainSubstring(machinePoolNameLabel + "=example-pool"))
+		cvID := machinePool.Status.Terraform.ConfigurationVersionID
+		Expect(cvID).NotTo(BeEmpty())
+		Expect(fake.Uploads(cvID)).To(HaveKey("main.tf"))
+
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		runs := fake.Runs()
+		Expect(runs).To(HaveLen(1))
+		Expect(runs[0].AutoApply).To(BeTrue())
+		Expect(runs[0].ConfigurationVersion.ID).To(Equal(cvID))
+		Expect(get().Status.Terraform.RunID).To(Equal(runs[0].ID))
+	})
+
+	It("writes a scale of the TFCManagedMachinePool through to the MachinePool", func() {
+		_, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+
+		machinePool := get()
+		machinePool.Spec.Replicas = pointer.Int32(5)
+		Expect(k8sClient.Update(ctx, machinePool)).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		var ownerMachinePool expclusterv1beta1.MachinePool
+		Expect(k8sClient.Get(ctx, ownerKey, &ownerMachinePool)).To(Succeed())
+		Expect(ownerMachinePool.Spec.Replicas).To(HaveValue(Equal(int32(5))))
+
+		// a scale of the MachinePool is mirrored back
+		ownerMachinePool.Spec.Replicas = pointer.Int32(2)
+		Expect(k8sClient.Update(ctx, &ownerMachinePool)).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(get().Spec.Replicas).To(HaveValue(Equal(int32(2))))
+	})
+
+	It("fails with a condition when an autoscaler annotation is invalid", func() {
+		var ownerMachinePool expclusterv1beta1.MachinePool
+		Expect(k8sClient.Get(ctx, ownerKey, &ownerMachinePool)).To(Succeed())
+		ownerMachinePool.Annotations = map[string]string{autoscalerMaxSizeAnnotation: "ten"}
+		Expect(k8sClient.Update(ctx, &ownerMachinePool)).To(Succeed())
+
+		_, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		machinePool := get()
+		Expect(machinePool.Status.Phase).To(Equal(infrastructurev1alpha1.PhaseFailed))
+		Expect(machinePool.Status.Terraform.ConfigurationVersionID).To(BeEmpty())
+		condition := conditions.Get(machinePool, infrastructurev1alpha1.ConfigurationSyncedCondition)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(infrastructurev1alpha1.InvalidAutoscalerAnnotationReason))
+		Expect(condition.Message).To(ContainSubstring(autoscalerMaxSizeAnnotation))
+
+		// the condition is cleared once the annotation is fixed
+		ownerMachinePool.Annotations[autoscalerMaxSizeAnnotation] = "10"
+		Expect(k8sClient.Update(ctx, &ownerMachinePool)).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conditions.IsTrue(get(), infrastructurev1alpha1.ConfigurationSyncedCondition)).To(BeTrue())
+	})
+
+	It("records a failure when the run errors", func() {
+		fake.SetError("ConfigurationVersions.Create", errors.New("service unavailable"))
+		result, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(30 * time.Second))
+		Expect(get().Status.Terraform.ConfigurationVersionID).To(BeEmpty())
+
+		fake.SetError("ConfigurationVersions.Create", nil)
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		runID := get().Status.Terraform.RunID
+		Expect(runID).NotTo(BeEmpty())
+
+		Expect(fake.FinishRun(runID, tfc.RunErrored, nil, nil)).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		machinePool := get()
+		Expect(machinePool.Status.FailureReason).To(HaveValue(Equal(capierrors.CreateMachineError)))
+		Expect(machinePool.Status.FailureMessage).To(HaveValue(ContainSubstring(runID)))
+		Expect(machinePool.Status.Ready).To(BeFalse())
+		Expect(machinePool.Status.Phase).To(Equal(infrastructurev1alpha1.PhaseFailed))
+	})
+
+	It("removes the finalizer without a destroy run when nothing was applied", func() {
+		_, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Delete(ctx, get())).To(Succeed())
+
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fake.Runs()).To(BeEmpty())
+		err = k8sClient.Get(ctx, key, &infrastructurev1alpha1.TFCManagedMachinePool{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("queues a destroy run and removes the finalizer when deleted", func() {
+		_, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fake.FinishRun(get().Status.Terraform.RunID, tfc.RunApplied, instanceOutputs("a"), nil)).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "example-pool-kubeconfig", Namespace: key.Namespace},
+		})).To(Succeed())
+		// the destroy run is applied even when other runs wait to be confirmed
+		machinePool := get()
+		machinePool.Spec.AutoApply = false
+		Expect(k8sClient.Update(ctx, machinePool)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, get())).To(Succeed())
+
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		runs := fake.Runs()
+		Expect(runs).To(HaveLen(2))
+		Expect(runs[1].IsDestroy).To(BeTrue())
+		Expect(runs[1].AutoApply).To(BeTrue())
+
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: key.Namespace, Name: "example-pool-kubeconfig"}, &corev1.Secret{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		err = k8sClient.Get(ctx, key, &infrastructurev1alpha1.TFCManagedMachinePool{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("does not write the machines again while the instances are unchanged", func() {
+		provisionMachines()
+		machine, err := getMachine("a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(machine.Status.Ready).To(BeTrue())
+
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		unchanged, err := getMachine("a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unchanged.ResourceVersion).To(Equal(machine.ResourceVersion))
+	})
+
+	It("replaces the instance of a deleted machine once", func() {
+		provisionMachines()
+		machine, err := getMachine("a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Delete(ctx, machine)).To(Succeed())
+
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		runs := fake.Runs()
+		Expect(runs).To(HaveLen(2))
+		Expect(runs[1].IsDestroy).To(BeFalse())
+		Expect(runs[1].ReplaceAddrs).To(Equal([]string{`google_compute_instance.pool["a"]`}))
+		machinePool := get()
+		Expect(machinePool.Status.Terraform.RunID).To(Equal(runs[1].ID))
+		Expect(machinePool.Status.DeletedMachines).To(Equal([]string{machine.Name}))
+
+		// the machine is released once the run has applied, and no other run is queued
+		Expect(fake.FinishRun(runs[1].ID, tfc.RunApplied, instanceOutputs("a", "b", "c"), nil)).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(get().Status.DeletedMachines).To(BeEmpty())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fake.Runs()).To(HaveLen(2))
+	})
+
+	It("removes the instance of a deleted machine when the MachinePool is scaled in", func() {
+		provisionMachines()
+		cvID := get().Status.Terraform.ConfigurationVersionID
+		machine, err := getMachine("a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Delete(ctx, machine)).To(Succeed())
+		var ownerMachinePool expclusterv1beta1.MachinePool
+		Expect(k8sClient.Get(ctx, ownerKey, &ownerMachinePool)).To(Succeed())
+		ownerMachinePool.Spec.Replicas = pointer.Int32(2)
+		Expect(k8sClient.Update(ctx, &ownerMachinePool)).To(Succeed())
+
+		// the lower replicas are held back while the instance is destroyed
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		runs := fake.Runs()
+		Expect(runs).To(HaveLen(2))
+		Expect(runs[1].IsDestroy).To(BeTrue())
+		Expect(runs[1].TargetAddrs).To(Equal([]string{`google_compute_instance.pool["a"]`}))
+		Expect(get().Status.Terraform.ConfigurationVersionID).To(Equal(cvID))
+
+		Expect(fake.FinishRun(runs[1].ID, tfc.RunApplied, instanceOutputs("b", "c"), nil)).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		machinePool := get()
+		Expect(machinePool.Status.Replicas).To(Equal(int32(2)))
+		Expect(machinePool.Status.DeletedMachines).To(BeEmpty())
+		_, err = getMachine("a")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		// the lower replicas are then applied
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		cvID = get().Status.Terraform.ConfigurationVersionID
+		Expect(fake.Uploads(cvID)["main.tf"]).To(MatchRegexp(`replicas\s+= 2`))
+	})
+
+	It("reports the version once a run has applied it", func() {
+		var ownerMachinePool expclusterv1beta1.MachinePool
+		Expect(k8sClient.Get(ctx, ownerKey, &ownerMachinePool)).To(Succeed())
+		ownerMachinePool.Spec.Template.Spec.Version = pointer.String("v1.24.5")
+		Expect(k8sClient.Update(ctx, &ownerMachinePool)).To(Succeed())
+		controlPlane := &infrastructurev1alpha1.TFCManagedControlPlane{
+			ObjectMeta: metav1.ObjectMeta{Name: "example-control-plane", Namespace: key.Namespace},
+			Spec: infrastructurev1alpha1.TFCManagedControlPlaneSpec{
+				Organization: "example-org",
+				Workspace:    "example-cluster",
+				Module:       infrastructurev1alpha1.TerraformModule{Source: "example/cluster/google", Version: "1.0.0"},
+				Version:      "1.24.5",
+			},
+		}
+		Expect(k8sClient.Create(ctx, controlPlane)).To(Succeed())
+		controlPlane.Status.Ready = true
+		controlPlane.Status.Version = pointer.String("1.24.5")
+		Expect(k8sClient.Status().Update(ctx, controlPlane)).To(Succeed())
+
+		_, err := reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		machinePool := get()
+		Expect(fake.Uploads(machinePool.Status.Terraform.ConfigurationVersionID)["main.tf"]).To(MatchRegexp(`kubernetes_version\s+= "1.24.5"`))
+		Expect(machinePool.Status.Version).To(BeEmpty())
+
+		Expect(fake.FinishRun(machinePool.Status.Terraform.RunID, tfc.RunApplied, instanceOutputs("a"), nil)).To(Succeed())
+		_, err = reconcile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(get().Status.Version).To(Equal("1.24.5"))
+	})
+})
@@ -0,0 +1,199 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expclusterv1beta1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+const tfcManagedMachinePoolMachineFinalizer = "infrastructure.cluster.x-k8s.io/tfc-managed-machine-pool-machine"
+
+// machinePoolNameLabel is the label set on infrastructure machines linked to a MachinePool
+const machinePoolNameLabel = "cluster.x-k8s.io/pool-name"
+
+// terraformInstance is an entry of the `instances` output of a machine pool module
+type terraformInstance struct {
+	ID              string                          `json:"id"`
+	ProviderID      string                          `json:"provider_id"`
+	Zone            string                          `json:"zone"`
+	Addresses       clusterv1beta1.MachineAddresses `json:"addresses"`
+	ResourceAddress string                          `json:"resource_address"`
+}
+
+// parseInstances converts the value of the `instances` output into a list of instances
+func parseInstances(value any) ([]terraformInstance, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	instances := []terraformInstance{}
+	if err := json.Unmarshal(b, &instances); err != nil {
+		return nil, fmt.Errorf("instances output is not a list of instance objects: %w", err)
+	}
+	for _, i := range instances {
+		if i.ID == "" {
+			return nil, fmt.Errorf("instances output contains an instance without an id")
+		}
+	}
+	return instances, nil
+}
+
+// machinePoolMachineName returns a stable object name for the instance with the supplied ID
+func machinePoolMachineName(machinePool *infrastructurev1alpha1.TFCManagedMachinePool, instanceID string) string {
+	h := fnv.New32a()
+	h.Write([]byte(instanceID))
+	return fmt.Sprintf("%s-%08x", machinePool.Name, h.Sum32())
+}
+
+// listMachinePoolMachines returns the TFCManagedMachinePoolMachines belonging to the machine pool
+func (r *TFCManagedMachinePoolReconciler) listMachinePoolMachines(ctx context.Context, machinePool *infrastructurev1alpha1.TFCManagedMachinePool, ownerMachinePool *expclusterv1beta1.MachinePool) ([]infrastructurev1alpha1.TFCManagedMachinePoolMachine, error) {
+	var machines infrastructurev1alpha1.TFCManagedMachinePoolMachineList
+	err := r.Client.List(ctx, &machines, client.InNamespace(machinePool.Namespace), client.MatchingLabels{
+		clusterv1beta1.ClusterLabelName: ownerMachinePool.Spec.ClusterName,
+		machinePoolNameLabel:            ownerMachinePool.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return machines.Items, nil
+}
+
+// reconcileMachinePoolMachines creates, updates and deletes TFCManagedMachinePoolMachines
+// so that there is exactly one for each instance reported by Terraform. Machines that were
+// deleted by a user are released once their instance is gone, or once the applied run
+// recorded in status.deletedMachines has replaced it.
+func (r *TFCManagedMachinePoolReconciler) reconcileMachinePoolMachines(ctx context.Context, machinePool *infrastructurev1alpha1.TFCManagedMachinePool, ownerMachinePool *expclusterv1beta1.MachinePool, instances []terraformInstance) error {
+	machines, err := r.listMachinePoolMachines(ctx, machinePool, ownerMachinePool)
+	if err != nil {
+		return err
+	}
+
+	current := map[string]bool{}
+	for _, i := range instances {
+		current[i.ID] = true
+	}
+
+	replaced := map[string]bool{}
+	for _, name := range machinePool.Status.DeletedMachines {
+		replaced[name] = true
+	}
+
+	deleting := map[string]bool{}
+	for i := range machines {
+		m := &machines[i]
+		if m.DeletionTimestamp.IsZero() {
+			if !current[m.Spec.InstanceID] {
+				if err := removeMachineFinalizer(ctx, r.Client, m); err != nil {
+					return err
+				}
+				if err := client.IgnoreNotFound(r.Client.Delete(ctx, m)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// the machine was deleted, wait for its instance to be replaced or removed
+		if !current[m.Spec.InstanceID] || replaced[m.Name] || m.Status.ResourceAddress == "" {
+			if err := removeMachineFinalizer(ctx, r.Client, m); err != nil {
+				return err
+			}
+			continue
+		}
+		deleting[m.Spec.InstanceID] = true
+	}
+
+	for _, i := range instances {
+		if deleting[i.ID] {
+			continue
+		}
+
+		machine := &infrastructurev1alpha1.TFCManagedMachinePoolMachine{}
+		machine.Namespace = machinePool.Namespace
+		machine.Name = machinePoolMachineName(machinePool, i.ID)
+		_, err := controllerutil.CreateOrUpdate(ctx, r.Client, machine, func() error {
+			if machine.Labels == nil {
+				machine.Labels = map[string]string{}
+			}
+			machine.Labels[clusterv1beta1.ClusterLabelName] = ownerMachinePool.Spec.ClusterName
+			machine.Labels[machinePoolNameLabel] = ownerMachinePool.Name
+			if v, ok := machinePool.Labels[clusterv1beta1.WatchLabel]; ok {
+				machine.Labels[clusterv1beta1.WatchLabel] = v
+			}
+			controllerutil.AddFinalizer(machine, tfcManagedMachinePoolMachineFinalizer)
+			machine.Spec.InstanceID = i.ID
+			machine.Spec.ProviderID = i.ProviderID
+			return controllerutil.SetControllerReference(machinePool, machine, r.Scheme)
+		})
+		if err != nil {
+			return err
+		}
+
+		// only write the status of machines whose instance has changed
+		status := machine.Status
+		status.Ready = true
+		status.Zone = i.Zone
+		status.Addresses = i.Addresses
+		status.ResourceAddress = i.ResourceAddress
+		if equality.Semantic.DeepEqual(status, machine.Status) {
+			continue
+		}
+		patch := client.MergeFrom(machine.DeepCopy())
+		machine.Status = status
+		if err := r.Client.Status().Patch(ctx, machine, patch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// machinesPendingReplacement returns the machines that were deleted by a user
+// and whose instance has not yet been replaced or removed
+func (r *TFCManagedMachinePoolReconciler) machinesPendingReplacement(ctx context.Context, machinePool *infrastructurev1alpha1.TFCManagedMachinePool, ownerMachinePool *expclusterv1beta1.MachinePool) ([]infrastructurev1alpha1.TFCManagedMachinePoolMachine, error) {
+	machines, err := r.listMachinePoolMachines(ctx, machinePool, ownerMachinePool)
+	if err != nil {
+		return nil, err
+	}
+	pending := []infrastructurev1alpha1.TFCManagedMachinePoolMachine{}
+	for _, m := range machines {
+		if m.DeletionTimestamp.IsZero() || m.Status.ResourceAddress == "" {
+			continue
+		}
+		if !controllerutil.ContainsFinalizer(&m, tfcManagedMachinePoolMachineFinalizer) {
+			continue
+		}
+		pending = append(pending, m)
+	}
+	return pending, nil
+}
+
+// scalesIn returns true if the instances of the deleted machines are removed rather than replaced,
+// because the MachinePool wants fewer instances than the pool has and no fewer than would remain
+func scalesIn(machinePool *infrastructurev1alpha1.TFCManagedMachinePool, ownerMachinePool *expclusterv1beta1.MachinePool, deleted int) bool {
+	if deleted == 0 || machinePool.Spec.ManagedAutoscaling || ownerMachinePool.Spec.Replicas == nil {
+		return false
+	}
+	desired := *ownerMachinePool.Spec.Replicas
+	return desired < machinePool.Status.Replicas && machinePool.Status.Replicas-int32(deleted) >= desired
+}
+
+// removeMachineFinalizer releases a TFCManagedMachinePoolMachine so it can be deleted
+func removeMachineFinalizer(ctx context.Context, c client.Client, m *infrastructurev1alpha1.TFCManagedMachinePoolMachine) error {
+	if !controllerutil.ContainsFinalizer(m, tfcManagedMachinePoolMachineFinalizer) {
+		return nil
+	}
+	controllerutil.RemoveFinalizer(m, tfcManagedMachinePoolMachineFinalizer)
+	return client.IgnoreNotFound(c.Update(ctx, m))
+}
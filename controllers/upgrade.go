@@ -0,0 +1,192 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expclusterv1beta1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/backend"
+)
+
+// errUpgradeRefused is returned when the speculative plan for an upgrade means it must not be applied
+var errUpgradeRefused = errors.New("upgrade refused")
+
+// terraformPlan is the subset of the Terraform JSON plan format used to review an upgrade
+type terraformPlan struct {
+	ResourceChanges []struct {
+		Address string `json:"address"`
+		Change  struct {
+			Actions []string `json:"actions"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+// destroyedResources returns the addresses of the resources a JSON plan would destroy or replace
+func destroyedResources(planJSON []byte) ([]string, error) {
+	var plan terraformPlan
+	if err := json.Unmarshal(planJSON, &plan); err != nil {
+		return nil, fmt.Errorf("could not parse plan: %w", err)
+	}
+	addresses := []string{}
+	for _, rc := range plan.ResourceChanges {
+		for _, a := range rc.Change.Actions {
+			if a == "delete" {
+				addresses = append(addresses, rc.Address)
+				break
+			}
+		}
+	}
+	return addresses, nil
+}
+
+// upgradingVersion returns true if the workload cluster is running a different version than the one requested
+func upgradingVersion(cluster *infrastructurev1alpha1.TFCManagedControlPlane) bool {
+	return cluster.Status.Version != nil && !versionMatches(cluster.Spec.Version, *cluster.Status.Version)
+}
+
+// reviewUpgradePlan runs a speculative plan of the configuration version before a version upgrade is
+// applied and returns true once the plan has finished without destroying or replacing any resources.
+// An error wrapping errUpgradeRefused is returned if the plan failed or would replace resources,
+// in which case the upgrade must not proceed until the configuration changes.
+func (r *TFCManagedControlPlaneReconciler) reviewUpgradePlan(ctx context.Context, tfBackend backend.Backend, configurationVersionID string, cluster *infrastructurev1alpha1.TFCManagedControlPlane) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	planRunID := cluster.Status.Terraform.PlanRunID
+	if planRunID == "" {
+		logger.Info("Triggering speculative plan for version upgrade", "from", *cluster.Status.Version, "to", cluster.Spec.Version)
+		run, err := tfBackend.Plan(ctx, configurationVersionID,
+			fmt.Sprintf("%s: Plan upgrade of Control Plane %q to %s", terraformCloudRunMessage, cluster.ObjectMeta.Name, cluster.Spec.Version))
+		if err != nil {
+			return false, err
+		}
+		cluster.Status.Terraform.PlanRunID = run.ID
+		conditions.MarkFalse(cluster, infrastructurev1alpha1.VersionUpgradeCondition,
+			infrastructurev1alpha1.WaitingForUpgradePlanReason, clusterv1beta1.ConditionSeverityInfo,
+			"Terraform run %s is planning the upgrade to %s", run.ID, cluster.Spec.Version)
+		return false, nil
+	}
+
+	run, err := tfBackend.ReadRun(ctx, planRunID)
+	if err != nil {
+		return false, err
+	}
+
+	switch run.Status {
+	case backend.RunPlannedAndFinished:
+	case backend.RunErrored, backend.RunCanceled, backend.RunDiscarded:
+		conditions.MarkFalse(cluster, infrastructurev1alpha1.VersionUpgradeCondition,
+			infrastructurev1alpha1.UpgradePlanFailedReason, clusterv1beta1.ConditionSeverityError,
+			"Terraform run %s is %s", run.ID, run.Status)
+		return false, fmt.Errorf("%w: plan %s is %s", errUpgradeRefused, run.ID, run.Status)
+	default:
+		conditions.MarkFalse(cluster, infrastructurev1alpha1.VersionUpgradeCondition,
+			infrastructurev1alpha1.WaitingForUpgradePlanReason, clusterv1beta1.ConditionSeverityInfo,
+			"Terraform run %s is %s", run.ID, run.Status)
+		return false, nil
+	}
+
+	planJSON, err := tfBackend.PlanJSON(ctx, run)
+	if err != nil {
+		return false, err
+	}
+	destroyed, err := destroyedResources(planJSON)
+	if err != nil {
+		return false, err
+	}
+	if len(destroyed) > 0 {
+		conditions.MarkFalse(cluster, infrastructurev1alpha1.VersionUpgradeCondition,
+			infrastructurev1alpha1.UpgradePlanReplacesResourcesReason, clusterv1beta1.ConditionSeverityError,
+			"Terraform run %s would destroy or replace %s", run.ID, strings.Join(destroyed, ", "))
+		return false, fmt.Errorf("%w: plan %s would destroy or replace %d resources", errUpgradeRefused, run.ID, len(destroyed))
+	}
+	return true, nil
+}
+
+// isUpgradeRefused returns true if err means the upgrade was refused after reviewing its plan
+func isUpgradeRefused(err error) bool {
+	return errors.Is(err, errUpgradeRefused)
+}
+
+// machinePoolVersion returns the Kubernetes version, without the leading "v", to pass to the
+// machine pool module. Machine pools
+// follow the version of their MachinePool, but are only upgraded once a TFCManagedControlPlane has
+// finished upgrading to at least that version; until then the current version is kept.
+func (r *TFCManagedMachinePoolReconciler) machinePoolVersion(ctx context.Context, machinePool *infrastructurev1alpha1.TFCManagedMachinePool, ownerMachinePool *expclusterv1beta1.MachinePool, ownerCluster *clusterv1beta1.Cluster) (string, error) {
+	desired := ownerMachinePool.Spec.Template.Spec.Version
+	if desired == nil || *desired == "" {
+		return "", nil
+	}
+
+	ref := ownerCluster.Spec.ControlPlaneRef
+	gk := infrastructurev1alpha1.GroupVersion.WithKind("TFCManagedControlPlane").GroupKind()
+	if ref == nil || ref.GroupVersionKind().GroupKind() != gk {
+		return strings.TrimPrefix(*desired, "v"), nil
+	}
+
+	var controlPlane infrastructurev1alpha1.TFCManagedControlPlane
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: ownerCluster.Namespace, Name: ref.Name}, &controlPlane); err != nil {
+		return "", err
+	}
+	if controlPlane.Status.Version == nil || !controlPlane.Status.Ready {
+		return machinePool.Status.Version, nil
+	}
+	cmp, err := compareVersions(*desired, *controlPlane.Status.Version)
+	if err != nil {
+		return "", err
+	}
+	if cmp > 0 {
+		return machinePool.Status.Version, nil
+	}
+	return strings.TrimPrefix(*desired, "v"), nil
+}
+
+// controlPlaneToTFCManagedMachinePools maps a TFCManagedControlPlane to the TFCManagedMachinePools
+// of its Cluster, so that machine pools are upgraded once the control plane has been.
+func controlPlaneToTFCManagedMachinePools(ctx context.Context, c client.Client) handler.MapFunc {
+	return func(o client.Object) []reconcile.Request {
+		controlPlane, ok := o.(*infrastructurev1alpha1.TFCManagedControlPlane)
+		if !ok {
+			return nil
+		}
+		cluster, err := util.GetOwnerCluster(ctx, c, controlPlane.ObjectMeta)
+		if err != nil || cluster == nil {
+			return nil
+		}
+
+		var machinePools expclusterv1beta1.MachinePoolList
+		err = c.List(ctx, &machinePools, client.InNamespace(cluster.Namespace), client.MatchingLabels{
+			clusterv1beta1.ClusterLabelName: cluster.Name,
+		})
+		if err != nil {
+			return nil
+		}
+
+		gk := infrastructurev1alpha1.GroupVersion.WithKind("TFCManagedMachinePool").GroupKind()
+		requests := []reconcile.Request{}
+		for _, mp := range machinePools.Items {
+			ref := mp.Spec.Template.Spec.InfrastructureRef
+			if ref.GroupVersionKind().GroupKind() != gk {
+				continue
+			}
+			requests = append(requests, reconcile.Request{
+				NamespacedName: client.ObjectKey{Namespace: mp.Namespace, Name: ref.Name},
+			})
+		}
+		return requests
+	}
+}
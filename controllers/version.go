@@ -0,0 +1,109 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// versionMatches returns true if actual satisfies the desired version. Only the components
+// specified in desired are compared, so "1.24" matches "v1.24.5-gke.600".
+func versionMatches(desired, actual string) bool {
+	if desired == "" {
+		return true
+	}
+	d := versionComponents(desired)
+	a := versionComponents(actual)
+	if len(a) < len(d) {
+		return false
+	}
+	for i := range d {
+		if d[i] != a[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// versionComponents splits a Kubernetes version into its numeric components,
+// dropping the leading "v" and any pre-release or build metadata.
+func versionComponents(v string) []string {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	return strings.Split(v, ".")
+}
+
+// parseVersion returns the numeric major, minor and patch components of a Kubernetes
+// version. The patch is -1 if the version does not specify one.
+func parseVersion(v string) (major, minor, patch int, err error) {
+	c := versionComponents(v)
+	if len(c) < 2 || len(c) > 3 {
+		return 0, 0, 0, fmt.Errorf("%q is not a valid Kubernetes version", v)
+	}
+	n := []int{0, 0, -1}
+	for i := range c {
+		n[i], err = strconv.Atoi(c[i])
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("%q is not a valid Kubernetes version", v)
+		}
+	}
+	return n[0], n[1], n[2], nil
+}
+
+// compareVersions returns -1, 0 or 1 if a is older, the same as or newer than b.
+// Only the components specified by both versions are compared.
+func compareVersions(a, b string) (int, error) {
+	aMajor, aMinor, aPatch, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	bMajor, bMinor, bPatch, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	x := []int{aMajor, aMinor, aPatch}
+	y := []int{bMajor, bMinor, bPatch}
+	for i := range x {
+		if x[i] == -1 || y[i] == -1 {
+			break
+		}
+		if x[i] < y[i] {
+			return -1, nil
+		}
+		if x[i] > y[i] {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// validateVersionUpgrade returns an error if moving from the current to the desired version
+// is a downgrade, changes the major version or skips a minor version.
+func validateVersionUpgrade(current, desired string) error {
+	cMajor, cMinor, _, err := parseVersion(current)
+	if err != nil {
+		return err
+	}
+	dMajor, dMinor, _, err := parseVersion(desired)
+	if err != nil {
+		return err
+	}
+	cmp, err := compareVersions(desired, current)
+	if err != nil {
+		return err
+	}
+	switch {
+	case cmp < 0:
+		return fmt.Errorf("downgrading from %s to %s is not supported", current, desired)
+	case dMajor != cMajor:
+		return fmt.Errorf("upgrading from %s to %s changes the major version", current, desired)
+	case dMinor > cMinor+1:
+		return fmt.Errorf("upgrading from %s to %s skips a minor version", current, desired)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/utils/pointer"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/controllers/noderefutil"
+	"sigs.k8s.io/cluster-api/controllers/remote"
+	expclusterv1beta1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+const defaultReadinessRequestTimeout = 10 * time.Second
+const defaultReadinessTimeout = 10 * time.Minute
+
+// probeError describes why the workload cluster API server is not ready
+type probeError struct {
+	Reason  string
+	Message string
+}
+
+func (e *probeError) Error() string {
+	return e.Message
+}
+
+// probeWorkloadCluster uses the supplied kubeconfig to check that the workload cluster's
+// API server is ready and running the desired Kubernetes version. The version reported
+// by the API server is returned.
+func probeWorkloadCluster(ctx context.Context, kubeconfig []byte, timeout time.Duration, version string) (string, error) {
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return "", &probeError{
+			Reason:  infrastructurev1alpha1.APIServerUnreachableReason,
+			Message: fmt.Sprintf("could not load kubeconfig: %v", err),
+		}
+	}
+	restConfig.Timeout = timeout
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return "", &probeError{
+			Reason:  infrastructurev1alpha1.APIServerUnreachableReason,
+			Message: fmt.Sprintf("could not create client: %v", err),
+		}
+	}
+
+	body, err := clientset.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw(ctx)
+	if err != nil {
+		return "", &probeError{
+			Reason:  infrastructurev1alpha1.APIServerNotReadyReason,
+			Message: fmt.Sprintf("API server is not ready: %v", err),
+		}
+	}
+	if strings.TrimSpace(string(body)) != "ok" {
+		return "", &probeError{
+			Reason:  infrastructurev1alpha1.APIServerNotReadyReason,
+			Message: fmt.Sprintf("API server is not ready: %s", body),
+		}
+	}
+
+	serverVersion, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		return "", &probeError{
+			Reason:  infrastructurev1alpha1.APIServerUnreachableReason,
+			Message: fmt.Sprintf("could not read API server version: %v", err),
+		}
+	}
+	if !versionMatches(version, serverVersion.GitVersion) {
+		return serverVersion.GitVersion, &probeError{
+			Reason:  infrastructurev1alpha1.VersionMismatchReason,
+			Message: fmt.Sprintf("API server is running version %s, expected %s", serverVersion.GitVersion, version),
+		}
+	}
+	return serverVersion.GitVersion, nil
+}
+
+// reconcileReadiness probes the workload cluster API server and records the result in
+// the WorkloadClusterReady condition and status.version. An error is returned if the
+// API server is not ready.
+func (r *TFCManagedControlPlaneReconciler) reconcileReadiness(ctx context.Context, cluster *infrastructurev1alpha1.TFCManagedControlPlane, kubeconfig []byte) error {
+	check := cluster.Spec.ReadinessCheck
+	if check.Disabled {
+		cluster.Status.Version = pointer.String(cluster.Spec.Version)
+		conditions.MarkTrue(cluster, infrastructurev1alpha1.WorkloadClusterReadyCondition)
+		return nil
+	}
+
+	requestTimeout := defaultReadinessRequestTimeout
+	if check.RequestTimeout != nil {
+		requestTimeout = check.RequestTimeout.Duration
+	}
+	timeout := defaultReadinessTimeout
+	if check.Timeout != nil {
+		timeout = check.Timeout.Duration
+	}
+
+	version, err := probeWorkloadCluster(ctx, kubeconfig, requestTimeout, cluster.Spec.Version)
+	if err == nil {
+		cluster.Status.Version = pointer.String(version)
+		conditions.MarkTrue(cluster, infrastructurev1alpha1.WorkloadClusterReadyCondition)
+		return nil
+	}
+
+	if version != "" {
+		cluster.Status.Version = pointer.String(version)
+	}
+
+	reason := infrastructurev1alpha1.APIServerUnreachableReason
+	var perr *probeError
+	if errors.As(err, &perr) {
+		reason = perr.Reason
+	}
+	severity := clusterv1beta1.ConditionSeverityWarning
+	if time.Since(cluster.Status.Terraform.RunFinishedAt.Time) > timeout {
+		severity = clusterv1beta1.ConditionSeverityError
+	}
+	conditions.MarkFalse(cluster, infrastructurev1alpha1.WorkloadClusterReadyCondition, reason, severity, "%s", err.Error())
+	return err
+}
+
+// workloadClient returns a client of the workload cluster. The client of the Tracker reads Nodes from a
+// cache kept for each cluster; without a Tracker, as in tests, a new client is created for each call.
+func (r *TFCManagedMachinePoolReconciler) workloadClient(ctx context.Context, cluster *clusterv1beta1.Cluster) (client.Client, error) {
+	if r.Tracker == nil {
+		return remote.NewClusterClient(ctx, "tfc-managed-machine-pool", r.Client, util.ObjectKey(cluster))
+	}
+	return r.Tracker.GetClient(ctx, util.ObjectKey(cluster))
+}
+
+// reconcileNodes matches the Nodes of the workload cluster against the provider IDs of the
+// machine pool, records the number of ready instances in status and the NodesReady condition,
+// and returns true once the expected number of Nodes are Ready.
+func (r *TFCManagedMachinePoolReconciler) reconcileNodes(ctx context.Context, machinePool *infrastructurev1alpha1.TFCManagedMachinePool, ownerMachinePool *expclusterv1beta1.MachinePool, ownerCluster *clusterv1beta1.Cluster) (bool, error) {
+	workloadClient, err := r.workloadClient(ctx, ownerCluster)
+	if err != nil {
+		conditions.MarkFalse(machinePool, infrastructurev1alpha1.NodesReadyCondition,
+			infrastructurev1alpha1.WorkloadClusterUnreachableReason, clusterv1beta1.ConditionSeverityWarning, "%s", err.Error())
+		return false, err
+	}
+
+	var nodes corev1.NodeList
+	if err := workloadClient.List(ctx, &nodes); err != nil {
+		conditions.MarkFalse(machinePool, infrastructurev1alpha1.NodesReadyCondition,
+			infrastructurev1alpha1.WorkloadClusterUnreachableReason, clusterv1beta1.ConditionSeverityWarning, "%s", err.Error())
+		return false, err
+	}
+
+	nodeReady := map[string]bool{}
+	for i := range nodes.Items {
+		id, err := noderefutil.NewProviderID(nodes.Items[i].Spec.ProviderID)
+		if err != nil {
+			continue
+		}
+		nodeReady[id.IndexKey()] = noderefutil.IsNodeReady(&nodes.Items[i])
+	}
+
+	var ready int32
+	for _, providerID := range machinePool.Spec.ProviderIDList {
+		id, err := noderefutil.NewProviderID(providerID)
+		if err != nil {
+			continue
+		}
+		if nodeReady[id.IndexKey()] {
+			ready++
+		}
+	}
+	machinePool.Status.ReadyReplicas = ready
+	machinePool.Status.UnreadyReplicas = int32(len(machinePool.Spec.ProviderIDList)) - ready
+
+	// when the module manages autoscaling itself the number of provisioned instances is authoritative
+	desired := machinePool.Status.Replicas
+	if !machinePool.Spec.ManagedAutoscaling && ownerMachinePool.Spec.Replicas != nil {
+		desired = *ownerMachinePool.Spec.Replicas
+	}
+	if ready < desired {
+		conditions.MarkFalse(machinePool, infrastructurev1alpha1.NodesReadyCondition,
+			infrastructurev1alpha1.WaitingForNodesReason, clusterv1beta1.ConditionSeverityInfo,
+			"%d of %d Nodes are Ready", ready, desired)
+		return false, nil
+	}
+	conditions.MarkTrue(machinePool, infrastructurev1alpha1.NodesReadyCondition)
+	return true, nil
+}
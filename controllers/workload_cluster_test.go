@@ -0,0 +1,63 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/controllers/remote"
+	expclusterv1beta1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+func TestReconcileNodesWithTracker(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	node := func(name string, ready corev1.ConditionStatus) client.Object {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.NodeSpec{ProviderID: "gce://example/" + name},
+			Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: ready},
+			}},
+		}
+	}
+	workload := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		node("a", corev1.ConditionTrue),
+		node("b", corev1.ConditionFalse),
+	).Build()
+
+	cluster := &clusterv1beta1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"}}
+	r := &TFCManagedMachinePoolReconciler{
+		Tracker: remote.NewTestClusterCacheTracker(logr.Discard(), workload, scheme, client.ObjectKeyFromObject(cluster)),
+	}
+	machinePool := &infrastructurev1alpha1.TFCManagedMachinePool{
+		Spec: infrastructurev1alpha1.TFCManagedMachinePoolSpec{
+			ProviderIDList: []string{"gce://example/a", "gce://example/b"},
+		},
+	}
+	ownerMachinePool := &expclusterv1beta1.MachinePool{
+		Spec: expclusterv1beta1.MachinePoolSpec{Replicas: pointer.Int32(2)},
+	}
+
+	ready, err := r.reconcileNodes(context.Background(), machinePool, ownerMachinePool, cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready || machinePool.Status.ReadyReplicas != 1 || machinePool.Status.UnreadyReplicas != 1 {
+		t.Errorf("expected 1 of 2 Nodes to be ready, got %t, %d ready and %d unready", ready, machinePool.Status.ReadyReplicas, machinePool.Status.UnreadyReplicas)
+	}
+}
@@ -10,5 +10,26 @@ variable "kubernetes_version" {
 }
 
 variable "cluster_network" {
-  type = object({})
-}
\ No newline at end of file
+  type = object({
+    api_server_port     = number
+    service_domain      = string
+    pod_cidr_blocks     = list(string)
+    service_cidr_blocks = list(string)
+  })
+  default = null
+}
+
+variable "cluster_labels" {
+  type    = map(string)
+  default = {}
+}
+
+variable "cluster_annotations" {
+  type    = map(string)
+  default = {}
+}
+
+variable "cluster_topology" {
+  type    = any
+  default = null
+}
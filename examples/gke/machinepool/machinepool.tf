@@ -16,6 +16,7 @@ resource "google_container_node_pool" "node_pool" {
 
   name       = var.pool_name
   node_count = var.replicas
+  version    = var.kubernetes_version
 
   node_config {
     preemptible  = true
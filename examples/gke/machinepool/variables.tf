@@ -13,6 +13,11 @@ variable "replicas" {
   type = number
 }
 
+variable "kubernetes_version" {
+  type    = string
+  default = null
+}
+
 variable "machine_type" {
   type    = string
   default = "e2-standard-2"
@@ -17,25 +17,39 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	tfc "github.com/hashicorp/go-tfe"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/controllers/remote"
 	expclusterv1beta1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/backend"
 	"github.com/hashicorp/cluster-api-provider-terraform-cloud/controllers"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/render"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/webhooks"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -54,14 +68,56 @@ func init() {
 }
 
 func main() {
+	// render and validate Terraform configuration offline instead of running the manager
+	if len(os.Args) > 1 {
+		for _, command := range render.Commands {
+			if os.Args[1] != command {
+				continue
+			}
+			if err := render.Run(context.Background(), command, os.Args[2:], os.Stdout, os.Stderr); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var watchFilterValue string
+	var watchNamespace string
+	var watchNamespaces string
+	var shardSelector string
+	var controlPlaneConcurrency int
+	var machinePoolConcurrency int
+	var requeueIntervals controllers.RequeueIntervals
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&watchFilterValue, "watch-filter", "",
+		fmt.Sprintf("Label value that the controller watches to reconcile cluster-api objects. "+
+			"Label key is always %s. If unspecified, the controller watches for all cluster-api objects.", clusterv1beta1.WatchLabel))
+	flag.StringVar(&watchNamespace, "namespace", "",
+		"Namespace that the controller watches to reconcile objects. "+
+			"If unspecified, the controller watches for objects across all namespaces.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma-separated list of namespaces that the controller watches to reconcile objects, in addition to --namespace.")
+	flag.StringVar(&shardSelector, "shard-selector", "",
+		"Label selector of the TFCManagedControlPlanes and TFCManagedMachinePools reconciled by this manager, "+
+			"so that several managers can split them. Each shard elects its own leader.")
+	flag.IntVar(&controlPlaneConcurrency, "tfcmanagedcontrolplane-max-concurrent-reconciles", 1,
+		"Number of TFCManagedControlPlanes reconciled at the same time.")
+	flag.IntVar(&machinePoolConcurrency, "tfcmanagedmachinepool-max-concurrent-reconciles", 1,
+		"Number of TFCManagedMachinePools reconciled at the same time.")
+	flag.DurationVar(&requeueIntervals.Short, "short-requeue-interval", controllers.DefaultRequeueIntervals.Short,
+		"How long to wait for what is expected to be ready soon, such as a state version or the control plane of a machine pool.")
+	flag.DurationVar(&requeueIntervals.Default, "requeue-interval", controllers.DefaultRequeueIntervals.Default,
+		"How long to wait between polls of a run and before retrying after an error.")
+	flag.DurationVar(&requeueIntervals.Long, "long-requeue-interval", controllers.DefaultRequeueIntervals.Long,
+		"How long to wait for a configuration version or a new run to be processed.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -70,13 +126,29 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	ctx := ctrl.SetupSignalHandler()
+
+	selector, err := labels.Parse(shardSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid shard selector")
+		os.Exit(1)
+	}
+	leaderElectionID := "383e0614.cluster.x-k8s.io"
+	if !selector.Empty() {
+		// managers of different shards each elect their own leader
+		hash := sha256.Sum256([]byte(selector.String()))
+		leaderElectionID = fmt.Sprintf("%x.%s", hash[:4], leaderElectionID)
+	}
+	namespaces := splitNamespaces(watchNamespace, watchNamespaces)
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "383e0614.cluster.x-k8s.io",
+		LeaderElectionID:       leaderElectionID,
+		NewCache:               newCache(namespaces, selector),
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -96,20 +168,65 @@ func main() {
 		os.Exit(1)
 	}
 
+	// the controller-runtime client cannot read pod logs, which the local backend reads plans from
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create clientset")
+		os.Exit(1)
+	}
+
+	// Terraform Cloud clients and rate limits are shared by the controllers
+	tfcClients := backend.NewClientCache(tfc.NewClient)
+
+	// clients of the workload clusters are cached, and dropped once a cluster is deleted
+	trackerLog := ctrl.Log.WithName("remote").WithName("ClusterCacheTracker")
+	tracker, err := remote.NewClusterCacheTracker(mgr, remote.ClusterCacheTrackerOptions{Log: &trackerLog})
+	if err != nil {
+		setupLog.Error(err, "unable to create cluster cache tracker")
+		os.Exit(1)
+	}
+	if err = (&remote.ClusterCacheReconciler{
+		Client:           mgr.GetClient(),
+		Tracker:          tracker,
+		WatchFilterValue: watchFilterValue,
+	}).SetupWithManager(ctx, mgr, controller.Options{}); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterCacheReconciler")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.TFCManagedControlPlaneReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		TFCClients:              tfcClients,
+		PodLogs:                 clientset.CoreV1(),
+		WatchFilterValue:        watchFilterValue,
+		MaxConcurrentReconciles: controlPlaneConcurrency,
+		RequeueIntervals:        requeueIntervals,
+	}).SetupWithManager(ctx, mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "TFCManagedControlPlane")
 		os.Exit(1)
 	}
 	if err = (&controllers.TFCManagedMachinePoolReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		TFCClients:              tfcClients,
+		PodLogs:                 clientset.CoreV1(),
+		Tracker:                 tracker,
+		WatchFilterValue:        watchFilterValue,
+		MaxConcurrentReconciles: machinePoolConcurrency,
+		RequeueIntervals:        requeueIntervals,
+	}).SetupWithManager(ctx, mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "TFCManagedMachinePool")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&webhooks.ConfigurationValidator{
+			Client: mgr.GetClient(),
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ConfigurationValidator")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -122,8 +239,46 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// splitNamespaces returns the namespaces set with --namespace and --watch-namespaces
+func splitNamespaces(namespace, namespaces string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, ns := range append([]string{namespace}, strings.Split(namespaces, ",")...) {
+		ns = strings.TrimSpace(ns)
+		if ns == "" || seen[ns] {
+			continue
+		}
+		seen[ns] = true
+		result = append(result, ns)
+	}
+	return result
+}
+
+// newCache returns the constructor of the manager cache, which only holds objects of the
+// watched namespaces, and only the TFCManagedControlPlanes and TFCManagedMachinePools
+// matching the shard selector. The controllers never see the other ones.
+func newCache(namespaces []string, selector labels.Selector) cache.NewCacheFunc {
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		if !selector.Empty() {
+			opts.SelectorsByObject = cache.SelectorsByObject{
+				&infrastructurev1alpha1.TFCManagedControlPlane{}: {Label: selector},
+				&infrastructurev1alpha1.TFCManagedMachinePool{}:  {Label: selector},
+			}
+		}
+		switch len(namespaces) {
+		case 0:
+			return cache.New(config, opts)
+		case 1:
+			opts.Namespace = namespaces[0]
+			return cache.New(config, opts)
+		default:
+			return cache.MultiNamespacedCacheBuilder(namespaces)(config, opts)
+		}
+	}
+}
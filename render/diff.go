@@ -0,0 +1,136 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package render
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/terraform"
+)
+
+// runDiff lists the configuration revisions stored for a resource or prints the difference between two of them
+func runDiff(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var namespace, kubeconfig string
+	var list bool
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: manager diff [flags] KIND NAME [FROM [TO]]\n\n")
+		fmt.Fprintf(stderr, "Prints the difference between two configuration revisions of a TFCManagedControlPlane or\n")
+		fmt.Fprintf(stderr, "TFCManagedMachinePool. Without FROM and TO the last two revisions are compared; with only\n")
+		fmt.Fprintf(stderr, "FROM it is compared with the latest revision.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&namespace, "namespace", "default", "Namespace of the resource.")
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path of the kubeconfig of the management cluster. Defaults to $KUBECONFIG or ~/.kube/config.")
+	fs.BoolVar(&list, "list", false, "List the stored revisions instead of comparing them.")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() < 2 || fs.NArg() > 4 {
+		fs.Usage()
+		return errors.New("expected KIND NAME [FROM [TO]]")
+	}
+
+	var owner client.Object
+	switch strings.ToLower(fs.Arg(0)) {
+	case "tfcmanagedcontrolplane", "tfcmanagedcontrolplanes":
+		owner = &infrastructurev1alpha1.TFCManagedControlPlane{}
+	case "tfcmanagedmachinepool", "tfcmanagedmachinepools":
+		owner = &infrastructurev1alpha1.TFCManagedMachinePool{}
+	default:
+		return fmt.Errorf("unknown kind %q, expected TFCManagedControlPlane or TFCManagedMachinePool", fs.Arg(0))
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return err
+	}
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: fs.Arg(1)}, owner); err != nil {
+		return err
+	}
+	revisions, err := terraform.ListRevisions(ctx, c, owner)
+	if err != nil {
+		return err
+	}
+
+	if list {
+		w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "REVISION\tCONFIGURATION VERSION\tCREATED\tOMITTED FILES")
+		for _, cm := range revisions {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", terraform.Revision(&cm), cm.Annotations[terraform.ConfigurationVersionAnnotation],
+				cm.CreationTimestamp.UTC().Format("2006-01-02T15:04:05Z"), cm.Annotations[terraform.OmittedFilesAnnotation])
+		}
+		return w.Flush()
+	}
+
+	if len(revisions) == 0 {
+		return errors.New("no configuration revisions are stored")
+	}
+	to := &revisions[len(revisions)-1]
+	var from *corev1.ConfigMap
+	switch fs.NArg() {
+	case 2:
+		if len(revisions) < 2 {
+			return errors.New("only one configuration revision is stored")
+		}
+		from = &revisions[len(revisions)-2]
+	case 3:
+		if from, err = findRevision(revisions, fs.Arg(2)); err != nil {
+			return err
+		}
+	case 4:
+		if from, err = findRevision(revisions, fs.Arg(2)); err != nil {
+			return err
+		}
+		if to, err = findRevision(revisions, fs.Arg(3)); err != nil {
+			return err
+		}
+	}
+
+	diff, err := terraform.DiffRevisions(from, to)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "# revision %d (%s) -> revision %d (%s)\n", terraform.Revision(from), from.Annotations[terraform.ConfigurationVersionAnnotation],
+		terraform.Revision(to), to.Annotations[terraform.ConfigurationVersionAnnotation])
+	_, err = io.WriteString(stdout, diff)
+	return err
+}
+
+// findRevision returns the revision with the given number
+func findRevision(revisions []corev1.ConfigMap, s string) (*corev1.ConfigMap, error) {
+	revision, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid revision %q", s)
+	}
+	for i := range revisions {
+		if terraform.Revision(&revisions[i]) == revision {
+			return &revisions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("revision %d is not stored", revision)
+}
@@ -0,0 +1,387 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Package render implements the render and validate commands of the manager, which produce the
+// Terraform configuration for TFCManagedControlPlane and TFCManagedMachinePool manifests offline,
+// and the diff command, which compares the configuration revisions stored by the controller.
+package render
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expclusterv1beta1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/terraform"
+)
+
+// Commands are the names of the commands implemented by Run
+var Commands = []string{"render", "validate", "diff"}
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(infrastructurev1alpha1.AddToScheme(scheme))
+	utilruntime.Must(clusterv1beta1.AddToScheme(scheme))
+	utilruntime.Must(expclusterv1beta1.AddToScheme(scheme))
+}
+
+// options are the flags of the render and validate commands
+type options struct {
+	namespace string
+	outputDir string
+	validate  bool
+	terraform string
+}
+
+// configuration is the configuration rendered for one resource
+type configuration struct {
+	kind      string
+	object    client.Object
+	files     map[string][]byte
+	extra     map[string][]byte
+	secrets   map[string]bool
+	hash      string
+	hashes    infrastructurev1alpha1.ConfigurationHashes
+	directory string
+}
+
+// Run runs the command with the arguments following the command name. render prints the configuration of every TFCManagedControlPlane and TFCManagedMachinePool in
+// the manifests, or writes it to a directory; validate runs terraform validate against it; diff
+// compares the configuration revisions stored for a resource.
+func Run(ctx context.Context, command string, args []string, stdout, stderr io.Writer) error {
+	if command == "diff" {
+		return runDiff(ctx, args, stdout, stderr)
+	}
+
+	var opts options
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: manager %s [flags] FILE...\n\n", command)
+		fmt.Fprintf(stderr, "Renders the Terraform configuration of the TFCManagedControlPlanes and TFCManagedMachinePools\n")
+		fmt.Fprintf(stderr, "in the YAML manifests, which must also contain their Clusters, MachinePools and any ConfigMaps\n")
+		fmt.Fprintf(stderr, "and Secrets they refer to. Use - to read manifests from standard input.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.namespace, "namespace", "default", "Namespace of manifests that do not set one.")
+	fs.StringVar(&opts.outputDir, "output-dir", "", "Write the configuration of each resource to <output-dir>/<kind>/<namespace>/<name> instead of printing it.")
+	fs.BoolVar(&opts.validate, "validate", command == "validate", "Run terraform init and terraform validate against the configuration.")
+	fs.StringVar(&opts.terraform, "terraform", "terraform", "Path of the terraform binary used to validate the configuration.")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no manifests given")
+	}
+
+	objects := []client.Object{}
+	for _, name := range fs.Args() {
+		objs, err := readManifests(name, opts.namespace)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, objs...)
+	}
+
+	configs, err := renderConfigurations(ctx, objects)
+	if err != nil {
+		return err
+	}
+	if len(configs) == 0 {
+		return errors.New("no TFCManagedControlPlane or TFCManagedMachinePool found in the manifests")
+	}
+
+	failed := 0
+	for _, config := range configs {
+		if err := output(config, opts, command == "render", stdout, stderr); err != nil {
+			fmt.Fprintf(stderr, "%s %s: %v\n", config.kind, client.ObjectKeyFromObject(config.object), err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d configurations failed", failed, len(configs))
+	}
+	return nil
+}
+
+// readManifests decodes the objects of a file of YAML or JSON manifests, skipping kinds that are not known
+func readManifests(name, namespace string) ([]client.Object, error) {
+	var r io.Reader
+	if name == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	objects := []client.Object{}
+	decoder := yaml.NewYAMLOrJSONDecoder(bufio.NewReader(r), 4096)
+	for {
+		u := &unstructured.Unstructured{}
+		if err := decoder.Decode(&u.Object); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("could not decode %s: %w", name, err)
+		}
+		if len(u.Object) == 0 {
+			continue
+		}
+
+		obj, err := scheme.New(u.GroupVersionKind())
+		if err != nil {
+			continue
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj); err != nil {
+			return nil, fmt.Errorf("could not decode %s %s in %s: %w", u.GetKind(), u.GetName(), name, err)
+		}
+		o, ok := obj.(client.Object)
+		if !ok {
+			continue
+		}
+		if o.GetNamespace() == "" {
+			o.SetNamespace(namespace)
+		}
+		// the API server merges stringData into data when a Secret is written
+		if secret, ok := o.(*corev1.Secret); ok {
+			for k, v := range secret.StringData {
+				if secret.Data == nil {
+					secret.Data = map[string][]byte{}
+				}
+				secret.Data[k] = []byte(v)
+			}
+			secret.StringData = nil
+		}
+		objects = append(objects, o)
+	}
+	return objects, nil
+}
+
+// renderConfigurations renders the configuration of every TFCManagedControlPlane and TFCManagedMachinePool
+func renderConfigurations(ctx context.Context, objects []client.Object) ([]*configuration, error) {
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+
+	configs := []*configuration{}
+	for _, obj := range objects {
+		var config *configuration
+		var err error
+		switch o := obj.(type) {
+		case *infrastructurev1alpha1.TFCManagedControlPlane:
+			config, err = renderControlPlane(ctx, c, o, objects)
+		case *infrastructurev1alpha1.TFCManagedMachinePool:
+			config, err = renderMachinePool(ctx, c, o, objects)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", obj.GetObjectKind().GroupVersionKind().Kind, client.ObjectKeyFromObject(obj), err)
+		}
+		configs = append(configs, config)
+	}
+
+	sort.SliceStable(configs, func(i, j int) bool {
+		if configs[i].kind != configs[j].kind {
+			return configs[i].kind < configs[j].kind
+		}
+		return client.ObjectKeyFromObject(configs[i].object).String() < client.ObjectKeyFromObject(configs[j].object).String()
+	})
+	return configs, nil
+}
+
+func renderControlPlane(ctx context.Context, c client.Client, controlPlane *infrastructurev1alpha1.TFCManagedControlPlane, objects []client.Object) (*configuration, error) {
+	var cluster *clusterv1beta1.Cluster
+	for _, obj := range objects {
+		cl, ok := obj.(*clusterv1beta1.Cluster)
+		if !ok || cl.Namespace != controlPlane.Namespace {
+			continue
+		}
+		for _, ref := range []*corev1.ObjectReference{cl.Spec.ControlPlaneRef, cl.Spec.InfrastructureRef} {
+			if ref != nil && ref.Kind == "TFCManagedControlPlane" && ref.Name == controlPlane.Name {
+				cluster = cl
+			}
+		}
+	}
+	if cluster == nil {
+		return nil, errors.New("no Cluster in the manifests refers to it")
+	}
+
+	files, err := terraform.ManagedControlPlaneFiles(ctx, c, controlPlane, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return newConfiguration(ctx, c, "TFCManagedControlPlane", controlPlane, files, controlPlane.Spec.ExtraFiles)
+}
+
+func renderMachinePool(ctx context.Context, c client.Client, machinePool *infrastructurev1alpha1.TFCManagedMachinePool, objects []client.Object) (*configuration, error) {
+	var owner *expclusterv1beta1.MachinePool
+	for _, obj := range objects {
+		mp, ok := obj.(*expclusterv1beta1.MachinePool)
+		if !ok || mp.Namespace != machinePool.Namespace {
+			continue
+		}
+		ref := mp.Spec.Template.Spec.InfrastructureRef
+		if ref.Kind == "TFCManagedMachinePool" && ref.Name == machinePool.Name {
+			owner = mp
+		}
+	}
+	if owner == nil {
+		return nil, errors.New("no MachinePool in the manifests refers to it")
+	}
+
+	var cluster *clusterv1beta1.Cluster
+	for _, obj := range objects {
+		if cl, ok := obj.(*clusterv1beta1.Cluster); ok && cl.Namespace == owner.Namespace && cl.Name == owner.Spec.ClusterName {
+			cluster = cl
+		}
+	}
+	if cluster == nil {
+		return nil, fmt.Errorf("Cluster %q of MachinePool %q is not in the manifests", owner.Spec.ClusterName, owner.Name)
+	}
+
+	// the controller holds back the version until the control plane has been upgraded
+	if machinePool.Status.Version == "" && owner.Spec.Template.Spec.Version != nil {
+		machinePool.Status.Version = strings.TrimPrefix(*owner.Spec.Template.Spec.Version, "v")
+	}
+
+	files, err := terraform.ManagedMachinePoolFiles(ctx, c, machinePool, owner, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return newConfiguration(ctx, c, "TFCManagedMachinePool", machinePool, files, machinePool.Spec.ExtraFiles)
+}
+
+func newConfiguration(ctx context.Context, c client.Client, kind string, obj client.Object, files map[string][]byte, extraFiles []infrastructurev1alpha1.ExtraFile) (*configuration, error) {
+	extra, err := terraform.ReadExtraFiles(ctx, c, obj.GetNamespace(), extraFiles)
+	if err != nil {
+		return nil, err
+	}
+	// workspace variables are only known to Terraform Cloud
+	hash, hashes := terraform.HashConfiguration(files, extra, nil)
+	return &configuration{
+		kind:    kind,
+		object:  obj,
+		files:   files,
+		extra:   extra,
+		secrets: terraform.SecretFileNames(extraFiles),
+		hash:    hash,
+		hashes:  hashes,
+	}, nil
+}
+
+// output prints or writes the configuration and validates it if requested
+func output(config *configuration, opts options, print bool, stdout, stderr io.Writer) error {
+	key := client.ObjectKeyFromObject(config.object)
+	fmt.Fprintf(stdout, "# %s %s\n", config.kind, key)
+	fmt.Fprintf(stdout, "# configuration: %s\n", config.hashes.Configuration)
+	fmt.Fprintf(stdout, "# extraFiles:    %s\n", config.hashes.ExtraFiles)
+
+	if opts.outputDir != "" {
+		config.directory = filepath.Join(opts.outputDir, strings.ToLower(config.kind), key.Namespace, key.Name)
+		if err := writeFiles(config.directory, config.files, config.extra); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "# written to %s\n", config.directory)
+	} else if print {
+		names := []string{}
+		for name := range config.files {
+			names = append(names, name)
+		}
+		for name := range config.extra {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if config.secrets[name] {
+				fmt.Fprintf(stdout, "\n## %s (read from a Secret, not shown)\n", name)
+				continue
+			}
+			content, ok := config.files[name]
+			if !ok {
+				content = config.extra[name]
+			}
+			fmt.Fprintf(stdout, "\n## %s\n%s", name, content)
+			if len(content) > 0 && content[len(content)-1] != '\n' {
+				fmt.Fprintln(stdout)
+			}
+		}
+	}
+	fmt.Fprintln(stdout)
+
+	if !opts.validate {
+		return nil
+	}
+	dir := config.directory
+	if dir == "" {
+		var err error
+		dir, err = terraform.CreateConfiguration(config.files, config.extra)
+		defer os.RemoveAll(dir)
+		if err != nil {
+			return err
+		}
+	}
+	return validate(opts.terraform, dir, stdout, stderr)
+}
+
+// writeFiles writes the configuration files to the directory, replacing its previous content
+func writeFiles(dir string, files, extra map[string][]byte) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, fs := range []map[string][]byte{files, extra} {
+		for name, content := range fs {
+			if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validate runs terraform init without a backend and terraform validate in the directory
+func validate(binary, dir string, stdout, stderr io.Writer) error {
+	for _, args := range [][]string{
+		{"init", "-backend=false", "-input=false", "-no-color"},
+		{"validate", "-no-color"},
+	} {
+		cmd := exec.Command(binary, args...)
+		cmd.Dir = dir
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("terraform %s failed: %w", args[0], err)
+		}
+	}
+	return nil
+}
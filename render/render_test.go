@@ -0,0 +1,65 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package render
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestRender(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	err := Run(context.Background(), "render", []string{filepath.Join("testdata", "manifests.yaml")}, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("%v: %s", err, stderr.String())
+	}
+
+	path := filepath.Join("testdata", "render.golden")
+	if *update {
+		if err := os.WriteFile(path, stdout.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != string(want) {
+		t.Errorf("output does not match %s (run go test with -update to regenerate)\ngot:\n%s\nwant:\n%s", path, stdout.String(), want)
+	}
+	if strings.Contains(stdout.String(), `credentials = "secret"`) {
+		t.Error("expected the content of extra files from Secrets not to be printed")
+	}
+}
+
+func TestRenderMissingCluster(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "controlplane.yaml")
+	err := os.WriteFile(manifest, []byte(`
+apiVersion: infrastructure.cluster.x-k8s.io/v1alpha1
+kind: TFCManagedControlPlane
+metadata:
+  name: my-cluster
+spec:
+  version: "1.24"
+  module:
+    source: my-org/capi/controlplane
+    version: 1.0.0
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = Run(context.Background(), "render", []string{manifest}, &stdout, &stderr)
+	if err == nil || !strings.Contains(err.Error(), "no Cluster in the manifests refers to it") {
+		t.Errorf("expected an error for the missing Cluster, got %v", err)
+	}
+}
@@ -4,41 +4,60 @@
 package terraform
 
 import (
-	"crypto/md5"
 	"fmt"
-	"html/template"
-	"io"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
 )
 
-// CreateConfiguration creates a terraform configuration using the supplied template
-func CreateConfiguration(tpl string, objectData any, ownerObjectData any) (string, string, error) {
-	td, err := os.MkdirTemp("", "tf-*")
-	if err != nil {
-		return "", "", err
+// configurationFileName is the name of the file generated configuration is written to
+const configurationFileName = "main.tf"
+
+// Files returns the files of a generated configuration keyed by file name
+func Files(config *hclwrite.File) map[string][]byte {
+	return map[string][]byte{
+		configurationFileName: config.Bytes(),
 	}
-	f, err := os.CreateTemp(td, "*.tf")
-	if err != nil {
-		return "", "", err
+}
+
+// MergeFiles returns the configuration files together with the extra files supplied
+// alongside them, refusing names that conflict or that are not plain file names
+func MergeFiles(files map[string][]byte, extraFiles map[string][]byte) (map[string][]byte, error) {
+	merged := map[string][]byte{}
+	for name := range extraFiles {
+		if _, ok := files[name]; ok {
+			return nil, fmt.Errorf("extra file %q conflicts with a file of the configuration", name)
+		}
+	}
+	for _, fs := range []map[string][]byte{files, extraFiles} {
+		for name, content := range fs {
+			if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+				return nil, fmt.Errorf("%q is not a valid file name", name)
+			}
+			merged[name] = content
+		}
 	}
+	return merged, nil
+}
 
-	t, err := template.New("module").Parse(tpl)
+// CreateConfiguration writes the configuration files and the extra files supplied alongside
+// them to a new temporary directory and returns the path of the directory
+func CreateConfiguration(files map[string][]byte, extraFiles map[string][]byte) (string, error) {
+	merged, err := MergeFiles(files, extraFiles)
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
-	err = t.Execute(f, struct{ Object, Owner any }{
-		Object: objectData,
-		Owner:  ownerObjectData,
-	})
+
+	td, err := os.MkdirTemp("", "tf-*")
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
-
-	// create hash of the config
-	h := md5.New()
-	f.Seek(0, io.SeekStart)
-	if _, err := io.Copy(h, f); err != nil {
-		return "", "", err
+	for name, content := range merged {
+		if err := os.WriteFile(filepath.Join(td, name), content, 0o644); err != nil {
+			return td, err
+		}
 	}
-	return td, fmt.Sprintf("%x", h.Sum(nil)), nil
+	return td, nil
 }
@@ -0,0 +1,262 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package terraform
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expclusterv1beta1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// assertGolden compares the configuration with testdata/<name>.golden
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("configuration does not match %s (run go test with -update to regenerate)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func testControlPlane() *infrastructurev1alpha1.TFCManagedControlPlane {
+	return &infrastructurev1alpha1.TFCManagedControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"},
+		Spec: infrastructurev1alpha1.TFCManagedControlPlaneSpec{
+			Organization: "example-org",
+			Workspace:    "example-cluster",
+			Module: infrastructurev1alpha1.TerraformModule{
+				Source:  "example-org/capi/controlplane",
+				Version: "1.0.0",
+			},
+			Version: "1.24",
+		},
+	}
+}
+
+func testCluster() *clusterv1beta1.Cluster {
+	return &clusterv1beta1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"},
+	}
+}
+
+func TestManagedControlPlaneConfiguration(t *testing.T) {
+	tests := []struct {
+		name         string
+		controlPlane func(*infrastructurev1alpha1.TFCManagedControlPlane)
+		cluster      func(*clusterv1beta1.Cluster)
+	}{
+		{
+			name: "controlplane_minimal",
+		},
+		{
+			name: "controlplane_variables",
+			controlPlane: func(cp *infrastructurev1alpha1.TFCManagedControlPlane) {
+				cp.Spec.Variables = []infrastructurev1alpha1.Variable{{Name: "region"}, {Name: "project_id"}}
+			},
+		},
+		{
+			name: "controlplane_cluster_network",
+			cluster: func(c *clusterv1beta1.Cluster) {
+				c.Spec.ClusterNetwork = &clusterv1beta1.ClusterNetwork{
+					APIServerPort: pointer.Int32(6443),
+					ServiceDomain: "cluster.local",
+					Pods:          &clusterv1beta1.NetworkRanges{CIDRBlocks: []string{"192.168.0.0/16"}},
+					Services:      &clusterv1beta1.NetworkRanges{CIDRBlocks: []string{"10.128.0.0/12", "10.144.0.0/12"}},
+				}
+			},
+		},
+		{
+			name: "controlplane_cluster_network_partial",
+			cluster: func(c *clusterv1beta1.Cluster) {
+				c.Spec.ClusterNetwork = &clusterv1beta1.ClusterNetwork{
+					Services: &clusterv1beta1.NetworkRanges{CIDRBlocks: []string{"10.128.0.0/12"}},
+				}
+			},
+		},
+		{
+			name: "controlplane_cluster_metadata",
+			controlPlane: func(cp *infrastructurev1alpha1.TFCManagedControlPlane) {
+				cp.Spec.Outputs = []infrastructurev1alpha1.OutputMapping{{Name: "region", ClusterAnnotation: "example.com/region"}}
+				cp.Spec.ClusterAnnotations = []string{"example.com/owner", "example.com/region", "example.com/missing"}
+			},
+			cluster: func(c *clusterv1beta1.Cluster) {
+				c.Labels = map[string]string{"env": "prod", "example.com/team": "platform"}
+				c.Annotations = map[string]string{
+					"example.com/owner":  "platform",
+					"example.com/region": "europe-west1",
+					"example.com/pool":   "from-machine-pool-outputs",
+					"kubectl.kubernetes.io/last-applied-configuration": "{}",
+				}
+				c.Spec.ControlPlaneEndpoint = clusterv1beta1.APIEndpoint{Host: "10.0.0.1", Port: 443}
+			},
+		},
+		{
+			name: "controlplane_topology",
+			cluster: func(c *clusterv1beta1.Cluster) {
+				c.Spec.Topology = &clusterv1beta1.Topology{
+					Class:   "gke",
+					Version: "v1.24.5",
+					Variables: []clusterv1beta1.ClusterVariable{
+						{Name: "region", Value: apiextensionsv1.JSON{Raw: []byte(`"europe-west1"`)}},
+						{Name: "zones", Value: apiextensionsv1.JSON{Raw: []byte(`["b","c"]`)}},
+						{Name: "autoscaling", Value: apiextensionsv1.JSON{Raw: []byte(`{"enabled":true,"max":5}`)}},
+					},
+				}
+			},
+		},
+		{
+			name: "controlplane_outputs",
+			controlPlane: func(cp *infrastructurev1alpha1.TFCManagedControlPlane) {
+				cp.Spec.Outputs = []infrastructurev1alpha1.OutputMapping{
+					{Name: "endpoint", Field: infrastructurev1alpha1.OutputFieldControlPlaneEndpointHost},
+					{Name: "admin_password", SecretKey: "password", Sensitive: true},
+					{Name: "admin_password", ConfigMapKey: "password"},
+				}
+			},
+		},
+		{
+			name: "controlplane_escaping",
+			controlPlane: func(cp *infrastructurev1alpha1.TFCManagedControlPlane) {
+				cp.Spec.Module.Source = "git::https://example.com/module.git?ref=main&depth=1"
+				cp.Spec.Version = "1.24\"\n}\nresource \"null_resource\" \"x\" {\n  v = \"${path.cwd}"
+			},
+			cluster: func(c *clusterv1beta1.Cluster) {
+				c.Spec.ClusterNetwork = &clusterv1beta1.ClusterNetwork{ServiceDomain: "cluster.local\" }"}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := testControlPlane()
+			if tt.controlPlane != nil {
+				tt.controlPlane(cp)
+			}
+			c := testCluster()
+			if tt.cluster != nil {
+				tt.cluster(c)
+			}
+			f, err := ManagedControlPlaneConfiguration(cp, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, tt.name, f.Bytes())
+		})
+	}
+}
+
+func TestManagedControlPlaneConfigurationInvalidVariable(t *testing.T) {
+	cp := testControlPlane()
+	cp.Spec.Variables = []infrastructurev1alpha1.Variable{{Name: "region = \"x\"\n"}}
+	if _, err := ManagedControlPlaneConfiguration(cp, testCluster()); err == nil {
+		t.Fatal("expected an error for an invalid variable name")
+	}
+}
+
+func TestManagedMachinePoolConfiguration(t *testing.T) {
+	tests := []struct {
+		name        string
+		machinePool func(*infrastructurev1alpha1.TFCManagedMachinePool)
+		owner       func(*expclusterv1beta1.MachinePool)
+	}{
+		{
+			name: "machinepool_minimal",
+		},
+		{
+			name: "machinepool_autoscaler",
+			owner: func(mp *expclusterv1beta1.MachinePool) {
+				mp.Annotations = map[string]string{
+					"cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size": "1",
+					"cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size": "5",
+				}
+			},
+		},
+		{
+			name: "machinepool_managed_autoscaling",
+			machinePool: func(mp *infrastructurev1alpha1.TFCManagedMachinePool) {
+				mp.Spec.ManagedAutoscaling = true
+				mp.Spec.MachinePoolMachines = true
+				mp.Status.Version = "1.24.5"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mp := &infrastructurev1alpha1.TFCManagedMachinePool{
+				ObjectMeta: metav1.ObjectMeta{Name: "example-pool", Namespace: "default"},
+				Spec: infrastructurev1alpha1.TFCManagedMachinePoolSpec{
+					Module: infrastructurev1alpha1.TerraformModule{
+						Source:  "example-org/capi/machinepool",
+						Version: "1.0.0",
+					},
+				},
+			}
+			if tt.machinePool != nil {
+				tt.machinePool(mp)
+			}
+			owner := &expclusterv1beta1.MachinePool{
+				ObjectMeta: metav1.ObjectMeta{Name: "example-pool", Namespace: "default"},
+				Spec: expclusterv1beta1.MachinePoolSpec{
+					ClusterName: "example",
+					Replicas:    pointer.Int32(3),
+				},
+			}
+			if tt.owner != nil {
+				tt.owner(owner)
+			}
+			f, err := ManagedMachinePoolConfiguration(mp, owner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, tt.name, f.Bytes())
+		})
+	}
+}
+
+func TestCreateConfiguration(t *testing.T) {
+	files := map[string][]byte{"main.tf": []byte(`module "cluster" {}`)}
+	extra := map[string][]byte{"providers.tf": []byte(`provider "google" {}`)}
+
+	dir, err := CreateConfiguration(files, extra)
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"main.tf": `module "cluster" {}`, "providers.tf": `provider "google" {}`} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("unexpected content of %s: %s", name, got)
+		}
+	}
+
+	if _, err := CreateConfiguration(files, map[string][]byte{"main.tf": nil}); err == nil {
+		t.Error("expected an error for an extra file conflicting with the configuration")
+	}
+	if _, err := CreateConfiguration(files, map[string][]byte{"../main.tf": nil}); err == nil {
+		t.Error("expected an error for an extra file outside the configuration directory")
+	}
+}
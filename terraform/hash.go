@@ -0,0 +1,67 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package terraform
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+// WorkspaceVariable is a variable of a workspace or of a variable set applied to it
+type WorkspaceVariable struct {
+	// Source is "workspace" or the ID of the variable set the variable belongs to
+	Source    string
+	ID        string
+	Key       string
+	Category  string
+	Value     string
+	HCL       bool
+	Sensitive bool
+}
+
+// hashManifest returns the SHA-256 hash of a manifest of lines
+func hashManifest(lines []string) string {
+	sort.Strings(lines)
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(lines, ""))))
+}
+
+// HashFiles returns the hash of a canonical manifest listing the name and the hash of the
+// content of every file, so that it does not depend on where or in which order they are written
+func HashFiles(files map[string][]byte) string {
+	lines := []string{}
+	for name, content := range files {
+		lines = append(lines, fmt.Sprintf("%x  %s\n", sha256.Sum256(content), name))
+	}
+	return hashManifest(lines)
+}
+
+// HashVariables returns the hash of a canonical manifest of the variables. Values are only
+// included as hashes; the values of sensitive variables are not readable and are not covered.
+func HashVariables(variables []WorkspaceVariable) string {
+	lines := []string{}
+	for _, v := range variables {
+		lines = append(lines, fmt.Sprintf("%q %q %q %q hcl=%t sensitive=%t %x\n",
+			v.Source, v.Category, v.Key, v.ID, v.HCL, v.Sensitive, sha256.Sum256([]byte(v.Value))))
+	}
+	return hashManifest(lines)
+}
+
+// HashConfiguration returns the hash of every input of a configuration version and a
+// hash covering all of them
+func HashConfiguration(files, extraFiles map[string][]byte, variables []WorkspaceVariable) (string, infrastructurev1alpha1.ConfigurationHashes) {
+	hashes := infrastructurev1alpha1.ConfigurationHashes{
+		Configuration: HashFiles(files),
+		ExtraFiles:    HashFiles(extraFiles),
+		Variables:     HashVariables(variables),
+	}
+	return hashManifest([]string{
+		fmt.Sprintf("configuration %s\n", hashes.Configuration),
+		fmt.Sprintf("extraFiles %s\n", hashes.ExtraFiles),
+		fmt.Sprintf("variables %s\n", hashes.Variables),
+	}), hashes
+}
@@ -0,0 +1,91 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package terraform
+
+import (
+	"testing"
+)
+
+func TestHashConfiguration(t *testing.T) {
+	files := map[string][]byte{"main.tf": []byte(`module "cluster" {}`)}
+	extra := map[string][]byte{"providers.tf": []byte(`provider "google" {}`)}
+	variables := []WorkspaceVariable{
+		{Source: "workspace", ID: "var-1", Key: "region", Category: "terraform", Value: "europe-west1"},
+		{Source: "varset-1", ID: "var-2", Key: "GOOGLE_CREDENTIALS", Category: "env", Sensitive: true},
+	}
+	hash, hashes := HashConfiguration(files, extra, variables)
+
+	t.Run("deterministic", func(t *testing.T) {
+		reordered := []WorkspaceVariable{variables[1], variables[0]}
+		got, _ := HashConfiguration(files, extra, reordered)
+		if got != hash {
+			t.Errorf("expected the hash not to depend on the order of variables")
+		}
+	})
+
+	tests := []struct {
+		name      string
+		files     map[string][]byte
+		extra     map[string][]byte
+		variables []WorkspaceVariable
+		changed   string
+	}{
+		{
+			name:      "configuration",
+			files:     map[string][]byte{"main.tf": []byte(`module "cluster" { }`)},
+			extra:     extra,
+			variables: variables,
+			changed:   "configuration",
+		},
+		{
+			name:      "renamed file",
+			files:     map[string][]byte{"cluster.tf": []byte(`module "cluster" {}`)},
+			extra:     extra,
+			variables: variables,
+			changed:   "configuration",
+		},
+		{
+			name:      "extra files",
+			files:     files,
+			extra:     nil,
+			variables: variables,
+			changed:   "extraFiles",
+		},
+		{
+			name:  "variable value",
+			files: files,
+			extra: extra,
+			variables: []WorkspaceVariable{
+				{Source: "workspace", ID: "var-1", Key: "region", Category: "terraform", Value: "us-east1"},
+				variables[1],
+			},
+			changed: "variables",
+		},
+		{
+			name:      "variable removed",
+			files:     files,
+			extra:     extra,
+			variables: variables[:1],
+			changed:   "variables",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotHashes := HashConfiguration(tt.files, tt.extra, tt.variables)
+			if got == hash {
+				t.Errorf("expected the hash to change")
+			}
+			changed := map[string]bool{
+				"configuration": gotHashes.Configuration != hashes.Configuration,
+				"extraFiles":    gotHashes.ExtraFiles != hashes.ExtraFiles,
+				"variables":     gotHashes.Variables != hashes.Variables,
+			}
+			for component, c := range changed {
+				if c != (component == tt.changed) {
+					t.Errorf("unexpected change of the %s hash: %t", component, c)
+				}
+			}
+		})
+	}
+}
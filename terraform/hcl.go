@@ -0,0 +1,114 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package terraform
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+// validateIdentifier returns an error if name cannot be used as a Terraform identifier
+func validateIdentifier(kind, name string) error {
+	if !hclsyntax.ValidIdentifier(name) {
+		return fmt.Errorf("%s name %q is not a valid Terraform identifier", kind, name)
+	}
+	return nil
+}
+
+// traversal returns the tokens for a reference such as var.name or module.cluster.name
+func traversal(root string, attrs ...string) hclwrite.Tokens {
+	t := hcl.Traversal{hcl.TraverseRoot{Name: root}}
+	for _, a := range attrs {
+		t = append(t, hcl.TraverseAttr{Name: a})
+	}
+	return hclwrite.TokensForTraversal(t)
+}
+
+// stringList returns a list of strings as a cty value
+func stringList(values []string) cty.Value {
+	if len(values) == 0 {
+		return cty.ListValEmpty(cty.String)
+	}
+	l := []cty.Value{}
+	for _, v := range values {
+		l = append(l, cty.StringVal(v))
+	}
+	return cty.ListVal(l)
+}
+
+// stringMap returns a map of strings as a cty value
+func stringMap(values map[string]string) cty.Value {
+	if len(values) == 0 {
+		return cty.MapValEmpty(cty.String)
+	}
+	m := map[string]cty.Value{}
+	for k, v := range values {
+		m[k] = cty.StringVal(v)
+	}
+	return cty.MapVal(m)
+}
+
+// writeModule appends a module block calling the module and passing it each of the variables
+func writeModule(body *hclwrite.Body, name string, module infrastructurev1alpha1.TerraformModule, variables []infrastructurev1alpha1.Variable) (*hclwrite.Body, error) {
+	for _, v := range variables {
+		if err := validateIdentifier("variable", v.Name); err != nil {
+			return nil, err
+		}
+		body.AppendNewBlock("variable", []string{v.Name})
+		body.AppendNewline()
+	}
+
+	block := body.AppendNewBlock("module", []string{name})
+	moduleBody := block.Body()
+	moduleBody.SetAttributeValue("source", cty.StringVal(module.Source))
+	if module.Version != "" {
+		moduleBody.SetAttributeValue("version", cty.StringVal(module.Version))
+	}
+	if len(variables) > 0 {
+		moduleBody.AppendNewline()
+		for _, v := range variables {
+			moduleBody.SetAttributeRaw(v.Name, traversal("var", v.Name))
+		}
+	}
+	moduleBody.AppendNewline()
+	return moduleBody, nil
+}
+
+// writeOutputs appends a root output block for each distinct module output in the mappings
+func writeOutputs(body *hclwrite.Body, module string, mappings []infrastructurev1alpha1.OutputMapping) error {
+	for _, m := range outputs(mappings) {
+		if err := validateIdentifier("output", m.Name); err != nil {
+			return err
+		}
+		body.AppendNewline()
+		outputBody := body.AppendNewBlock("output", []string{m.Name}).Body()
+		outputBody.SetAttributeRaw("value", traversal("module", module, m.Name))
+		if m.Sensitive {
+			outputBody.SetAttributeValue("sensitive", cty.True)
+		}
+	}
+	return nil
+}
+
+// outputs returns one mapping for each distinct output name so that an output mapped to
+// several destinations is only declared once, marked sensitive if any mapping is
+func outputs(mappings []infrastructurev1alpha1.OutputMapping) []infrastructurev1alpha1.OutputMapping {
+	index := map[string]int{}
+	unique := []infrastructurev1alpha1.OutputMapping{}
+	for _, m := range mappings {
+		if i, ok := index[m.Name]; ok {
+			unique[i].Sensitive = unique[i].Sensitive || m.Sensitive
+			continue
+		}
+		index[m.Name] = len(unique)
+		unique = append(unique, m)
+	}
+	return unique
+}
@@ -0,0 +1,125 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package terraform
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+// ManagedControlPlaneConfiguration returns the Terraform configuration that calls the
+// module of the control plane
+func ManagedControlPlaneConfiguration(controlPlane *infrastructurev1alpha1.TFCManagedControlPlane, cluster *clusterv1beta1.Cluster) (*hclwrite.File, error) {
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+
+	moduleBody, err := writeModule(body, "cluster", controlPlane.Spec.Module, controlPlane.Spec.Variables)
+	if err != nil {
+		return nil, err
+	}
+	moduleBody.SetAttributeValue("cluster_name", cty.StringVal(cluster.Name))
+	moduleBody.SetAttributeValue("kubernetes_version", cty.StringVal(controlPlane.Spec.Version))
+
+	if network := cluster.Spec.ClusterNetwork; network != nil {
+		moduleBody.SetAttributeValue("cluster_network", clusterNetwork(network))
+	}
+	if len(cluster.Labels) > 0 {
+		moduleBody.SetAttributeValue("cluster_labels", stringMap(cluster.Labels))
+	}
+	if annotations := clusterAnnotations(controlPlane, cluster); len(annotations) > 0 {
+		moduleBody.SetAttributeValue("cluster_annotations", stringMap(annotations))
+	}
+	if topology := cluster.Spec.Topology; topology != nil {
+		value, err := clusterTopology(topology)
+		if err != nil {
+			return nil, err
+		}
+		moduleBody.SetAttributeValue("cluster_topology", value)
+	}
+
+	if err := writeOutputs(body, "cluster", controlPlane.Spec.GetOutputs()); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// clusterNetwork returns the cluster_network input. CIDR blocks are always set so that the
+// module can rely on the attributes being present.
+func clusterNetwork(network *clusterv1beta1.ClusterNetwork) cty.Value {
+	attrs := map[string]cty.Value{
+		"api_server_port":     cty.NullVal(cty.Number),
+		"service_domain":      cty.NullVal(cty.String),
+		"pod_cidr_blocks":     stringList(nil),
+		"service_cidr_blocks": stringList(nil),
+	}
+	if network.APIServerPort != nil {
+		attrs["api_server_port"] = cty.NumberIntVal(int64(*network.APIServerPort))
+	}
+	if network.ServiceDomain != "" {
+		attrs["service_domain"] = cty.StringVal(network.ServiceDomain)
+	}
+	if network.Pods != nil {
+		attrs["pod_cidr_blocks"] = stringList(network.Pods.CIDRBlocks)
+	}
+	if network.Services != nil {
+		attrs["service_cidr_blocks"] = stringList(network.Services.CIDRBlocks)
+	}
+	return cty.ObjectVal(attrs)
+}
+
+// clusterAnnotations returns the annotations of the Cluster listed in the spec that are passed to
+// the module, leaving out those written from the module's own outputs. Annotations are opt-in, as
+// those written by controllers, including from the outputs of machine pools, would otherwise change
+// the configuration every time they are written.
+func clusterAnnotations(controlPlane *infrastructurev1alpha1.TFCManagedControlPlane, cluster *clusterv1beta1.Cluster) map[string]string {
+	fromOutputs := map[string]bool{}
+	for _, m := range controlPlane.Spec.Outputs {
+		if m.ClusterAnnotation != "" {
+			fromOutputs[m.ClusterAnnotation] = true
+		}
+	}
+
+	annotations := map[string]string{}
+	for _, k := range controlPlane.Spec.ClusterAnnotations {
+		v, ok := cluster.Annotations[k]
+		if !ok || fromOutputs[k] {
+			continue
+		}
+		annotations[k] = v
+	}
+	return annotations
+}
+
+// clusterTopology returns the cluster_topology input describing the managed topology of the Cluster
+func clusterTopology(topology *clusterv1beta1.Topology) (cty.Value, error) {
+	variables := map[string]cty.Value{}
+	for _, v := range topology.Variables {
+		raw := v.Value.Raw
+		if len(raw) == 0 {
+			variables[v.Name] = cty.NullVal(cty.DynamicPseudoType)
+			continue
+		}
+		t, err := ctyjson.ImpliedType(raw)
+		if err != nil {
+			return cty.NilVal, fmt.Errorf("topology variable %q is not valid JSON: %w", v.Name, err)
+		}
+		value, err := ctyjson.Unmarshal(raw, t)
+		if err != nil {
+			return cty.NilVal, fmt.Errorf("topology variable %q is not valid JSON: %w", v.Name, err)
+		}
+		variables[v.Name] = value
+	}
+
+	return cty.ObjectVal(map[string]cty.Value{
+		"class":     cty.StringVal(topology.Class),
+		"version":   cty.StringVal(topology.Version),
+		"variables": cty.ObjectVal(variables),
+	}), nil
+}
@@ -0,0 +1,57 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package terraform
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	expclusterv1beta1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+// autoscalerAnnotations are the cluster-autoscaler annotations of a MachinePool passed to the module
+var autoscalerAnnotations = []struct{ annotation, input string }{
+	{"cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size", "min_size"},
+	{"cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size", "max_size"},
+}
+
+// ManagedMachinePoolConfiguration returns the Terraform configuration that calls the
+// module of the machine pool
+func ManagedMachinePoolConfiguration(machinePool *infrastructurev1alpha1.TFCManagedMachinePool, owner *expclusterv1beta1.MachinePool) (*hclwrite.File, error) {
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+
+	moduleBody, err := writeModule(body, "machine_pool", machinePool.Spec.Module, machinePool.Spec.Variables)
+	if err != nil {
+		return nil, err
+	}
+	moduleBody.SetAttributeValue("pool_name", cty.StringVal(owner.Name))
+	moduleBody.SetAttributeValue("cluster_name", cty.StringVal(owner.Spec.ClusterName))
+	if machinePool.Status.Version != "" {
+		moduleBody.SetAttributeValue("kubernetes_version", cty.StringVal(machinePool.Status.Version))
+	}
+	if !machinePool.Spec.ManagedAutoscaling && owner.Spec.Replicas != nil {
+		moduleBody.SetAttributeValue("replicas", cty.NumberIntVal(int64(*owner.Spec.Replicas)))
+	}
+	for _, a := range autoscalerAnnotations {
+		v, ok := owner.Annotations[a.annotation]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("annotation %s must be an integer: %w", a.annotation, err)
+		}
+		moduleBody.SetAttributeValue(a.input, cty.NumberIntVal(int64(n)))
+	}
+
+	if err := writeOutputs(body, "machine_pool", machinePool.Spec.GetOutputs()); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,192 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pmezard/go-difflib/difflib"
+	corev1 "k8s.io/api/core/v1"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+const (
+	// RevisionLabel is the label holding the revision number of a configuration revision ConfigMap
+	RevisionLabel = "infrastructure.cluster.x-k8s.io/configuration-revision"
+
+	// RevisionOwnerLabel is the label holding the UID of the resource a configuration revision belongs to
+	RevisionOwnerLabel = "infrastructure.cluster.x-k8s.io/configuration-owner"
+
+	// ConfigurationVersionAnnotation holds the ID of the ConfigurationVersion a revision was uploaded as
+	ConfigurationVersionAnnotation = "infrastructure.cluster.x-k8s.io/configuration-version-id"
+
+	// ConfigurationHashAnnotation holds the configuration hash of a revision
+	ConfigurationHashAnnotation = "infrastructure.cluster.x-k8s.io/configuration-hash"
+
+	// OmittedFilesAnnotation lists the files of a revision whose content is not stored
+	OmittedFilesAnnotation = "infrastructure.cluster.x-k8s.io/omitted-files"
+
+	// DefaultRevisionHistoryLimit is the number of revisions kept when revisionHistoryLimit is not set
+	DefaultRevisionHistoryLimit = 10
+
+	// maxRevisionSize bounds the size of the files stored in a revision ConfigMap,
+	// well below the limit on the size of objects
+	maxRevisionSize = 512 * 1024
+)
+
+// SecretFileNames returns the names of the extra files read from Secrets, whose content
+// must not be published
+func SecretFileNames(extraFiles []infrastructurev1alpha1.ExtraFile) map[string]bool {
+	names := map[string]bool{}
+	for _, f := range extraFiles {
+		if f.SecretKeyRef != nil {
+			names[f.Name] = true
+		}
+	}
+	return names
+}
+
+// RevisionName returns the name of the ConfigMap storing a revision of the configuration of the owner
+func RevisionName(owner client.Object, revision int64) string {
+	return fmt.Sprintf("%s-configuration-%d", owner.GetName(), revision)
+}
+
+// NewRevision returns a ConfigMap storing the files of a configuration revision. The content of
+// files read from Secrets, and of files that would exceed the size limit, is omitted.
+func NewRevision(owner client.Object, clusterName string, revision int64, configurationVersionID, hash string, files, extraFiles map[string][]byte, secretFiles map[string]bool) *corev1.ConfigMap {
+	configMap := &corev1.ConfigMap{}
+	configMap.Namespace = owner.GetNamespace()
+	configMap.Name = RevisionName(owner, revision)
+	configMap.Labels = map[string]string{
+		clusterv1beta1.ClusterLabelName: clusterName,
+		RevisionLabel:                   strconv.FormatInt(revision, 10),
+		RevisionOwnerLabel:              string(owner.GetUID()),
+	}
+	configMap.Annotations = map[string]string{
+		ConfigurationVersionAnnotation: configurationVersionID,
+		ConfigurationHashAnnotation:    hash,
+	}
+
+	names := []string{}
+	for _, fs := range []map[string][]byte{files, extraFiles} {
+		for name := range fs {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	omitted := []string{}
+	size := 0
+	for _, name := range names {
+		content, ok := files[name]
+		if !ok {
+			content = extraFiles[name]
+		}
+		switch {
+		case secretFiles[name]:
+			omitted = append(omitted, fmt.Sprintf("%s (read from a Secret)", name))
+		case size+len(name)+len(content) > maxRevisionSize:
+			omitted = append(omitted, fmt.Sprintf("%s (too large)", name))
+		case utf8.Valid(content):
+			if configMap.Data == nil {
+				configMap.Data = map[string]string{}
+			}
+			configMap.Data[name] = string(content)
+			size += len(name) + len(content)
+		default:
+			if configMap.BinaryData == nil {
+				configMap.BinaryData = map[string][]byte{}
+			}
+			configMap.BinaryData[name] = content
+			size += len(name) + len(content)
+		}
+	}
+	if len(omitted) > 0 {
+		configMap.Annotations[OmittedFilesAnnotation] = strings.Join(omitted, ", ")
+	}
+	return configMap
+}
+
+// Revision returns the revision number of a configuration revision ConfigMap
+func Revision(configMap *corev1.ConfigMap) int64 {
+	revision, _ := strconv.ParseInt(configMap.Labels[RevisionLabel], 10, 64)
+	return revision
+}
+
+// ListRevisions returns the configuration revision ConfigMaps of the owner, oldest first
+func ListRevisions(ctx context.Context, c client.Reader, owner client.Object) ([]corev1.ConfigMap, error) {
+	var list corev1.ConfigMapList
+	err := c.List(ctx, &list, client.InNamespace(owner.GetNamespace()), client.MatchingLabels{
+		RevisionOwnerLabel: string(owner.GetUID()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	revisions := list.Items
+	sort.Slice(revisions, func(i, j int) bool {
+		return Revision(&revisions[i]) < Revision(&revisions[j])
+	})
+	return revisions, nil
+}
+
+// DiffRevisions returns a unified diff of the files of two configuration revisions
+func DiffRevisions(from, to *corev1.ConfigMap) (string, error) {
+	names := map[string]bool{}
+	for _, cm := range []*corev1.ConfigMap{from, to} {
+		for name := range cm.Data {
+			names[name] = true
+		}
+		for name := range cm.BinaryData {
+			names[name] = true
+		}
+	}
+	sorted := []string{}
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var b strings.Builder
+	if from.Annotations[OmittedFilesAnnotation] != to.Annotations[OmittedFilesAnnotation] {
+		fmt.Fprintf(&b, "omitted files changed from %q to %q\n", from.Annotations[OmittedFilesAnnotation], to.Annotations[OmittedFilesAnnotation])
+	}
+	for _, name := range sorted {
+		a, aBinary := revisionFile(from, name)
+		z, zBinary := revisionFile(to, name)
+		if aBinary || zBinary {
+			if a != z {
+				fmt.Fprintf(&b, "binary file %s differs\n", name)
+			}
+			continue
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(a),
+			B:        difflib.SplitLines(z),
+			FromFile: fmt.Sprintf("revision %d/%s", Revision(from), name),
+			ToFile:   fmt.Sprintf("revision %d/%s", Revision(to), name),
+			Context:  3,
+		})
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(diff)
+	}
+	return b.String(), nil
+}
+
+// revisionFile returns the content of a file of a revision and whether it is binary
+func revisionFile(configMap *corev1.ConfigMap, name string) (string, bool) {
+	if content, ok := configMap.BinaryData[name]; ok {
+		return string(content), true
+	}
+	return configMap.Data[name], false
+}
@@ -0,0 +1,79 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package terraform
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNewRevision(t *testing.T) {
+	files := map[string][]byte{"main.tf": []byte("module \"cluster\" {}\n")}
+	extra := map[string][]byte{
+		"credentials.auto.tfvars": []byte("credentials = \"secret\"\n"),
+		"large.tf":                bytes.Repeat([]byte("#"), maxRevisionSize),
+		"plugin.bin":              {0xff, 0xfe},
+	}
+	cp := testControlPlane()
+	cp.UID = "uid-1"
+
+	cm := NewRevision(cp, "example", 3, "cv-1", "abc", files, extra, map[string]bool{"credentials.auto.tfvars": true})
+
+	if cm.Name != "example-configuration-3" || Revision(cm) != 3 {
+		t.Errorf("unexpected name %q or revision %d", cm.Name, Revision(cm))
+	}
+	if cm.Labels[RevisionOwnerLabel] != "uid-1" || cm.Annotations[ConfigurationVersionAnnotation] != "cv-1" {
+		t.Errorf("unexpected labels %v or annotations %v", cm.Labels, cm.Annotations)
+	}
+	if cm.Data["main.tf"] != string(files["main.tf"]) {
+		t.Errorf("expected main.tf to be stored, got %q", cm.Data["main.tf"])
+	}
+	if _, ok := cm.BinaryData["plugin.bin"]; !ok {
+		t.Error("expected plugin.bin to be stored as binary data")
+	}
+	for _, name := range []string{"credentials.auto.tfvars", "large.tf"} {
+		if _, ok := cm.Data[name]; ok {
+			t.Errorf("expected the content of %s not to be stored", name)
+		}
+	}
+	want := "credentials.auto.tfvars (read from a Secret), large.tf (too large)"
+	if got := cm.Annotations[OmittedFilesAnnotation]; got != want {
+		t.Errorf("expected omitted files %q, got %q", want, got)
+	}
+}
+
+func TestDiffRevisions(t *testing.T) {
+	cp := testControlPlane()
+	from := NewRevision(cp, "example", 1, "cv-1", "a", map[string][]byte{
+		"main.tf": []byte("module \"cluster\" {\n  kubernetes_version = \"1.24\"\n}\n"),
+	}, map[string][]byte{"providers.tf": []byte("provider \"google\" {}\n")}, nil)
+	to := NewRevision(cp, "example", 2, "cv-2", "b", map[string][]byte{
+		"main.tf": []byte("module \"cluster\" {\n  kubernetes_version = \"1.25\"\n}\n"),
+	}, nil, nil)
+
+	diff, err := DiffRevisions(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"--- revision 1/main.tf",
+		"+++ revision 2/main.tf",
+		"-  kubernetes_version = \"1.24\"",
+		"+  kubernetes_version = \"1.25\"",
+		"-provider \"google\" {}",
+	} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("expected the diff to contain %q:\n%s", want, diff)
+		}
+	}
+
+	same, err := DiffRevisions(from, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same != "" {
+		t.Errorf("expected no difference, got:\n%s", same)
+	}
+}
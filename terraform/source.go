@@ -0,0 +1,105 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package terraform
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expclusterv1beta1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+)
+
+// ManagedControlPlaneFiles returns the configuration files for a TFCManagedControlPlane, either
+// generated or rendered from the templates it refers to, keyed by file name
+func ManagedControlPlaneFiles(ctx context.Context, c client.Reader, controlPlane *infrastructurev1alpha1.TFCManagedControlPlane, cluster *clusterv1beta1.Cluster) (map[string][]byte, error) {
+	if ref := controlPlane.Spec.TemplateRef; ref != nil {
+		return ReadTemplates(ctx, c, controlPlane.Namespace, ref, TemplateData{
+			Object:  controlPlane,
+			Owner:   cluster,
+			Cluster: cluster,
+		})
+	}
+	config, err := ManagedControlPlaneConfiguration(controlPlane, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return Files(config), nil
+}
+
+// ManagedMachinePoolFiles returns the configuration files for a TFCManagedMachinePool, either
+// generated or rendered from the templates it refers to, keyed by file name
+func ManagedMachinePoolFiles(ctx context.Context, c client.Reader, machinePool *infrastructurev1alpha1.TFCManagedMachinePool, owner *expclusterv1beta1.MachinePool, cluster *clusterv1beta1.Cluster) (map[string][]byte, error) {
+	if ref := machinePool.Spec.TemplateRef; ref != nil {
+		return ReadTemplates(ctx, c, machinePool.Namespace, ref, TemplateData{
+			Object:  machinePool,
+			Owner:   owner,
+			Cluster: cluster,
+		})
+	}
+	config, err := ManagedMachinePoolConfiguration(machinePool, owner)
+	if err != nil {
+		return nil, err
+	}
+	return Files(config), nil
+}
+
+// ReadTemplates reads the ConfigMap a templateRef refers to and renders its files
+func ReadTemplates(ctx context.Context, c client.Reader, namespace string, ref *infrastructurev1alpha1.TemplateReference, data TemplateData) (map[string][]byte, error) {
+	var configMap corev1.ConfigMap
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, &configMap); err != nil {
+		return nil, fmt.Errorf("could not read templates from ConfigMap %q: %w", ref.Name, err)
+	}
+	files, err := RenderTemplates(configMap.Data, data)
+	if err != nil {
+		return nil, fmt.Errorf("could not render templates from ConfigMap %q: %w", ref.Name, err)
+	}
+	return files, nil
+}
+
+// ReadExtraFiles returns the content of the extra files keyed by file name
+func ReadExtraFiles(ctx context.Context, c client.Reader, namespace string, extraFiles []infrastructurev1alpha1.ExtraFile) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for _, f := range extraFiles {
+		if _, ok := files[f.Name]; ok {
+			return nil, fmt.Errorf("extra file %q is listed more than once", f.Name)
+		}
+
+		switch {
+		case f.ConfigMapKeyRef != nil && f.SecretKeyRef == nil && f.Content == "":
+			ref := f.ConfigMapKeyRef
+			var configMap corev1.ConfigMap
+			if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, &configMap); err != nil {
+				return nil, fmt.Errorf("could not read extra file %q: %w", f.Name, err)
+			}
+			if v, ok := configMap.Data[ref.Key]; ok {
+				files[f.Name] = []byte(v)
+			} else if v, ok := configMap.BinaryData[ref.Key]; ok {
+				files[f.Name] = v
+			} else {
+				return nil, fmt.Errorf("could not read extra file %q: ConfigMap %q has no key %q", f.Name, ref.Name, ref.Key)
+			}
+		case f.SecretKeyRef != nil && f.ConfigMapKeyRef == nil && f.Content == "":
+			ref := f.SecretKeyRef
+			var secret corev1.Secret
+			if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, &secret); err != nil {
+				return nil, fmt.Errorf("could not read extra file %q: %w", f.Name, err)
+			}
+			v, ok := secret.Data[ref.Key]
+			if !ok {
+				return nil, fmt.Errorf("could not read extra file %q: Secret %q has no key %q", f.Name, ref.Name, ref.Key)
+			}
+			files[f.Name] = v
+		case f.ConfigMapKeyRef == nil && f.SecretKeyRef == nil:
+			files[f.Name] = []byte(f.Content)
+		default:
+			return nil, fmt.Errorf("extra file %q must set exactly one of content, configMapKeyRef or secretKeyRef", f.Name)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,136 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// TemplateSuffix is the suffix of the files of a template ConfigMap that are rendered as Go
+// templates. It is removed from the name of the rendered file; other files are copied verbatim.
+const TemplateSuffix = ".tmpl"
+
+// TemplateData is the data available to configuration templates
+type TemplateData struct {
+	// Object is the TFCManagedControlPlane or TFCManagedMachinePool being reconciled
+	Object any
+
+	// Owner is the Cluster owning a TFCManagedControlPlane or the MachinePool owning a TFCManagedMachinePool
+	Owner any
+
+	// Cluster is the Cluster the object belongs to
+	Cluster *clusterv1beta1.Cluster
+}
+
+// templateFuncs are the helper functions available to configuration templates
+var templateFuncs = template.FuncMap{
+	"deref": deref,
+	"hcl":   hclLiteral,
+}
+
+// deref returns the value a pointer refers to so it can be rendered
+// in a template, or nil if the pointer is nil
+func deref(v any) any {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	return rv.Interface()
+}
+
+// hclLiteral returns the value as an HCL expression with every string quoted and escaped,
+// so that values from the spec cannot change the structure of the configuration
+func hclLiteral(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	t, err := ctyjson.ImpliedType(b)
+	if err != nil {
+		return "", err
+	}
+	value, err := ctyjson.Unmarshal(b, t)
+	if err != nil {
+		return "", err
+	}
+	return string(hclwrite.TokensForValue(value).Bytes()), nil
+}
+
+// parseTemplates parses the files ending in TemplateSuffix
+func parseTemplates(files map[string]string) (map[string]*template.Template, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no configuration files")
+	}
+	templates := map[string]*template.Template{}
+	for name, content := range files {
+		if name != strings.TrimSpace(name) || strings.ContainsAny(name, "/\\") || strings.HasPrefix(name, "..") {
+			return nil, fmt.Errorf("%q is not a valid file name", name)
+		}
+		if !strings.HasSuffix(name, TemplateSuffix) {
+			continue
+		}
+		t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(content)
+		if err != nil {
+			return nil, err
+		}
+		templates[name] = t
+	}
+	return templates, nil
+}
+
+// ValidateTemplates returns an error if any of the configuration templates cannot be parsed
+func ValidateTemplates(files map[string]string) error {
+	_, err := parseTemplates(files)
+	return err
+}
+
+// RenderTemplates renders the files of a template ConfigMap, keyed by file name. Files ending in
+// TemplateSuffix are executed with the data and written without the suffix.
+func RenderTemplates(files map[string]string, data TemplateData) (map[string][]byte, error) {
+	templates, err := parseTemplates(files)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rendered := map[string][]byte{}
+	for _, name := range names {
+		t, ok := templates[name]
+		if !ok {
+			rendered[name] = []byte(files[name])
+			continue
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		out := strings.TrimSuffix(name, TemplateSuffix)
+		if _, ok := files[out]; ok {
+			return nil, fmt.Errorf("template %q renders to %q which already exists", name, out)
+		}
+		rendered[out] = buf.Bytes()
+	}
+	return rendered, nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package terraform
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/utils/pointer"
+	clusterv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const testTemplate = `module "cluster" {
+  source  = "example-org/capi/controlplane"
+  version = "1.0.0"
+
+  cluster_name       = {{ hcl .Cluster.Name }}
+  kubernetes_version = {{ hcl .Object.Spec.Version }}
+  api_server_port    = {{ hcl (deref .Cluster.Spec.ClusterNetwork.APIServerPort) }}
+  labels             = {{ hcl .Cluster.Labels }}
+}
+`
+
+func TestRenderTemplates(t *testing.T) {
+	cp := testControlPlane()
+	cp.Spec.Version = "1.24 ${evil}"
+	cluster := testCluster()
+	cluster.Labels = map[string]string{"team": `a"b`}
+	cluster.Spec.ClusterNetwork = &clusterv1beta1.ClusterNetwork{APIServerPort: pointer.Int32(6443)}
+
+	files, err := RenderTemplates(map[string]string{
+		"main.tf.tmpl": testTemplate,
+		"outputs.tf":   `output "kubeconfig" { value = module.cluster.kubeconfig }`,
+	}, TemplateData{Object: cp, Owner: cluster, Cluster: cluster})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+	if got := string(files["outputs.tf"]); got != `output "kubeconfig" { value = module.cluster.kubeconfig }` {
+		t.Errorf("outputs.tf was not copied verbatim: %s", got)
+	}
+	assertGolden(t, "template_controlplane", files["main.tf"])
+}
+
+func TestRenderTemplatesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{
+			name:  "empty",
+			files: map[string]string{},
+			err:   "no configuration files",
+		},
+		{
+			name:  "parse error",
+			files: map[string]string{"main.tf.tmpl": "{{ .Object"},
+			err:   "unclosed action",
+		},
+		{
+			name:  "missing field",
+			files: map[string]string{"main.tf.tmpl": "{{ .Missing }}"},
+			err:   "can't evaluate field Missing",
+		},
+		{
+			name:  "duplicate file",
+			files: map[string]string{"main.tf.tmpl": "", "main.tf": ""},
+			err:   "already exists",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RenderTemplates(tt.files, TemplateData{Object: testControlPlane(), Cluster: testCluster()})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
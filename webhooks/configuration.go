@@ -0,0 +1,236 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package webhooks
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1alpha1 "github.com/hashicorp/cluster-api-provider-terraform-cloud/api/v1alpha1"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/backend"
+	"github.com/hashicorp/cluster-api-provider-terraform-cloud/terraform"
+)
+
+//+kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1alpha1-tfcmanagedcontrolplane,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=tfcmanagedcontrolplanes,verbs=create;update,versions=v1alpha1,name=validation.tfcmanagedcontrolplane.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1alpha1-tfcmanagedmachinepool,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=tfcmanagedmachinepools,verbs=create;update,versions=v1alpha1,name=validation.tfcmanagedmachinepool.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// ConfigurationValidator rejects TFCManagedControlPlanes and TFCManagedMachinePools that set neither a
+// module nor a templateRef, whose templateRef refers to templates that cannot be parsed, whose
+// extra files, output mappings or token refresh settings are invalid, that use Terraform Cloud without an organization,
+// or the local backend without a service account.
+type ConfigurationValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &ConfigurationValidator{}
+
+// SetupWebhookWithManager registers the validator for both resources with the Manager
+func (v *ConfigurationValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	for _, obj := range []runtime.Object{
+		&infrastructurev1alpha1.TFCManagedControlPlane{},
+		&infrastructurev1alpha1.TFCManagedMachinePool{},
+	} {
+		if err := ctrl.NewWebhookManagedBy(mgr).For(obj).WithValidator(v).Complete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateCreate implements admission.CustomValidator
+func (v *ConfigurationValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	return v.validate(ctx, obj)
+}
+
+// ValidateUpdate implements admission.CustomValidator. Updates that leave the spec unchanged, such
+// as the removal of a finalizer, and updates of a deleted resource are not validated again, so that
+// a templateRef ConfigMap that has since been broken or deleted cannot block them.
+func (v *ConfigurationValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	if o, ok := newObj.(client.Object); ok {
+		if o.GetDeletionTimestamp() != nil {
+			return nil
+		}
+		// the generation is only incremented when the spec changes
+		if old, ok := oldObj.(client.Object); ok && o.GetGeneration() != 0 && o.GetGeneration() == old.GetGeneration() {
+			return nil
+		}
+	}
+	return v.validate(ctx, newObj)
+}
+
+// ValidateDelete implements admission.CustomValidator
+func (v *ConfigurationValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func (v *ConfigurationValidator) validate(ctx context.Context, obj runtime.Object) error {
+	var module infrastructurev1alpha1.TerraformModule
+	var ref *infrastructurev1alpha1.TemplateReference
+	var files []infrastructurev1alpha1.ExtraFile
+	var be infrastructurev1alpha1.Backend
+	var organization string
+	var outputs []infrastructurev1alpha1.OutputMapping
+	var o client.Object
+	var kind string
+	switch t := obj.(type) {
+	case *infrastructurev1alpha1.TFCManagedControlPlane:
+		module, ref, files, o, kind = t.Spec.Module, t.Spec.TemplateRef, t.Spec.ExtraFiles, t, "TFCManagedControlPlane"
+		be, organization, outputs = t.Spec.Backend, t.Spec.Organization, t.Spec.Outputs
+	case *infrastructurev1alpha1.TFCManagedMachinePool:
+		module, ref, files, o, kind = t.Spec.Module, t.Spec.TemplateRef, t.Spec.ExtraFiles, t, "TFCManagedMachinePool"
+		be, organization, outputs = t.Spec.Backend, t.Spec.Organization, t.Spec.Outputs
+	default:
+		return fmt.Errorf("unexpected object %T", obj)
+	}
+
+	gk := infrastructurev1alpha1.GroupVersion.WithKind(kind).GroupKind()
+	allErrs := validateExtraFiles(files, ref == nil)
+	allErrs = append(allErrs, validateBackend(be, organization, files)...)
+	allErrs = append(allErrs, validateOutputs(outputs)...)
+	if cp, ok := obj.(*infrastructurev1alpha1.TFCManagedControlPlane); ok {
+		allErrs = append(allErrs, validateKubeconfig(&cp.Spec.Kubeconfig)...)
+	}
+	if ref == nil {
+		if module.Source == "" {
+			allErrs = append(allErrs, field.Required(field.NewPath("spec", "module", "source"), "either module or templateRef must be set"))
+		}
+		return invalid(gk, o.GetName(), allErrs)
+	}
+
+	// the ConfigMap may be created after the resource, in which case the controller reports the error
+	var configMap corev1.ConfigMap
+	err := v.Client.Get(ctx, client.ObjectKey{Namespace: o.GetNamespace(), Name: ref.Name}, &configMap)
+	if apierrors.IsNotFound(err) {
+		return invalid(gk, o.GetName(), allErrs)
+	}
+	if err != nil {
+		return err
+	}
+	if err := terraform.ValidateTemplates(configMap.Data); err != nil {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "templateRef", "name"), ref.Name,
+			fmt.Sprintf("invalid templates in ConfigMap: %v", err)))
+	}
+	return invalid(gk, o.GetName(), allErrs)
+}
+
+// validateExtraFiles checks that every extra file has a unique name and at most one source
+func validateExtraFiles(files []infrastructurev1alpha1.ExtraFile, generated bool) field.ErrorList {
+	allErrs := field.ErrorList{}
+	names := map[string]bool{}
+	for i, f := range files {
+		path := field.NewPath("spec", "extraFiles").Index(i)
+		if names[f.Name] {
+			allErrs = append(allErrs, field.Duplicate(path.Child("name"), f.Name))
+		}
+		names[f.Name] = true
+		if generated && f.Name == "main.tf" {
+			allErrs = append(allErrs, field.Invalid(path.Child("name"), f.Name, "conflicts with the generated configuration"))
+		}
+
+		sources := 0
+		if f.Content != "" {
+			sources++
+		}
+		if f.ConfigMapKeyRef != nil {
+			sources++
+		}
+		if f.SecretKeyRef != nil {
+			sources++
+		}
+		if sources > 1 {
+			allErrs = append(allErrs, field.Forbidden(path, "only one of content, configMapKeyRef or secretKeyRef may be set"))
+		}
+	}
+	return allErrs
+}
+
+// validateOutputs checks that every output mapping has exactly one destination and that no
+// two mappings write to the same field, key or annotation
+func validateOutputs(mappings []infrastructurev1alpha1.OutputMapping) field.ErrorList {
+	allErrs := field.ErrorList{}
+	seen := map[string]bool{}
+	for i, m := range mappings {
+		path := field.NewPath("spec", "outputs").Index(i)
+		destinations := 0
+		for _, d := range []struct{ name, value string }{
+			{"field", m.Field},
+			{"secretKey", m.SecretKey},
+			{"configMapKey", m.ConfigMapKey},
+			{"clusterAnnotation", m.ClusterAnnotation},
+		} {
+			if d.value == "" {
+				continue
+			}
+			destinations++
+			if seen[d.name+"/"+d.value] {
+				allErrs = append(allErrs, field.Duplicate(path.Child(d.name), d.value))
+			}
+			seen[d.name+"/"+d.value] = true
+		}
+		if destinations != 1 {
+			allErrs = append(allErrs, field.Invalid(path, m.Name, "exactly one of field, secretKey, configMapKey or clusterAnnotation must be set"))
+		}
+	}
+	return allErrs
+}
+
+// validateKubeconfig checks that a generated token is refreshed before it expires, as a
+// refreshBefore that is not shorter than the tokenTTL would trigger a refresh on every run
+func validateKubeconfig(spec *infrastructurev1alpha1.KubeconfigSpec) field.ErrorList {
+	allErrs := field.ErrorList{}
+	path := field.NewPath("spec", "kubeconfig")
+	if spec.RefreshBefore != nil && spec.RefreshBefore.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("refreshBefore"), spec.RefreshBefore.Duration.String(), "must be positive"))
+	}
+	if spec.TokenTTL == nil {
+		return allErrs
+	}
+	if spec.TokenTTL.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("tokenTTL"), spec.TokenTTL.Duration.String(), "must be positive"))
+	} else if refreshBefore := spec.GetRefreshBefore(); refreshBefore >= spec.TokenTTL.Duration {
+		allErrs = append(allErrs, field.Invalid(path.Child("tokenTTL"), spec.TokenTTL.Duration.String(),
+			fmt.Sprintf("must be longer than refreshBefore (%s)", refreshBefore)))
+	}
+	return allErrs
+}
+
+// validateBackend checks that Terraform Cloud is given an organization and that the extra
+// files leave room for the backend configuration added by the local backend
+func validateBackend(be infrastructurev1alpha1.Backend, organization string, files []infrastructurev1alpha1.ExtraFile) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if !be.IsLocal() {
+		if organization == "" {
+			allErrs = append(allErrs, field.Required(field.NewPath("spec", "organization"), "organization is required unless the local backend is used"))
+		}
+		return allErrs
+	}
+	if be.Local == nil || be.Local.ServiceAccountName == "" {
+		allErrs = append(allErrs, field.Required(field.NewPath("spec", "backend", "local", "serviceAccountName"),
+			"the Jobs of the local backend need a service account allowed to manage Secrets and Leases"))
+	}
+	for i, f := range files {
+		if f.Name == backend.BackendOverrideFileName {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "extraFiles").Index(i).Child("name"), f.Name,
+				"conflicts with the configuration of the kubernetes backend"))
+		}
+	}
+	return allErrs
+}
+
+// invalid returns an Invalid error for the object if there are any field errors
+func invalid(gk schema.GroupKind, name string, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(gk, name, allErrs)
+}